@@ -0,0 +1,94 @@
+package meda
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/url"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"golang.org/x/net/websocket"
+)
+
+// apiProxyURL returns the websocket endpoint of the Meda API that relays a
+// TCP connection to port of the VM
+func apiProxyURL(config *Config, vmName string, port int) string {
+	return fmt.Sprintf("ws://%s:%d/api/v1/vms/%s/proxy?port=%d",
+		config.MedaHost, config.MedaPort, url.PathEscape(vmName), port)
+}
+
+// stepAPIProxy listens on a local port and tunnels every connection to
+// the VM's SSH port through the Meda API, for controllers without a route
+// to the VM network. The communicator connects to the local port.
+type stepAPIProxy struct {
+	listener net.Listener
+}
+
+func (s *stepAPIProxy) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	config := state.Get("config").(*Config)
+	ui := state.Get("ui").(packer.Ui)
+	vmName := state.Get("vm_name").(string)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		err := fmt.Errorf("failed to start SSH proxy listener: %s", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+	s.listener = listener
+
+	// StepConnect overwrites ssh_port with the local port, keep the guest's
+	target := apiProxyURL(config, vmName, config.Comm.SSHPort)
+	origin := fmt.Sprintf("http://%s:%d/", config.MedaHost, config.MedaPort)
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.relay(conn, target, origin)
+		}
+	}()
+
+	port := listener.Addr().(*net.TCPAddr).Port
+	ui.Say(fmt.Sprintf("Tunneling SSH through the Meda API (local port %d)", port))
+	state.Put("api_proxy_port", port)
+	return multistep.ActionContinue
+}
+
+// relay copies data between a local connection and a new tunnel until
+// either side closes
+func (s *stepAPIProxy) relay(conn net.Conn, target, origin string) {
+	defer conn.Close()
+
+	ws, err := websocket.Dial(target, "", origin)
+	if err != nil {
+		log.Printf("SSH proxy: failed to open tunnel %s: %s", target, err)
+		return
+	}
+	defer ws.Close()
+	ws.PayloadType = websocket.BinaryFrame
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(ws, conn)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(conn, ws)
+		done <- struct{}{}
+	}()
+	<-done
+}
+
+func (s *stepAPIProxy) Cleanup(state multistep.StateBag) {
+	if s.listener == nil {
+		return
+	}
+	s.listener.Close()
+}
@@ -0,0 +1,176 @@
+package meda
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/cirunlabs/packer-plugin-meda/driver"
+)
+
+// Artifact represents the result of a Meda build
+type Artifact struct {
+	ImageName   string
+	PushedImage string
+	// PushedImages are all pushed references, PushedImage first
+	PushedImages []string
+	Config       *Config
+	// Info holds image details from `meda inspect`, nil if unavailable
+	Info *driver.ImageInfo
+	// ObjectStorageURL is where the image disk was uploaded, if exported
+	ObjectStorageURL string
+	// OfflineOutput is the OCI layout tarball of the image, if written
+	OfflineOutput string
+	// ReplicatedTo are the Meda hosts the image was copied to
+	ReplicatedTo []string
+	// Checkpoints are the intermediate images captured during provisioning
+	Checkpoints []CheckpointImage
+	// BuildRecord is the referrer holding the build log and summary, if
+	// attached
+	BuildRecord string
+	// GeneratedData holds the build.<Name> values for post-processors
+	GeneratedData map[string]interface{}
+	// RunUUID identifies the `packer build` run that produced the image
+	RunUUID string
+}
+
+// BuilderId returns the ID of the builder that created this artifact
+func (a *Artifact) BuilderId() string {
+	return BuilderId
+}
+
+// Files returns the files represented by this artifact, so that the
+// checksum, compress and artifice post-processors can work on them
+func (a *Artifact) Files() []string {
+	// For Meda images, files are managed internally. Only the offline
+	// tarball lives outside of Meda; the object storage export is removed
+	// once it is uploaded.
+	if a.OfflineOutput != "" {
+		return []string{a.OfflineOutput}
+	}
+	return nil
+}
+
+// Id returns the unique identifier for this artifact:
+// <registry>/<organization>/<name>@<digest> once the image was pushed and
+// Meda reported a digest, otherwise <name>:<tag>+<run uuid>. name:tag alone
+// is reused by every build and would make tools like the manifest
+// post-processor mix up builds.
+func (a *Artifact) Id() string {
+	if a.PushedImage != "" && a.Info != nil && a.Info.Digest != "" {
+		repo := a.PushedImage
+		if i := strings.LastIndex(repo, ":"); i > strings.LastIndex(repo, "/") {
+			repo = repo[:i]
+		}
+		return repo + "@" + a.Info.Digest
+	}
+	if a.RunUUID != "" {
+		return a.ImageName + "+" + a.RunUUID
+	}
+	return a.ImageName
+}
+
+// String returns a human-readable representation of this artifact
+func (a *Artifact) String() string {
+	s := "Meda image: " + a.ImageName
+	if a.PushedImage != "" {
+		s += " (pushed to " + a.PushedImage + ")"
+	}
+	if a.ObjectStorageURL != "" {
+		s += "\nExported to " + a.ObjectStorageURL
+	}
+	if a.OfflineOutput != "" {
+		s += "\nOffline tarball: " + a.OfflineOutput
+	}
+	if len(a.ReplicatedTo) > 0 {
+		s += "\nReplicated to " + strings.Join(a.ReplicatedTo, ", ")
+	}
+	if a.BuildRecord != "" {
+		s += "\nBuild record: " + a.BuildRecord
+	}
+	for _, cp := range a.Checkpoints {
+		s += "\nCheckpoint " + cp.Name + ": " + cp.Image
+		if cp.Pushed != "" {
+			s += " (pushed to " + cp.Pushed + ")"
+		}
+	}
+	return s
+}
+
+// State returns the state data for this artifact
+func (a *Artifact) State(name string) interface{} {
+	switch name {
+	case "image_name":
+		return a.ImageName
+	case "pushed_image":
+		return a.PushedImage
+	case "pushed_images":
+		return a.PushedImages
+	case "registry":
+		return a.Config.Registry
+	case "organization":
+		return a.Config.Organization
+	case "run_uuid":
+		return a.RunUUID
+	case "object_storage_url":
+		return a.ObjectStorageURL
+	case "offline_output":
+		return a.OfflineOutput
+	case "replicated_to":
+		return a.ReplicatedTo
+	case "build_record":
+		return a.BuildRecord
+	case "generated_data":
+		return a.GeneratedData
+	case "checkpoint_images":
+		images := make(map[string]string, len(a.Checkpoints))
+		for _, cp := range a.Checkpoints {
+			images[cp.Name] = cp.Image
+		}
+		return images
+	case "checkpoint_pushed_images":
+		pushed := make(map[string]string)
+		for _, cp := range a.Checkpoints {
+			if cp.Pushed != "" {
+				pushed[cp.Name] = cp.Pushed
+			}
+		}
+		return pushed
+	}
+
+	if a.Info != nil {
+		switch name {
+		case "digest":
+			return a.Info.Digest
+		case "size_bytes":
+			return a.Info.SizeBytes
+		case "virtual_size":
+			return a.Info.VirtualSize
+		case "created_at":
+			return a.Info.CreatedAt
+		case "layer_digests":
+			return a.Info.LayerDigests()
+		}
+	}
+	return nil
+}
+
+// Destroy removes the artifact
+func (a *Artifact) Destroy() error {
+	driver := driver.NewDriver(a.Config.DriverConfig(), nil)
+	if err := driver.DeleteImage(a.ImageName); err != nil {
+		return fmt.Errorf("failed to destroy image %s: %w", a.ImageName, err)
+	}
+	for _, cp := range a.Checkpoints {
+		if err := driver.DeleteImage(cp.Image); err != nil {
+			return fmt.Errorf("failed to destroy checkpoint image %s: %w", cp.Image, err)
+		}
+	}
+	for _, f := range a.Files() {
+		if err := os.Remove(f); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to destroy %s: %w", f, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,69 @@
+package meda
+
+import (
+	"testing"
+
+	"github.com/cirunlabs/packer-plugin-meda/driver"
+)
+
+func TestArtifactId(t *testing.T) {
+	config := &Config{Registry: "ghcr.io", Organization: "cirunlabs", OutputImageName: "runner"}
+	info := &driver.ImageInfo{Digest: "sha256:abc123"}
+
+	tests := map[string]struct {
+		artifact Artifact
+		want     string
+	}{
+		"pushed with digest": {
+			Artifact{ImageName: "runner:v1", PushedImage: "ghcr.io/cirunlabs/runner:v1", Info: info, Config: config, RunUUID: "run-1"},
+			"ghcr.io/cirunlabs/runner@sha256:abc123",
+		},
+		"pushed to a registry with a port": {
+			Artifact{ImageName: "runner:v1", PushedImage: "localhost:5000/runner:v1", Info: info, Config: config, RunUUID: "run-1"},
+			"localhost:5000/runner@sha256:abc123",
+		},
+		"digest but not pushed": {
+			Artifact{ImageName: "runner:v1", Info: info, Config: config, RunUUID: "run-1"},
+			"runner:v1+run-1",
+		},
+		"pushed without digest": {
+			Artifact{ImageName: "runner:v1", PushedImage: "ghcr.io/cirunlabs/runner:v1", Config: config, RunUUID: "run-1"},
+			"runner:v1+run-1",
+		},
+		"no run uuid": {
+			Artifact{ImageName: "runner:v1", Config: config},
+			"runner:v1",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := tt.artifact.Id(); got != tt.want {
+				t.Errorf("Id() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// The manifest post-processor records builder_type, artifact_id and files
+// per build and relies on artifact_id to tell builds of the same image apart
+func TestArtifactId_manifestCompatible(t *testing.T) {
+	config := &Config{OutputImageName: "runner"}
+	first := &Artifact{ImageName: "runner:latest", Config: config, RunUUID: "run-1"}
+	second := &Artifact{ImageName: "runner:latest", Config: config, RunUUID: "run-2"}
+
+	if first.Id() == second.Id() {
+		t.Errorf("builds of the same image share artifact id %q", first.Id())
+	}
+	if first.BuilderId() != BuilderId {
+		t.Errorf("BuilderId() = %q, want %q", first.BuilderId(), BuilderId)
+	}
+	if files := first.Files(); files != nil {
+		t.Errorf("Files() = %v, want none without offline_output", files)
+	}
+
+	first.OfflineOutput = "runner.tar"
+	if files := first.Files(); len(files) != 1 || files[0] != "runner.tar" {
+		t.Errorf("Files() = %v, want [runner.tar]", files)
+	}
+}
@@ -0,0 +1,90 @@
+package meda
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// buildDir is the scratch directory of one build,
+// $PACKER_CACHE_DIR/meda/<run-uuid>/<build id>. It collects the generated user-data,
+// Ignition config and SSH key plus a log of the build output. It is
+// removed after a successful build and kept after a failure.
+type buildDir struct {
+	path string
+	log  *os.File
+}
+
+// newBuildDir creates the scratch directory of the build id of the run
+// runID. Builds of one run share the run directory.
+func newBuildDir(runID, id string) (*buildDir, error) {
+	path, err := packer.CachePath("meda", runID, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve build directory: %s", err)
+	}
+	if err := os.MkdirAll(path, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create build directory: %s", err)
+	}
+	f, err := os.OpenFile(filepath.Join(path, "build.log"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create build log: %s", err)
+	}
+	return &buildDir{path: path, log: f}, nil
+}
+
+// finish keeps the directory when the build failed and removes it
+// otherwise
+func (d *buildDir) finish(ui packer.Ui, state multistep.StateBag) {
+	_, failed := state.GetOk("error")
+	_, cancelled := state.GetOk(multistep.StateCancelled)
+	_, halted := state.GetOk(multistep.StateHalted)
+	if failed || cancelled || halted {
+		ui.Say("Build files kept for debugging in " + d.path)
+		d.log.Close()
+		return
+	}
+	d.log.Close()
+	if err := os.RemoveAll(d.path); err != nil {
+		log.Printf("Failed to remove build directory: %s", err)
+	}
+	// The last build of the run removes the run directory
+	os.Remove(filepath.Dir(d.path))
+}
+
+// buildLogUi copies the build output to build.log in the build directory
+type buildLogUi struct {
+	packer.Ui
+	log *os.File
+
+	mu sync.Mutex
+}
+
+func (u *buildLogUi) write(level, message string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	line := fmt.Sprintf("%s %s %s\n", time.Now().UTC().Format(time.RFC3339), level, packer.LogSecretFilter.FilterString(message))
+	if _, err := u.log.WriteString(line); err != nil {
+		log.Printf("Failed to write build log: %s", err)
+	}
+}
+
+func (u *buildLogUi) Say(message string) {
+	u.write("say", message)
+	u.Ui.Say(message)
+}
+
+func (u *buildLogUi) Message(message string) {
+	u.write("message", message)
+	u.Ui.Message(message)
+}
+
+func (u *buildLogUi) Error(message string) {
+	u.write("error", message)
+	u.Ui.Error(message)
+}
@@ -0,0 +1,322 @@
+package meda
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// Media types of the build record attached to pushed images
+const (
+	buildRecordArtifactType = "application/vnd.cirunlabs.meda.build-record.v1"
+	buildLogMediaType       = "text/plain"
+	buildSummaryMediaType   = "application/vnd.cirunlabs.meda.build-summary.v1+json"
+
+	ociManifestMediaType = "application/vnd.oci.image.manifest.v1+json"
+	ociIndexMediaType    = "application/vnd.oci.image.index.v1+json"
+	ociEmptyMediaType    = "application/vnd.oci.empty.v1+json"
+)
+
+// ociDescriptor references a blob or manifest
+type ociDescriptor struct {
+	MediaType    string            `json:"mediaType"`
+	Digest       string            `json:"digest"`
+	Size         int64             `json:"size"`
+	ArtifactType string            `json:"artifactType,omitempty"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+}
+
+// ociManifest is an OCI image manifest, used for artifacts with a subject
+type ociManifest struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType"`
+	ArtifactType  string            `json:"artifactType,omitempty"`
+	Config        ociDescriptor     `json:"config"`
+	Layers        []ociDescriptor   `json:"layers"`
+	Subject       *ociDescriptor    `json:"subject,omitempty"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+// ociIndex is an OCI image index, used for the referrers tag of
+// registries without the referrers API
+type ociIndex struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	MediaType     string          `json:"mediaType"`
+	Manifests     []ociDescriptor `json:"manifests"`
+}
+
+// buildSummary is the JSON document attached next to the build log
+type buildSummary struct {
+	Builder          string   `json:"builder"`
+	BuilderVersion   string   `json:"builder_version"`
+	PackerVersion    string   `json:"packer_version,omitempty"`
+	BuildName        string   `json:"build_name,omitempty"`
+	RunUUID          string   `json:"run_uuid"`
+	Started          string   `json:"started"`
+	Attached         string   `json:"attached"`
+	BaseImage        string   `json:"base_image"`
+	SourceVM         string   `json:"source_vm,omitempty"`
+	Image            string   `json:"image"`
+	Digest           string   `json:"digest"`
+	PushedImages     []string `json:"pushed_images"`
+	ProvisionersHash string   `json:"provisioners_sha256,omitempty"`
+}
+
+func sha256Digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// resolveManifest returns the descriptor of the manifest ref, a tag or
+// digest, of repo on host
+func (c *registryClient) resolveManifest(host, repo, ref string) (ociDescriptor, error) {
+	resp, err := c.do("GET", "https://"+host+"/v2/"+repo+"/manifests/"+ref, repo)
+	if err != nil {
+		return ociDescriptor{}, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return ociDescriptor{}, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return ociDescriptor{}, fmt.Errorf("failed to resolve %s/%s:%s: %s", host, repo, ref, resp.Status)
+	}
+	mediaType, _, _ := strings.Cut(resp.Header.Get("Content-Type"), ";")
+	return ociDescriptor{MediaType: mediaType, Digest: sha256Digest(body), Size: int64(len(body))}, nil
+}
+
+// pushBlob uploads data to repo on host unless the registry has it
+// already
+func (c *registryClient) pushBlob(host, repo, mediaType string, data []byte) (ociDescriptor, error) {
+	desc := ociDescriptor{MediaType: mediaType, Digest: sha256Digest(data), Size: int64(len(data))}
+	base := "https://" + host + "/v2/" + repo + "/blobs/"
+
+	resp, err := c.do("HEAD", base+desc.Digest, repo)
+	if err != nil {
+		return desc, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return desc, nil
+	}
+
+	resp, err = c.do("POST", base+"uploads/", repo)
+	if err != nil {
+		return desc, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		return desc, fmt.Errorf("failed to start blob upload: %s", resp.Status)
+	}
+	location, err := resp.Request.URL.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		return desc, fmt.Errorf("invalid blob upload location: %s", err)
+	}
+	query := location.Query()
+	query.Set("digest", desc.Digest)
+	location.RawQuery = query.Encode()
+
+	resp, err = c.doBody("PUT", location.String(), repo, "application/octet-stream", data)
+	if err != nil {
+		return desc, err
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return desc, fmt.Errorf("failed to upload blob: %s - %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return desc, nil
+}
+
+// putManifest stores manifest under ref. It reports whether the registry
+// processed the subject, i.e. serves the referrers API.
+func (c *registryClient) putManifest(host, repo, ref, mediaType string, manifest []byte) (bool, error) {
+	resp, err := c.doBody("PUT", "https://"+host+"/v2/"+repo+"/manifests/"+ref, repo, mediaType, manifest)
+	if err != nil {
+		return false, err
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return false, fmt.Errorf("failed to store manifest: %s - %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return resp.Header.Get("OCI-Subject") != "", nil
+}
+
+// addReferrer adds referrer to the referrers tag sha256-<hex> of subject,
+// the fallback of the OCI distribution spec for registries without the
+// referrers API
+func (c *registryClient) addReferrer(host, repo, subject string, referrer ociDescriptor) error {
+	tag := strings.Replace(subject, ":", "-", 1)
+	index := ociIndex{SchemaVersion: 2, MediaType: ociIndexMediaType}
+
+	resp, err := c.do("GET", "https://"+host+"/v2/"+repo+"/manifests/"+tag, repo)
+	if err != nil {
+		return err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	switch {
+	case err != nil:
+		return err
+	case resp.StatusCode == http.StatusOK:
+		if err := json.Unmarshal(body, &index); err != nil {
+			return fmt.Errorf("failed to parse referrers tag %s: %s", tag, err)
+		}
+	case resp.StatusCode != http.StatusNotFound:
+		return fmt.Errorf("failed to read referrers tag %s: %s", tag, resp.Status)
+	}
+
+	index.Manifests = append(index.Manifests, referrer)
+	data, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	_, err = c.putManifest(host, repo, tag, ociIndexMediaType, data)
+	return err
+}
+
+// attachBuildRecord pushes buildLog and summary as an artifact referring
+// to the manifest subject of repo on host and returns its digest
+func (c *registryClient) attachBuildRecord(host, repo string, subject ociDescriptor, buildLog, summary []byte, created time.Time) (string, error) {
+	config, err := c.pushBlob(host, repo, ociEmptyMediaType, []byte("{}"))
+	if err != nil {
+		return "", err
+	}
+	logDesc, err := c.pushBlob(host, repo, buildLogMediaType, buildLog)
+	if err != nil {
+		return "", err
+	}
+	logDesc.Annotations = map[string]string{"org.opencontainers.image.title": "build.log"}
+	summaryDesc, err := c.pushBlob(host, repo, buildSummaryMediaType, summary)
+	if err != nil {
+		return "", err
+	}
+	summaryDesc.Annotations = map[string]string{"org.opencontainers.image.title": "summary.json"}
+
+	annotations := map[string]string{"org.opencontainers.image.created": created.UTC().Format(time.RFC3339)}
+	manifest, err := json.Marshal(ociManifest{
+		SchemaVersion: 2,
+		MediaType:     ociManifestMediaType,
+		ArtifactType:  buildRecordArtifactType,
+		Config:        config,
+		Layers:        []ociDescriptor{logDesc, summaryDesc},
+		Subject:       &subject,
+		Annotations:   annotations,
+	})
+	if err != nil {
+		return "", err
+	}
+	digest := sha256Digest(manifest)
+
+	supported, err := c.putManifest(host, repo, digest, ociManifestMediaType, manifest)
+	if err != nil {
+		return "", err
+	}
+	if !supported {
+		err := c.addReferrer(host, repo, subject.Digest, ociDescriptor{
+			MediaType:    ociManifestMediaType,
+			Digest:       digest,
+			Size:         int64(len(manifest)),
+			ArtifactType: buildRecordArtifactType,
+			Annotations:  annotations,
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to update referrers tag: %s", err)
+		}
+	}
+	return digest, nil
+}
+
+// stepAttachBuildRecord attaches the build log and a summary of the build
+// to the pushed image as an OCI referrer, so the registry records how
+// every image was produced
+type stepAttachBuildRecord struct{}
+
+func (s *stepAttachBuildRecord) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	config := state.Get("config").(*Config)
+	ui := state.Get("ui").(packer.Ui)
+
+	pushed, ok := state.GetOk("pushed_images")
+	if !ok {
+		return multistep.ActionContinue
+	}
+
+	halt := func(err error) multistep.StepAction {
+		err = fmt.Errorf("failed to attach build record: %s", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	host, repo, _ := strings.Cut(config.registryRepository(), "/")
+	ui.Say(fmt.Sprintf("Attaching the build log to %s/%s:%s", host, repo, config.OutputTag))
+
+	buildLog, err := os.ReadFile(filepath.Join(state.Get("build_dir").(string), "build.log"))
+	if err != nil {
+		return halt(err)
+	}
+	// Secrets can be registered after they were first logged
+	buildLog = []byte(packer.LogSecretFilter.FilterString(string(buildLog)))
+
+	now := time.Now()
+	summary := buildSummary{
+		Builder:        "packer-plugin-meda",
+		BuilderVersion: builderVersion(),
+		PackerVersion:  config.PackerCoreVersion,
+		BuildName:      config.PackerBuildName,
+		RunUUID:        state.Get("run_uuid").(string),
+		Started:        state.Get("build_started").(time.Time).UTC().Format(time.RFC3339),
+		Attached:       now.UTC().Format(time.RFC3339),
+		BaseImage:      config.BaseImage,
+		SourceVM:       config.SourceVM,
+		Image:          state.Get("image_name").(string),
+		PushedImages:   pushed.([]string),
+	}
+	if digest, ok := state.GetOk("provisioner_digest"); ok {
+		summary.ProvisionersHash = digest.(*provisionerDigest).sum()
+	}
+
+	client, err := newPushRegistryClient(config)
+	if err != nil {
+		return halt(err)
+	}
+	client.actions = "pull,push"
+
+	var digest string
+	err = retryRegistry(ctx, ui, config.RegistryRetryBudget, "attaching the build log", func() error {
+		subject, err := client.resolveManifest(host, repo, config.OutputTag)
+		if err != nil {
+			return err
+		}
+		summary.Digest = subject.Digest
+		data, err := json.MarshalIndent(summary, "", "  ")
+		if err != nil {
+			return err
+		}
+		digest, err = client.attachBuildRecord(host, repo, subject, buildLog, append(data, '\n'), now)
+		return err
+	})
+	if err != nil {
+		return halt(err)
+	}
+
+	reference := fmt.Sprintf("%s/%s@%s", host, repo, digest)
+	state.Put("build_record", reference)
+	ui.Say("Build log attached as " + reference)
+	return multistep.ActionContinue
+}
+
+func (s *stepAttachBuildRecord) Cleanup(state multistep.StateBag) {}
@@ -0,0 +1,324 @@
+// Package meda implements the meda-vm builder and the other components of
+// the plugin: the meda-vms data source, the meda-exec and meda-checkpoint
+// provisioners and the cloud-import and prune post-processors. Builder, Config and Artifact can
+// be used from other programs the way Packer uses them.
+package meda
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/cirunlabs/packer-plugin-meda/driver"
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/hashicorp/packer-plugin-sdk/communicator"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/multistep/commonsteps"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+const BuilderId = "meda.vm"
+
+type Builder struct {
+	config Config
+	runner multistep.Runner
+}
+
+func (b *Builder) ConfigSpec() hcldec.ObjectSpec {
+	return b.config.ConfigSpec()
+}
+
+func (b *Builder) Prepare(raws ...interface{}) (generatedVars []string, warnings []string, err error) {
+	err = b.config.Prepare(raws...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return b.GeneratedVars(), nil, nil
+}
+
+func (b *Builder) Run(ctx context.Context, ui packer.Ui, hook packer.Hook) (packer.Artifact, error) {
+	// Annotate errors and warnings in GitHub Actions workflow logs
+	if inGitHubActions() {
+		ui = &githubActionsUi{Ui: ui}
+	}
+
+	// Collect the generated files and the build output in one place
+	runID := runUUID()
+	dir, err := newBuildDir(runID, buildID(runID, b.config.PackerBuildName))
+	if err != nil {
+		return nil, err
+	}
+	ui = &buildLogUi{Ui: ui, log: dir.log}
+	ui.Say("Build files are collected in " + dir.path)
+
+	// Track UI activity so long silent steps can emit heartbeats
+	ui = newActivityUi(ui)
+
+	// Set up the state
+	state := new(multistep.BasicStateBag)
+	state.Put("config", &b.config)
+	state.Put("hook", hook)
+	state.Put("ui", ui)
+	resetDriver(state)
+	state.Put("build_dir", dir.path)
+	defer dir.finish(ui, state)
+
+	// Generate a VM name unique across runs and parallel builds
+	started := time.Now()
+	vmName := buildVMName(b.config.VMName, buildID(runID, b.config.PackerBuildName), started)
+	state.Put("build_started", started)
+	state.Put("run_uuid", runID)
+	state.Put("vm_name", vmName)
+	state.Put("instance_id", vmName)
+
+	// Values exposed to provisioners as build.<Name>; the IP and SSH user
+	// are filled in once the VM has booted
+	state.Put("communicator_config", &b.config.Comm)
+	state.Put("generated_data", map[string]interface{}{
+		"MedaVMName":            vmName,
+		"MedaBaseImage":         b.config.BaseImage,
+		"MedaVMIP":              "",
+		"MedaSSHUsername":       b.config.Comm.SSHUsername,
+		"MedaSSHPrivateKeyFile": "",
+		"MedaInventoryFile":     "",
+		"MedaServiceHosts":      "",
+		"MedaImageName":         "",
+		"MedaImageDigest":       "",
+		"MedaPushedImage":       "",
+	})
+
+	sendWebhooks(ctx, state, "build.started", nil)
+
+	// mock_mode simulates Meda and the guest, and skips what would leave
+	// the host
+	mock := b.config.MockMode
+	if mock {
+		ui.Say("Mock mode: Meda is simulated, no VM is created")
+	}
+
+	// Build the steps
+	steps := []multistep.Step{
+		// Start a private meda API server if requested
+		multistep.If(b.config.ManageMedaServer && !mock, &stepStartMedaServer{}),
+
+		// Pick the least loaded or next server of the meda_hosts pool
+		multistep.If(len(b.config.MedaHosts) > 0 && !mock, &stepSelectMedaHost{}),
+
+		// Make sure Meda is reachable before touching anything
+		&stepCheckDriver{},
+
+		// Fail early when the API server is too old for the build
+		multistep.If(b.config.UseAPI.True() && !b.config.SkipAPIVersionCheck && !mock, &stepCheckAPIVersion{}),
+
+		// Secrets from Vault are needed from boot to push
+		multistep.If(b.config.VaultAuth != nil && !mock, &stepVaultSecrets{}),
+
+		// Fail on a bad registry token before the long part of the build
+		multistep.If(b.config.PushToRegistry && !b.config.DryRun && !b.config.SkipRegistryPreflight && !mock, &stepRegistryPreflight{}),
+
+		// Remove VMs left behind by crashed builds (opt-in)
+		multistep.If(b.config.CleanupOrphans, &stepCleanupOrphans{}),
+
+		multistep.If(b.config.SourceVM == "", withHeartbeat("base image", &stepCreateBaseImage{})),
+		multistep.If(b.config.SourceVM != "", withHeartbeat("cloning source VM", &stepCloneSourceVM{})),
+		multistep.If(len(b.config.Services) > 0 && !mock, withHeartbeat("starting services", &stepStartServices{})),
+		multistep.If(b.config.TemporarySSHUser, &stepTemporarySSHUser{}),
+		multistep.If(b.config.SSHTemporaryKeyPath != "", &stepSSHKeyCache{}),
+		multistep.If(!b.config.usesIgnition(), &stepUserData{}),
+		multistep.If(b.config.usesIgnition(), &stepIgnition{}),
+		&stepCreateVM{},
+		withHeartbeat("starting VM", &stepStartVM{}),
+		// Without a communicator nothing needs the IP, and the VM may power
+		// itself off before it has one
+		// The serial console needs no network, hardened guests may have none
+		multistep.If(!b.config.waitsForPowerOff() && b.config.Comm.Type != "serial" && !mock,
+			withHeartbeat("waiting for VM boot", &stepWaitForVM{})),
+		multistep.If(b.config.waitsForPowerOff() && !mock, withHeartbeat("waiting for cloud-init", &stepWaitForPowerOff{})),
+
+		// SSH Key Generation (conditional - only if using key pair auth)
+		multistep.If(b.config.Comm.Type == "ssh" && b.config.Comm.SSHPrivateKeyFile == "" && b.config.Comm.SSHPassword == "" && !b.config.TemporarySSHUser &&
+			b.config.SSHTemporaryKeyPath == "" &&
+			(b.config.VaultAuth == nil || b.config.VaultAuth.SSHPrivateKey == ""),
+			&communicator.StepSSHKeyGen{
+				CommConf: &b.config.Comm,
+			}),
+
+		// Local end of the SSH tunnel through the Meda API
+		multistep.If(b.config.SSHViaAPI && !mock, &stepAPIProxy{}),
+
+		// SSH Connection
+		multistep.If(mock, &stepMockVM{}),
+		multistep.If(b.config.Comm.Type == "serial" && !mock, &stepConnectSerial{}),
+		multistep.If(b.config.Comm.Type != "serial" && !mock, &stepSSHAuthDiagnostics{Step: newStepConnect(&b.config)}),
+		multistep.If(b.config.Comm.Type == "ssh" && !mock, &stepVerifySSHAuth{}),
+
+		// Checkpoints and pauses restart the VM, the connection is
+		// re-established underneath the wrappers below
+		multistep.If(b.config.restartsDuringProvisioning() && !mock, &stepRestartableConnection{}),
+
+		// Survive dropped connections, e.g. when the guest restarts sshd
+		multistep.If(b.config.Comm.Type == "ssh" && !b.config.DisableSSHReconnect &&
+			b.config.Comm.SSHBastionHost == "" && b.config.Comm.SSHProxyHost == "" && !mock,
+			&stepReconnectingCommunicator{}),
+		multistep.If(b.config.Comm.Type == "ssh" && b.config.FileTransferFallback != "never" && !mock, &stepExecTransferFallback{}),
+
+		// Let cloud-init finish before anything else touches the guest
+		multistep.If(!b.config.SkipCloudInitWait && (b.config.Comm.Type == "ssh" || b.config.Comm.Type == "serial") && !b.config.usesIgnition(),
+			withHeartbeat("waiting for cloud-init", &stepWaitForCloudInit{})),
+		multistep.If(!b.config.SkipGrowRootFS && (b.config.Comm.Type == "ssh" || b.config.Comm.Type == "serial") && !mock, &stepGrowRootFS{}),
+		multistep.If(b.config.waitsForGuestReady(), withHeartbeat("waiting for guest readiness", &stepWaitForGuestReady{})),
+
+		// Replace the default password for the rest of the session
+		multistep.If(b.config.RotateCredentials, &stepRotateCredentials{}),
+
+		// Key file and inventory for the ansible provisioner
+		multistep.If(b.config.Comm.Type == "ssh", &stepAnsibleHandoff{}),
+
+		multistep.If(b.config.DiffReportFile != "", &stepCollectManifest{key: "manifest_before"}),
+		multistep.If(len(b.config.Packages) > 0, withHeartbeat("installing packages", &stepInstallPackages{})),
+
+		// Provisioning, capturing checkpoint images and switching users on
+		// request
+		multistep.If(len(b.config.ProvisionStages) > 0 && !mock, &stepProvisionStages{}),
+		multistep.If(b.config.writesImageInfo(), &stepDigestProvisioners{}),
+		multistep.If(len(b.config.Checkpoints) > 0 || b.config.StopAtCheckpoints, &stepCheckpoints{}),
+		&commonsteps.StepProvision{},
+		multistep.If(len(b.config.ProvisionStages) > 0 && !mock, &stepFinishProvisionStages{}),
+		multistep.If(len(b.config.Checkpoints) > 0 || b.config.StopAtCheckpoints, &stepFinishCheckpoints{}),
+
+		multistep.If(len(b.config.FirstBootScripts) > 0, &stepInstallFirstBootScripts{}),
+		multistep.If(b.config.Scan != nil && b.config.Scan.Enabled && !mock, withHeartbeat("scanning", &stepScan{})),
+		multistep.If(b.config.DiffReportFile != "", &stepCollectManifest{key: "manifest_after"}),
+		multistep.If(b.config.writesImageInfo(), &stepWriteImageInfo{}),
+		multistep.If(b.config.RotateCredentials || b.config.TemporarySSHUser, &stepSealCredentials{}),
+		multistep.If(b.config.CaptureMode == "stop", &stepStopVM{}),
+		multistep.If(b.config.resizeBeforeCapture(), &stepResizeVM{}),
+		withHeartbeat("creating image", &stepCreateImage{}),
+		multistep.If(len(b.config.Webhooks) > 0, &stepWebhook{event: "image.created", key: "image_name"}),
+		multistep.If(b.config.DiffReportFile != "", &stepWriteDiffReport{}),
+		withHeartbeat("pushing image", &stepPushImage{}),
+		multistep.If(b.config.AttachBuildRecord && !b.config.DryRun && !mock, &stepAttachBuildRecord{}),
+		multistep.If(len(b.config.Webhooks) > 0, &stepWebhook{event: "image.pushed", key: "pushed_image"}),
+		multistep.If(b.config.Cirun != nil && !b.config.DryRun && !mock, &stepCirunRegister{}),
+		multistep.If(b.config.OfflineOutput != "" && !mock, withHeartbeat("exporting offline image", &stepExportOffline{})),
+		multistep.If(len(b.config.ReplicateTo) > 0, withHeartbeat("replicating image", &stepReplicateImage{})),
+		multistep.If(len(b.config.Checkpoints) > 0, withHeartbeat("checkpoint retention", &stepCheckpointRetention{})),
+		multistep.If(b.config.ObjectStorageExport != nil && !mock, withHeartbeat("exporting image", &stepExportObjectStorage{})),
+		multistep.If(b.config.TfvarsOutput != "", &stepWriteTfvars{}),
+		&stepCleanupVM{},
+	}
+
+	// Setup the state bag and initial state for the steps
+	b.runner = commonsteps.NewRunner(withEvents(steps), b.config.PackerConfig, ui)
+	b.runner.Run(ctx, state)
+
+	// If there was an error, return that
+	if rawErr, ok := state.GetOk("error"); ok {
+		if inGitHubActions() {
+			reportGitHubFailure(rawErr.(error))
+		}
+		sendWebhooks(ctx, state, "build.failed", rawErr.(error))
+		return nil, rawErr.(error)
+	}
+
+	// If we were interrupted or cancelled, then just exit.
+	if _, ok := state.GetOk(multistep.StateCancelled); ok {
+		err := fmt.Errorf("build was cancelled")
+		sendWebhooks(ctx, state, "build.failed", err)
+		return nil, err
+	}
+
+	if _, ok := state.GetOk(multistep.StateHalted); ok {
+		err := fmt.Errorf("build was halted")
+		sendWebhooks(ctx, state, "build.failed", err)
+		return nil, err
+	}
+
+	// Get the image name from state
+	imageName, ok := state.GetOk("image_name")
+	if !ok {
+		return nil, fmt.Errorf("failed to get image name from state")
+	}
+
+	// Get the pushed image name if it exists
+	pushedImage, _ := state.GetOk("pushed_image")
+	var pushedImageStr string
+	if pushedImage != nil {
+		pushedImageStr = pushedImage.(string)
+	}
+
+	artifact := &Artifact{
+		ImageName:   imageName.(string),
+		PushedImage: pushedImageStr,
+		Config:      &b.config,
+		RunUUID:     runID,
+	}
+
+	if pushed, ok := state.GetOk("pushed_images"); ok {
+		artifact.PushedImages = pushed.([]string)
+	}
+	if info, ok := state.GetOk("image_info"); ok {
+		artifact.Info = info.(*driver.ImageInfo)
+	}
+	if url, ok := state.GetOk("object_storage_url"); ok {
+		artifact.ObjectStorageURL = url.(string)
+	}
+	if path, ok := state.GetOk("offline_output"); ok {
+		artifact.OfflineOutput = path.(string)
+	}
+	if hosts, ok := state.GetOk("replicated_to"); ok {
+		artifact.ReplicatedTo = hosts.([]string)
+	}
+	if record, ok := state.GetOk("build_record"); ok {
+		artifact.BuildRecord = record.(string)
+	}
+	if checkpoints, ok := state.GetOk("checkpoint_images"); ok {
+		artifact.Checkpoints = checkpoints.([]CheckpointImage)
+	}
+
+	// Post-processors read build.<Name> from the artifact. The provision
+	// step filled in the standard values, the image ones follow here.
+	generatedData := state.Get("generated_data").(map[string]interface{})
+	generatedData["MedaImageName"] = artifact.ImageName
+	generatedData["MedaPushedImage"] = artifact.PushedImage
+	if artifact.Info != nil {
+		generatedData["MedaImageDigest"] = artifact.Info.Digest
+	}
+	artifact.GeneratedData = generatedData
+
+	reportArtifactEvents(ui, artifact)
+	if inGitHubActions() {
+		reportGitHubSuccess(artifact)
+	}
+	sendWebhooks(ctx, state, "build.finished", nil)
+
+	return artifact, nil
+}
+
+// resetDriver puts a driver built from the current config into state and
+// returns it. Drivers copy the config when they are built, steps that
+// change the Meda host, port or environment call this so the following
+// steps use the new settings.
+func resetDriver(state multistep.StateBag) driver.MedaDriver {
+	config := state.Get("config").(*Config)
+	d := driver.NewDriver(config.DriverConfig(), state.Get("ui").(packer.Ui))
+	state.Put("driver", d)
+	return d
+}
+
+// GeneratedVars returns a list of variables that this builder generates
+func (b *Builder) GeneratedVars() []string {
+	return []string{
+		"MedaVMName",
+		"MedaVMIP",
+		"MedaBaseImage",
+		"MedaSSHUsername",
+		"MedaSSHPrivateKeyFile",
+		"MedaInventoryFile",
+		"MedaServiceHosts",
+		"MedaImageName",
+		"MedaImageDigest",
+		"MedaPushedImage",
+	}
+}
@@ -0,0 +1,43 @@
+package meda
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/cirunlabs/packer-plugin-meda/driver"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// captureImage creates the image name:tag from the build VM according to
+// capture_mode. With stop the VM must already be stopped. With
+// live-snapshot the guest's buffers are flushed through comm, if there is
+// one, and the image is created from a snapshot of the running VM's disk.
+func captureImage(ctx context.Context, state multistep.StateBag, comm packer.Communicator, name, tag string) error {
+	config := state.Get("config").(*Config)
+	driver := state.Get("driver").(driver.MedaDriver)
+	vmName := state.Get("vm_name").(string)
+
+	if config.CaptureMode != "live-snapshot" {
+		return driver.CreateImageFromVM(vmName, name, tag, imageLabels(state))
+	}
+
+	if comm != nil {
+		if _, err := runRemote(ctx, comm, "sync"); err != nil {
+			log.Printf("Failed to sync guest filesystems: %s", err)
+		}
+	}
+
+	snapshot := "packer-" + tag
+	if err := driver.SnapshotVM(vmName, snapshot); err != nil {
+		return fmt.Errorf("failed to snapshot VM: %s", err)
+	}
+	defer func() {
+		if err := driver.DeleteSnapshot(vmName, snapshot); err != nil {
+			log.Printf("Failed to delete snapshot %s of VM %s: %s", snapshot, vmName, err)
+		}
+	}()
+
+	return driver.CreateImageFromSnapshot(vmName, snapshot, name, tag, imageLabels(state))
+}
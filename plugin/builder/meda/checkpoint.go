@@ -0,0 +1,376 @@
+package meda
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/cirunlabs/packer-plugin-meda/driver"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/multistep/commonsteps"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// checkpointCommand is the command the meda-checkpoint provisioner starts
+// through the communicator to request a checkpoint. The checkpoint
+// communicator answers it in the builder, it never reaches the guest.
+const checkpointCommand = "meda-checkpoint"
+
+var checkpointNamePattern = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// Checkpoint captures an intermediate image while provisioning is still
+// running
+type Checkpoint struct {
+	// Name identifies the checkpoint. The meda-checkpoint provisioner with
+	// this name captures it.
+	Name string `mapstructure:"name" required:"true"`
+	// OutputTag is the tag of the captured image. Defaults to
+	// <output_tag>-<name>.
+	OutputTag string `mapstructure:"output_tag"`
+	// Retention overrides checkpoint_retention for this checkpoint
+	Retention string `mapstructure:"retention"`
+}
+
+// CheckpointImage is an image captured at a checkpoint
+type CheckpointImage struct {
+	Name  string
+	Image string
+	Tag   string
+	// Pushed is the registry reference when the image was pushed
+	Pushed string
+}
+
+// checkpointRequest returns the checkpoint name of a command started by
+// the meda-checkpoint provisioner, empty for a pause
+func checkpointRequest(command string) (string, bool) {
+	fields := strings.Fields(command)
+	if len(fields) == 0 || len(fields) > 2 || fields[0] != checkpointCommand {
+		return "", false
+	}
+	if len(fields) == 1 {
+		// A pause without a checkpoint
+		return "", true
+	}
+	return fields[1], true
+}
+
+// checkpointCommunicator wraps the build communicator and captures the
+// checkpoints requested by meda-checkpoint provisioners. Packer runs all
+// provisioners in one go, so the provisioner placed after another one is
+// the only hook the builder gets between them.
+type checkpointCommunicator struct {
+	packer.Communicator
+
+	state multistep.StateBag
+
+	mu      sync.Mutex
+	pending map[string]Checkpoint
+}
+
+func newCheckpointCommunicator(comm packer.Communicator, state multistep.StateBag, checkpoints []Checkpoint) *checkpointCommunicator {
+	pending := make(map[string]Checkpoint, len(checkpoints))
+	for _, cp := range checkpoints {
+		pending[cp.Name] = cp
+	}
+	return &checkpointCommunicator{Communicator: comm, state: state, pending: pending}
+}
+
+func (c *checkpointCommunicator) Start(ctx context.Context, cmd *packer.RemoteCmd) error {
+	name, ok := checkpointRequest(cmd.Command)
+	if !ok {
+		return c.Communicator.Start(ctx, cmd)
+	}
+
+	// The provisioner waits for the exit status while the VM restarts
+	go func() {
+		if err := c.checkpoint(ctx, name); err != nil {
+			if cmd.Stderr != nil {
+				fmt.Fprintln(cmd.Stderr, err.Error())
+			}
+			cmd.SetExited(1)
+			return
+		}
+		cmd.SetExited(0)
+	}()
+	return nil
+}
+
+// checkpoint captures the pending checkpoint name. With
+// stop_at_checkpoints the build then waits with the VM stopped, a
+// request without a name only pauses.
+func (c *checkpointCommunicator) checkpoint(ctx context.Context, name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	config := c.state.Get("config").(*Config)
+	driver := c.state.Get("driver").(driver.MedaDriver)
+	vmName := c.state.Get("vm_name").(string)
+
+	var cp *Checkpoint
+	if name != "" {
+		checkpoint, ok := c.pending[name]
+		if !ok {
+			return fmt.Errorf("checkpoint %q is not defined or was already captured", name)
+		}
+		cp = &checkpoint
+	} else if !config.StopAtCheckpoints {
+		return fmt.Errorf("meda-checkpoint without a name pauses the build and requires stop_at_checkpoints = true")
+	}
+
+	// A live snapshot leaves the VM running
+	stop := config.CaptureMode == "stop"
+	if stop {
+		if _, err := runRemote(ctx, c.Communicator, "sync"); err != nil {
+			log.Printf("Failed to sync guest filesystems: %s", err)
+		}
+		if err := driver.StopVM(vmName); err != nil {
+			return fmt.Errorf("failed to stop VM: %s", err)
+		}
+	}
+	if cp != nil {
+		if err := c.capture(ctx, *cp); err != nil {
+			return fmt.Errorf("failed to capture checkpoint %s: %s", cp.Name, err)
+		}
+		delete(c.pending, name)
+	}
+	if config.StopAtCheckpoints {
+		if err := waitForResume(c.state, name); err != nil {
+			return err
+		}
+	}
+	if stop {
+		return restartVM(ctx, c.state)
+	}
+	return nil
+}
+
+// capture creates the image of checkpoint cp
+func (c *checkpointCommunicator) capture(ctx context.Context, cp Checkpoint) error {
+	config := c.state.Get("config").(*Config)
+	ui := c.state.Get("ui").(packer.Ui)
+
+	image := config.OutputImageName + ":" + cp.OutputTag
+	ui.Say(fmt.Sprintf("Capturing checkpoint '%s' as '%s'", cp.Name, image))
+
+	if err := captureImage(ctx, c.state, c.Communicator, config.OutputImageName, cp.OutputTag); err != nil {
+		return fmt.Errorf("failed to create image: %s", err)
+	}
+
+	images, _ := c.state.GetOk("checkpoint_images")
+	captured, _ := images.([]CheckpointImage)
+	c.state.Put("checkpoint_images", append(captured, CheckpointImage{Name: cp.Name, Image: image, Tag: cp.OutputTag}))
+
+	ui.Say(fmt.Sprintf("Checkpoint '%s' captured", cp.Name))
+	return nil
+}
+
+// waitForResume pauses the build with the VM stopped until enter is
+// pressed, the way packer build -debug pauses between steps
+func waitForResume(state multistep.StateBag, name string) error {
+	ui := state.Get("ui").(packer.Ui)
+
+	ui.Say("The VM is stopped, the host can be maintained now")
+	commonsteps.MultistepDebugFn(ui)(multistep.DebugLocationAfterRun, strings.TrimSpace(checkpointCommand+" "+name), state)
+	if _, ok := state.GetOk(multistep.StateCancelled); ok {
+		return fmt.Errorf("build was cancelled while paused")
+	}
+	ui.Say("Starting the VM, resuming provisioning")
+	return nil
+}
+
+// restartVM boots the stopped VM again and re-establishes the connection
+// the communicator wrappers of the build use
+func restartVM(ctx context.Context, state multistep.StateBag) error {
+	config := state.Get("config").(*Config)
+	driver := state.Get("driver").(driver.MedaDriver)
+	ui := state.Get("ui").(packer.Ui)
+	vmName := state.Get("vm_name").(string)
+
+	if err := driver.StartVM(vmName); err != nil {
+		return fmt.Errorf("failed to restart VM: %s", err)
+	}
+	ip, err := waitForVMIP(ctx, driver, ui, config, vmName)
+	if err != nil {
+		return err
+	}
+	state.Put("vm_ip", ip)
+	state.Put("instance_ip", ip)
+
+	conn, ok := state.GetOk("restartable_connection")
+	if !ok {
+		// Mock mode has no connection to re-establish
+		return nil
+	}
+	return conn.(*restartableComm).reconnect(ctx, state)
+}
+
+// restartableComm holds the connection StepConnect opened, underneath all
+// communicator wrappers. When the VM restarts during provisioning, a new
+// StepConnect replaces the connection in place, so the wrappers keep
+// working whether or not they would reconnect on their own.
+type restartableComm struct {
+	mu   sync.Mutex
+	comm packer.Communicator
+}
+
+// reconnect connects to the restarted VM the way the build connected
+// first, including a bastion, proxy or the Meda API tunnel
+func (c *restartableComm) reconnect(ctx context.Context, state multistep.StateBag) error {
+	config := state.Get("config").(*Config)
+
+	// StepConnect stores the new connection as the communicator, the
+	// provisioners have to keep the wrapped one
+	wrapped := state.Get("communicator")
+	defer state.Put("communicator", wrapped)
+
+	step := newStepConnect(config)
+	if step.Run(ctx, state) == multistep.ActionHalt {
+		err := fmt.Errorf("failed to connect to the restarted VM")
+		if rawErr, ok := state.GetOk("error"); ok {
+			err = fmt.Errorf("failed to connect to the restarted VM: %s", rawErr)
+			state.Remove("error")
+		}
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.comm = state.Get("communicator").(packer.Communicator)
+	return nil
+}
+
+func (c *restartableComm) current() packer.Communicator {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.comm
+}
+
+func (c *restartableComm) Start(ctx context.Context, cmd *packer.RemoteCmd) error {
+	return c.current().Start(ctx, cmd)
+}
+
+func (c *restartableComm) Upload(path string, input io.Reader, fi *os.FileInfo) error {
+	return c.current().Upload(path, input, fi)
+}
+
+func (c *restartableComm) UploadDir(dst string, src string, exclude []string) error {
+	return c.current().UploadDir(dst, src, exclude)
+}
+
+func (c *restartableComm) Download(path string, output io.Writer) error {
+	return c.current().Download(path, output)
+}
+
+func (c *restartableComm) DownloadDir(src string, dst string, exclude []string) error {
+	return c.current().DownloadDir(src, dst, exclude)
+}
+
+// stepRestartableConnection puts the connection StepConnect opened into a
+// restartableComm, before any other step wraps it
+type stepRestartableConnection struct{}
+
+func (s *stepRestartableConnection) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	comm := &restartableComm{comm: state.Get("communicator").(packer.Communicator)}
+	state.Put("restartable_connection", comm)
+	state.Put("communicator", comm)
+	return multistep.ActionContinue
+}
+
+func (s *stepRestartableConnection) Cleanup(state multistep.StateBag) {}
+
+// stepCheckpoints installs the checkpoint communicator before provisioning
+type stepCheckpoints struct{}
+
+func (s *stepCheckpoints) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	config := state.Get("config").(*Config)
+	comm := state.Get("communicator").(packer.Communicator)
+
+	state.Put("communicator", newCheckpointCommunicator(comm, state, config.Checkpoints))
+	return multistep.ActionContinue
+}
+
+func (s *stepCheckpoints) Cleanup(state multistep.StateBag) {}
+
+// stepFinishCheckpoints runs after provisioning to warn about checkpoints
+// no provisioner requested
+type stepFinishCheckpoints struct{}
+
+func (s *stepFinishCheckpoints) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	ui := state.Get("ui").(packer.Ui)
+	comm, ok := state.Get("communicator").(*checkpointCommunicator)
+	if !ok {
+		return multistep.ActionContinue
+	}
+
+	comm.mu.Lock()
+	defer comm.mu.Unlock()
+	for name := range comm.pending {
+		ui.Say(fmt.Sprintf("Warning: checkpoint '%s' was never requested by a meda-checkpoint provisioner", name))
+	}
+	return multistep.ActionContinue
+}
+
+func (s *stepFinishCheckpoints) Cleanup(state multistep.StateBag) {}
+
+// checkpointRetention returns how the image of checkpoint name is handled once the
+// final image exists: keep, push or delete
+func (c *Config) checkpointRetention(name string) string {
+	for _, cp := range c.Checkpoints {
+		if cp.Name == name && cp.Retention != "" {
+			return cp.Retention
+		}
+	}
+	return c.CheckpointRetention
+}
+
+// stepCheckpointRetention pushes or deletes the checkpoint images after the
+// final image has been created and pushed. Checkpoints are only pushed
+// together with the final image.
+type stepCheckpointRetention struct{}
+
+func (s *stepCheckpointRetention) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	config := state.Get("config").(*Config)
+	driver := state.Get("driver").(driver.MedaDriver)
+	ui := state.Get("ui").(packer.Ui)
+
+	images, _ := state.GetOk("checkpoint_images")
+	captured, _ := images.([]CheckpointImage)
+	_, finalPushed := state.GetOk("pushed_image")
+
+	var kept []CheckpointImage
+	for _, cp := range captured {
+		switch config.checkpointRetention(cp.Name) {
+		case "push":
+			if !finalPushed {
+				ui.Say(fmt.Sprintf("Checkpoint '%s' is kept locally, the final image was not pushed", cp.Name))
+				break
+			}
+			target := config.registryRepository() + ":" + cp.Tag
+			if err := pushImages(ctx, driver, ui, config.pushOptions(cp.Image), []string{target}, 1, config.RegistryRetryBudget); err != nil {
+				err := fmt.Errorf("failed to push checkpoint '%s': %s", cp.Name, err)
+				state.Put("error", err)
+				ui.Error(err.Error())
+				return multistep.ActionHalt
+			}
+			cp.Pushed = target
+		case "delete":
+			ui.Say(fmt.Sprintf("Deleting checkpoint image '%s'", cp.Image))
+			if err := driver.DeleteImage(cp.Image); err != nil {
+				ui.Say(fmt.Sprintf("Warning: failed to delete checkpoint image '%s': %s", cp.Image, err))
+				break
+			}
+			continue
+		}
+		kept = append(kept, cp)
+	}
+
+	state.Put("checkpoint_images", kept)
+	return multistep.ActionContinue
+}
+
+func (s *stepCheckpointRetention) Cleanup(state multistep.StateBag) {}
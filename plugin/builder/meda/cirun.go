@@ -0,0 +1,145 @@
+package meda
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/cirunlabs/packer-plugin-meda/driver"
+	"github.com/cirunlabs/packer-plugin-meda/version"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// cirunTimeout bounds the registration request
+const cirunTimeout = 30 * time.Second
+
+// CirunConfig registers the pushed image as the runner image of a Cirun
+// pool, so the runner fleet picks up the new image
+type CirunConfig struct {
+	// APIToken authenticates with the Cirun API. Defaults to CIRUN_API_KEY
+	// from meda_env, which Vault can fill, or the environment.
+	APIToken string `mapstructure:"api_token"`
+	// APIURL is the base URL of the Cirun API
+	APIURL string `mapstructure:"api_url"`
+	// Repo is the repository the runners serve, as owner/name
+	Repo string `mapstructure:"repo" required:"true"`
+	// Pool is the runner pool whose image is set
+	Pool string `mapstructure:"pool" required:"true"`
+}
+
+// prepare applies defaults and validates the Cirun configuration
+func (c *CirunConfig) prepare() []error {
+	var errs []error
+
+	if c.APIURL == "" {
+		c.APIURL = "https://api.cirun.io/api/v1"
+	}
+	c.APIURL = strings.TrimSuffix(c.APIURL, "/")
+	if u, err := url.Parse(c.APIURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs = append(errs, fmt.Errorf("cirun.api_url must be an http or https URL, got %q", c.APIURL))
+	}
+	if owner, name, ok := strings.Cut(c.Repo, "/"); !ok || owner == "" || name == "" || strings.Contains(name, "/") {
+		errs = append(errs, fmt.Errorf("cirun.repo must be owner/name, got %q", c.Repo))
+	}
+	if c.Pool == "" {
+		errs = append(errs, fmt.Errorf("cirun.pool is required"))
+	}
+	if c.APIToken != "" {
+		packer.LogSecretFilter.Set(c.APIToken)
+	}
+	return errs
+}
+
+// CirunImageUpdate is the body of the runner image update
+type CirunImageUpdate struct {
+	Repo   string   `json:"repo"`
+	Pool   string   `json:"pool"`
+	Image  string   `json:"image"`
+	Tags   []string `json:"tags"`
+	Digest string   `json:"digest,omitempty"`
+}
+
+// registerCirunImage sets update.Image as the image of the pool
+func registerCirunImage(ctx context.Context, c *CirunConfig, token string, update CirunImageUpdate) error {
+	body, err := json.Marshal(update)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, cirunTimeout)
+	defer cancel()
+	endpoint := fmt.Sprintf("%s/repos/%s/pools/%s/image", c.APIURL, update.Repo, url.PathEscape(update.Pool))
+	req, err := http.NewRequestWithContext(ctx, "PUT", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("User-Agent", "packer-plugin-meda/"+version.Version)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s - %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+	return nil
+}
+
+// stepCirunRegister registers the pushed image with Cirun after the push
+type stepCirunRegister struct{}
+
+func (s *stepCirunRegister) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	config := state.Get("config").(*Config)
+	ui := state.Get("ui").(packer.Ui)
+	cirun := config.Cirun
+
+	pushed, ok := state.Get("pushed_images").([]string)
+	if !ok || len(pushed) == 0 {
+		ui.Say("Image was not pushed, not registering it with Cirun")
+		return multistep.ActionContinue
+	}
+
+	token := cirun.APIToken
+	if token == "" {
+		token = medaEnv(config, "CIRUN_API_KEY")
+	}
+	if token == "" {
+		err := fmt.Errorf("cirun.api_token or CIRUN_API_KEY is required to register the image with Cirun")
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+	packer.LogSecretFilter.Set(token)
+
+	update := CirunImageUpdate{
+		Repo:  cirun.Repo,
+		Pool:  cirun.Pool,
+		Image: pushed[0],
+		Tags:  pushed,
+	}
+	if info, ok := state.Get("image_info").(*driver.ImageInfo); ok && info != nil {
+		update.Digest = info.Digest
+	}
+
+	ui.Say(fmt.Sprintf("Registering '%s' as the runner image of Cirun pool '%s' of %s", update.Image, cirun.Pool, cirun.Repo))
+	if err := registerCirunImage(ctx, cirun, token, update); err != nil {
+		err := fmt.Errorf("failed to register the image with Cirun, it was pushed as %s: %s", update.Image, err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+	return multistep.ActionContinue
+}
+
+func (s *stepCirunRegister) Cleanup(state multistep.StateBag) {}
@@ -0,0 +1,51 @@
+package meda
+
+import (
+	"fmt"
+
+	"github.com/cirunlabs/packer-plugin-meda/driver"
+)
+
+// CommandOverrides replaces the arguments meda_binary is run with for
+// single operations, for patched or renamed Meda CLIs. Every argument is
+// a template rendered with driver.CommandData; arguments that render
+// empty are left out.
+type CommandOverrides struct {
+	// Create creates the build VM, instead of `run <base image> --name ...`
+	Create []string `mapstructure:"create"`
+	// Start and Stop start and stop a VM
+	Start []string `mapstructure:"start"`
+	Stop  []string `mapstructure:"stop"`
+	// IP prints the address of a VM
+	IP []string `mapstructure:"ip"`
+	// CreateImage captures an image from a VM or a VM snapshot
+	CreateImage []string `mapstructure:"create_image"`
+	// Push pushes an image to a registry
+	Push []string `mapstructure:"push"`
+}
+
+// overrides returns the operations by configuration key
+func (o *CommandOverrides) overrides() map[string][]string {
+	if o == nil {
+		return nil
+	}
+	return map[string][]string{
+		"create":       o.Create,
+		"start":        o.Start,
+		"stop":         o.Stop,
+		"ip":           o.IP,
+		"create_image": o.CreateImage,
+		"push":         o.Push,
+	}
+}
+
+// prepare checks that every template renders
+func (o *CommandOverrides) prepare() []error {
+	var errs []error
+	for key, args := range o.overrides() {
+		if _, err := driver.RenderCommandArgs(args, driver.CommandData{}); err != nil {
+			errs = append(errs, fmt.Errorf("commands.%s: %s", key, err))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,42 @@
+package meda
+
+import "github.com/hashicorp/packer-plugin-sdk/plugin"
+
+// pluginName is the name the plugin is installed under,
+// github.com/cirunlabs/meda
+const pluginName = "meda"
+
+// Component is a component of the plugin as it is registered with Packer
+type Component struct {
+	// Kind is builder, data-source, provisioner or post-processor
+	Kind string
+	// Name is the registered name. Packer prefixes it with the plugin
+	// name, so the builder "vm" is used as source "meda-vm".
+	Name string
+	// Aliases are further names the component is registered under.
+	// plugin.DEFAULT_NAME stands for the plugin name alone.
+	Aliases []string
+	// New returns a new instance of the component
+	New func() interface{}
+}
+
+// Components are the components of the plugin
+var Components = []Component{
+	// source "meda" is shorthand for source "meda-vm", and keeps source
+	// "meda-vm" working when the plugin is installed as .../meda-vm
+	{Kind: "builder", Name: "vm", Aliases: []string{plugin.DEFAULT_NAME}, New: func() interface{} { return new(Builder) }},
+	{Kind: "data-source", Name: "vms", New: func() interface{} { return new(Datasource) }},
+	{Kind: "provisioner", Name: "exec", New: func() interface{} { return new(ExecProvisioner) }},
+	{Kind: "provisioner", Name: "checkpoint", New: func() interface{} { return new(CheckpointProvisioner) }},
+	{Kind: "post-processor", Name: "cloud-import", New: func() interface{} { return new(CloudImportPostProcessor) }},
+	{Kind: "post-processor", Name: "prune", New: func() interface{} { return new(PrunePostProcessor) }},
+}
+
+// templateName returns the name templates use for a component registered
+// as name
+func templateName(name string) string {
+	if name == plugin.DEFAULT_NAME {
+		return pluginName
+	}
+	return pluginName + "-" + name
+}
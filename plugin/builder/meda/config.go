@@ -0,0 +1,1066 @@
+// Code generation: packer-sdc mapstructure-to-hcl2 -type Config,CirunConfig,CommandOverrides,CredentialProfile,Checkpoint,ObjectStorageExport,ProvisionStage,PushCondition,ScanConfig,ServiceVM,VaultAuth,Webhook
+// Generated file: config.hcl2spec.go
+
+package meda
+
+import (
+	"fmt"
+	"maps"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/cirunlabs/packer-plugin-meda/driver"
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/hashicorp/packer-plugin-sdk/common"
+	"github.com/hashicorp/packer-plugin-sdk/communicator"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/template/config"
+	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
+)
+
+// hostnamePattern matches RFC 1123 host names, optionally fully qualified
+var hostnamePattern = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(\.[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$`)
+
+// localePattern and keyboardLayoutPattern match locale names such as
+// de_DE.UTF-8 and XKB layout names such as de or latam
+var (
+	localePattern         = regexp.MustCompile(`^[A-Za-z]{1,8}(_[A-Za-z0-9]+)?(\.[A-Za-z0-9-]+)?(@[A-Za-z0-9]+)?$`)
+	keyboardLayoutPattern = regexp.MustCompile(`^[a-z][a-z0-9_-]*$`)
+)
+
+type Config struct {
+	common.PackerConfig `mapstructure:",squash"`
+	Comm                communicator.Config `mapstructure:",squash"`
+
+	// Meda configuration
+	MedaBinary string         `mapstructure:"meda_binary"`
+	MedaHost   string         `mapstructure:"meda_host"`
+	MedaPort   int            `mapstructure:"meda_port"`
+	UseAPI     config.Trilean `mapstructure:"use_api"`
+	// Pool of Meda API servers to spread builds over, and how one is picked
+	MedaHosts         []string `mapstructure:"meda_hosts"`
+	MedaHostSelection string   `mapstructure:"meda_host_selection"`
+	// Tunnel SSH through the Meda API instead of connecting to the VM
+	SSHViaAPI bool `mapstructure:"ssh_via_api"`
+	// Switch to the CLI when the API server can't be reached
+	APIFallbackToCLI bool `mapstructure:"api_fallback_to_cli"`
+	// Don't compare the API server's Meda release with the endpoints the
+	// build needs
+	SkipAPIVersionCheck bool `mapstructure:"skip_api_version_check"`
+	// Start `meda serve` for the duration of the build if it isn't running
+	ManageMedaServer       bool          `mapstructure:"manage_meda_server"`
+	MedaServerStartTimeout time.Duration `mapstructure:"meda_server_start_timeout"`
+	// Environment and working directory for spawned meda/cargo processes
+	MedaEnv        map[string]string `mapstructure:"meda_env"`
+	MedaWorkingDir string            `mapstructure:"meda_working_dir"`
+	// Replacement arguments for meda commands, for patched or renamed
+	// Meda CLIs
+	Commands *CommandOverrides `mapstructure:"commands"`
+	// Profile of the shared settings file to apply
+	MedaProfile string `mapstructure:"meda_profile"`
+	// Simulate Meda and the guest instead of creating a VM, for checking
+	// templates without virtualization
+	MockMode bool `mapstructure:"mock_mode"`
+
+	// Never let meda wait for input; defaults to true when CI is set
+	NonInteractive config.Trilean `mapstructure:"non_interactive"`
+
+	// VM configuration
+	VMName    string `mapstructure:"vm_name" required:"true"`
+	BaseImage string `mapstructure:"base_image"`
+	// VM whose disk is cloned and provisioned instead of base_image
+	SourceVM     string `mapstructure:"source_vm"`
+	Memory       string `mapstructure:"memory"`
+	CPUs         int    `mapstructure:"cpus"`
+	DiskSize     string `mapstructure:"disk_size"`
+	UserDataFile string `mapstructure:"user_data_file"`
+
+	// Create a missing base image instead of failing; defaults to true
+	AutoCreateBaseImage config.Trilean `mapstructure:"auto_create_base_image"`
+
+	// Directory where created base images are kept and shared between
+	// builds; relative paths are inside Packer's cache directory
+	ImageCacheDir string `mapstructure:"image_cache_dir"`
+
+	// Meda images attached read-only to the build VM, e.g. package
+	// mirrors or model caches that must not end up in the output image
+	AttachVolumes []string `mapstructure:"attach_volumes"`
+
+	// Auxiliary VMs booted next to the build VM while it is provisioned
+	Services []ServiceVM `mapstructure:"service"`
+
+	// Larger sizing used while provisioning; the VM is resized to memory
+	// and cpus before the image is captured
+	ProvisionMemory string `mapstructure:"provision_memory"`
+	ProvisionCPUs   int    `mapstructure:"provision_cpus"`
+
+	// How the image is captured: stop shuts the VM down first,
+	// live-snapshot snapshots its disk while it keeps running
+	CaptureMode string `mapstructure:"capture_mode"`
+
+	// Performance hints for the build VM on capable hosts
+	Hugepages    bool `mapstructure:"hugepages"`
+	KSM          bool `mapstructure:"ksm"`
+	IOThreads    int  `mapstructure:"io_threads"`
+	VirtioQueues int  `mapstructure:"virtio_queues"`
+
+	// Give the build VM a memory balloon, so the host can reclaim memory
+	// the guest doesn't use; with max_memory the VM can also grow beyond
+	// memory while provisioning
+	MemoryBallooning bool   `mapstructure:"memory_ballooning"`
+	MaxMemory        string `mapstructure:"max_memory"`
+
+	// Host CPUs the build VM's vCPUs are pinned to, as a cpuset list such
+	// as "0-3,8-11", and the NUMA node its memory is allocated on
+	CPUAffinity string `mapstructure:"cpu_affinity"`
+	NUMANode    *int   `mapstructure:"numa_node"`
+
+	// Throttle the build VM so builds on shared hosts leave room for the
+	// jobs running next to them: its disk throughput in MB/s and its CPU
+	// weight relative to other VMs, 1024 being the default weight
+	DiskIOLimitMBps int `mapstructure:"disk_io_limit_mbps"`
+	CPUShares       int `mapstructure:"cpu_shares"`
+
+	// How long the API may take to report a started VM as running
+	VMStartTimeout time.Duration `mapstructure:"vm_start_timeout"`
+
+	// How user-data reaches the guest: nocloud, configdrive or meda
+	CloudInitDatasource string `mapstructure:"cloud_init_datasource"`
+
+	// Ignition config for guests without cloud-init, such as Fedora
+	// CoreOS and Flatcar. Butane is transpiled with the butane tool.
+	IgnitionFile string `mapstructure:"ignition_file"`
+	Butane       string `mapstructure:"butane"`
+
+	// Network identity of the build VM, for DHCP reservations or
+	// licenses bound to MAC address or hostname
+	MACAddress    string `mapstructure:"mac_address"`
+	GuestHostname string `mapstructure:"guest_hostname"`
+
+	// IP discovery through the host neighbor table when meda reports no IP
+	IPFallbackAfter time.Duration `mapstructure:"ip_fallback_after"`
+	NetworkBridge   string        `mapstructure:"network_bridge"`
+
+	// Pick the VM address to connect to by interface or subnet when the VM
+	// has several
+	IPInterface  string `mapstructure:"ip_interface"`
+	IPCIDRFilter string `mapstructure:"ip_cidr_filter"`
+
+	// Network of the build VM: none keeps meda's default, nat allows
+	// outbound traffic through NAT and isolated only lets it reach
+	// network_allow
+	NetworkIsolation string   `mapstructure:"network_isolation"`
+	NetworkAllow     []string `mapstructure:"network_allow"`
+
+	// Time settings written into the generated cloud-init
+	GuestTimezone string   `mapstructure:"guest_timezone"`
+	NTPServers    []string `mapstructure:"ntp_servers"`
+
+	// Name resolution written into the generated cloud-init: resolvers,
+	// search domains and /etc/hosts entries, hostname to IP address
+	DNSServers  []string          `mapstructure:"dns_servers"`
+	DNSSearch   []string          `mapstructure:"dns_search"`
+	HostEntries map[string]string `mapstructure:"host_entries"`
+
+	// Localization written into the generated cloud-init
+	Locale         string `mapstructure:"locale"`
+	KeyboardLayout string `mapstructure:"keyboard_layout"`
+
+	// Transfer files through exec channels when the guest lacks scp or
+	// sftp-server: auto, always or never
+	FileTransferFallback string `mapstructure:"file_transfer_fallback"`
+
+	// Reconnect when the SSH connection drops during provisioning
+	DisableSSHReconnect bool          `mapstructure:"disable_ssh_reconnect"`
+	SSHReconnectTimeout time.Duration `mapstructure:"ssh_reconnect_timeout"`
+
+	// Wait for cloud-init to finish before provisioning
+	SkipCloudInitWait bool          `mapstructure:"skip_cloud_init_wait"`
+	CloudInitTimeout  time.Duration `mapstructure:"cloud_init_timeout"`
+
+	// Don't make sure the root filesystem fills disk_size
+	SkipGrowRootFS bool `mapstructure:"skip_grow_root_fs"`
+
+	// Wait until a file exists in the guest or a command succeeds there
+	// before provisioning
+	GuestReadyFile     string        `mapstructure:"guest_ready_file"`
+	GuestReadyCommand  string        `mapstructure:"guest_ready_command"`
+	GuestReadyTimeout  time.Duration `mapstructure:"guest_ready_timeout"`
+	GuestReadyInterval time.Duration `mapstructure:"guest_ready_interval"`
+
+	// Packages installed with the guest's package manager before the
+	// provisioners run
+	Packages []string `mapstructure:"packages"`
+
+	// Scripts installed into the image to run on the first boot of every
+	// VM created from it; first_boot_method is auto, systemd or cloud-init
+	FirstBootScripts []string `mapstructure:"first_boot_scripts"`
+	FirstBootMethod  string   `mapstructure:"first_boot_method"`
+
+	// Don't write /etc/meda-image-info.json into the image
+	SkipImageInfo bool `mapstructure:"skip_image_info"`
+
+	// Report of the packages and large files provisioning changed
+	DiffReportFile        string `mapstructure:"diff_report_file"`
+	DiffReportMinFileSize string `mapstructure:"diff_report_min_file_size"`
+
+	// Path of an Ansible inventory for the build VM, written after connecting
+	AnsibleInventoryFile string `mapstructure:"ansible_inventory_file"`
+
+	// Guest OS family selecting default SSH credentials and user-data
+	GuestOS            string              `mapstructure:"guest_os"`
+	CredentialProfiles []CredentialProfile `mapstructure:"credential_profile"`
+
+	// Replace the well-known default password before the image is captured
+	RotateCredentials   bool `mapstructure:"rotate_credentials"`
+	DisablePasswordAuth bool `mapstructure:"disable_password_auth"`
+
+	// Provision as a one-off user that is removed before capture
+	TemporarySSHUser bool `mapstructure:"temporary_ssh_user"`
+
+	// Keep the generated SSH key at this path and reuse it in later builds,
+	// by default the plugin cache when ssh_keypair_name is set
+	SSHTemporaryKeyPath string `mapstructure:"ssh_temporary_key_path"`
+
+	// Forward the local SSH agent to the build VM
+	SSHAgentForwarding bool `mapstructure:"ssh_agent_forwarding"`
+
+	// Intermediate images captured during provisioning
+	Checkpoints []Checkpoint `mapstructure:"checkpoint"`
+	// What happens to checkpoint images once the final image exists:
+	// keep, push or delete
+	CheckpointRetention string `mapstructure:"checkpoint_retention"`
+	// Stop the VM at every meda-checkpoint provisioner and wait for enter
+	// before starting it again
+	StopAtCheckpoints bool `mapstructure:"stop_at_checkpoints"`
+	// Users provisioning continues as, in order
+	ProvisionStages []ProvisionStage `mapstructure:"provision_stage"`
+
+	// Image output configuration
+	OutputImageName string `mapstructure:"output_image_name" required:"true"`
+	OutputTag       string `mapstructure:"output_tag"`
+	Registry        string `mapstructure:"registry"`
+	Organization    string `mapstructure:"organization"`
+	// Time after which meda-prune deletes the image
+	ExpiresAfter time.Duration `mapstructure:"expires_after"`
+
+	// Push configuration
+	PushToRegistry bool `mapstructure:"push_to_registry"`
+	DryRun         bool `mapstructure:"dry_run"`
+	// Don't check registry access before the build starts
+	SkipRegistryPreflight bool `mapstructure:"skip_registry_preflight"`
+	// Attach the build log and a summary to the pushed image as an OCI
+	// referrer
+	AttachBuildRecord bool `mapstructure:"attach_build_record"`
+	// Further tags of the image pushed next to output_tag, and how many
+	// pushes run at once
+	PushTags        []string `mapstructure:"push_tags"`
+	PushConcurrency int      `mapstructure:"push_concurrency"`
+
+	// How long pushes and pulls keep retrying registry rate limits and
+	// server errors
+	RegistryRetryBudget time.Duration `mapstructure:"registry_retry_budget"`
+
+	// Conditions under which push_to_registry actually pushes
+	PushCondition *PushCondition `mapstructure:"push_condition"`
+
+	// URLs notified of build events
+	Webhooks []Webhook `mapstructure:"webhook"`
+
+	// Register the pushed image as the runner image of a Cirun pool
+	Cirun *CirunConfig `mapstructure:"cirun"`
+
+	// Fetch registry tokens and the SSH key from Vault at build time
+	VaultAuth *VaultAuth `mapstructure:"vault_auth"`
+
+	// Vulnerability scan that has to pass before the image is pushed
+	Scan *ScanConfig `mapstructure:"scan"`
+
+	// Registry TLS settings for lab registries
+	RegistryInsecure config.Trilean `mapstructure:"registry_insecure"`
+	RegistryCAFile   string         `mapstructure:"registry_ca_file"`
+
+	// Regular expressions classifying stderr lines of a successful push
+	PushErrorPatterns   []string `mapstructure:"push_error_patterns"`
+	PushWarningPatterns []string `mapstructure:"push_warning_patterns"`
+
+	// Write the image reference as Terraform variables to this path
+	TfvarsOutput string `mapstructure:"tfvars_output"`
+
+	// Upload the image disk to cloud object storage after the build
+	ObjectStorageExport *ObjectStorageExport `mapstructure:"object_storage_export"`
+
+	// Export the image as an OCI layout tarball to this path instead of
+	// pushing it, for air-gapped hosts. No registry is contacted.
+	OfflineOutput string `mapstructure:"offline_output"`
+
+	// Meda API servers (host or host:port) the image is copied to directly
+	ReplicateTo []string `mapstructure:"replicate_to"`
+
+	// Interval between "still working" messages during silent operations
+	HeartbeatInterval time.Duration `mapstructure:"heartbeat_interval"`
+
+	// JSON lines log of every image and VM mutation
+	AuditLogFile string `mapstructure:"audit_log_file"`
+
+	// Orphan cleanup configuration
+	CleanupOrphans bool          `mapstructure:"cleanup_orphans"`
+	OrphanMaxAge   time.Duration `mapstructure:"orphan_max_age"`
+
+	// createSSHUser is set by built-in profiles for images that don't have
+	// the profile's user, stepUserData adds it
+	createSSHUser bool
+
+	ctx interpolate.Context
+}
+
+// provisionMemory is the memory of the VM while provisioning
+func (c *Config) provisionMemory() string {
+	if c.ProvisionMemory != "" {
+		return c.ProvisionMemory
+	}
+	return c.Memory
+}
+
+// provisionCPUs is the CPU count of the VM while provisioning
+func (c *Config) provisionCPUs() int {
+	if c.ProvisionCPUs > 0 {
+		return c.ProvisionCPUs
+	}
+	return c.CPUs
+}
+
+// resizeBeforeCapture reports whether the provisioning size differs from
+// the size the image is captured with
+func (c *Config) resizeBeforeCapture() bool {
+	return c.provisionMemory() != c.Memory || c.provisionCPUs() != c.CPUs
+}
+
+// apiFeatures lists the Meda API features the build calls
+func (c *Config) apiFeatures() []driver.APIFeature {
+	features := []driver.APIFeature{driver.APIFeatureVMs}
+	if c.CaptureMode == "live-snapshot" || c.SourceVM != "" {
+		features = append(features, driver.APIFeatureSnapshots)
+	}
+	if c.resizeBeforeCapture() {
+		features = append(features, driver.APIFeatureResize)
+	}
+	if c.PushToRegistry && !c.DryRun {
+		features = append(features, driver.APIFeaturePush)
+	}
+	if c.OfflineOutput != "" || c.ObjectStorageExport != nil || c.ImageCacheDir != "" || len(c.ReplicateTo) > 0 {
+		features = append(features, driver.APIFeatureExport)
+	}
+	if c.ImageCacheDir != "" {
+		features = append(features, driver.APIFeatureImport)
+	}
+	return features
+}
+
+// waitsForGuestReady reports whether provisioning waits for a readiness
+// signal from the guest
+func (c *Config) waitsForGuestReady() bool {
+	return c.GuestReadyFile != "" || c.GuestReadyCommand != ""
+}
+
+// waitsForPowerOff reports whether the build, lacking a communicator,
+// waits for cloud-init to power the VM off instead of connecting
+func (c *Config) waitsForPowerOff() bool {
+	return c.Comm.Type == "none" && !c.SkipCloudInitWait && !c.usesIgnition()
+}
+
+// restartsDuringProvisioning reports whether the VM is stopped and started
+// again between provisioners, which needs a new connection
+func (c *Config) restartsDuringProvisioning() bool {
+	return (len(c.Checkpoints) > 0 && c.CaptureMode == "stop") || c.StopAtCheckpoints
+}
+
+// writesImageInfo reports whether the build provenance is written into
+// the image, which needs a shell in the guest
+func (c *Config) writesImageInfo() bool {
+	return !c.SkipImageInfo && c.Comm.Type == "ssh"
+}
+
+// DriverConfig returns the settings a driver needs to reach the Meda this
+// config points at. It is a copy: a driver doesn't see changes made to the
+// config after it was built, steps changing the Meda host, port or
+// environment replace the driver with resetDriver.
+func (c *Config) DriverConfig() *driver.Config {
+	return &driver.Config{
+		MedaBinary:     c.MedaBinary,
+		MedaHost:       c.MedaHost,
+		MedaPort:       c.MedaPort,
+		UseAPI:         c.UseAPI.True(),
+		MedaEnv:        maps.Clone(c.MedaEnv),
+		MedaWorkingDir: c.MedaWorkingDir,
+		NonInteractive: c.NonInteractive,
+		Commands:       c.Commands.overrides(),
+		MockMode:       c.MockMode,
+		VMStartTimeout: c.VMStartTimeout,
+		AuditLogFile:   c.AuditLogFile,
+	}
+}
+
+func (c *Config) ConfigSpec() hcldec.ObjectSpec {
+	return c.FlatMapstructure().HCL2Spec()
+}
+
+func (c *Config) Prepare(raws ...interface{}) error {
+	c.ctx.Funcs = gitTemplateFuncs()
+	err := config.Decode(c, &config.DecodeOpts{
+		Interpolate:        true,
+		InterpolateContext: &c.ctx,
+		InterpolateFilter: &interpolate.RenderFilter{
+			// Rendered per command with the values of the operation
+			Exclude: []string{"commands"},
+		},
+	}, raws...)
+	if err != nil {
+		return err
+	}
+
+	// The environment and shared settings fill in what the template
+	// leaves unset
+	if err := c.applyEnvironment(); err != nil {
+		return err
+	}
+	if err := c.applySettings(); err != nil {
+		return err
+	}
+
+	// Set defaults
+	if c.MedaBinary == "" {
+		c.MedaBinary = "meda"
+	}
+	if c.MedaHost == "" {
+		c.MedaHost = "127.0.0.1"
+	}
+	if c.MedaPort == 0 {
+		c.MedaPort = 7777
+	}
+	if c.MedaHostSelection == "" {
+		c.MedaHostSelection = "least-loaded"
+	}
+	if c.NonInteractive == config.TriUnset {
+		c.NonInteractive = config.TrileanFromBool(os.Getenv("CI") != "")
+	}
+	if c.MedaServerStartTimeout == 0 {
+		c.MedaServerStartTimeout = 30 * time.Second
+	}
+	if c.Memory == "" {
+		c.Memory = "1G"
+	}
+	if c.CPUs == 0 {
+		c.CPUs = 2
+	}
+	if c.DiskSize == "" {
+		c.DiskSize = "10G"
+	}
+	if c.OutputTag == "" {
+		c.OutputTag = "latest"
+	}
+	if c.Registry == "" {
+		c.Registry = "ghcr.io"
+	}
+	if c.GuestOS == "" {
+		c.GuestOS = "cirun"
+	}
+	if c.HeartbeatInterval == 0 {
+		c.HeartbeatInterval = time.Minute
+	}
+	if c.PushErrorPatterns == nil {
+		c.PushErrorPatterns = driver.DefaultPushErrorPatterns
+	}
+	if c.CheckpointRetention == "" {
+		c.CheckpointRetention = "keep"
+	}
+	for i := range c.Checkpoints {
+		if c.Checkpoints[i].OutputTag == "" {
+			c.Checkpoints[i].OutputTag = c.OutputTag + "-" + c.Checkpoints[i].Name
+		}
+	}
+	if c.ImageCacheDir != "" && !filepath.IsAbs(c.ImageCacheDir) {
+		dir, err := packer.CachePath(c.ImageCacheDir)
+		if err != nil {
+			return fmt.Errorf("failed to resolve image_cache_dir: %s", err)
+		}
+		c.ImageCacheDir = dir
+	}
+	if c.OfflineOutput != "" {
+		if abs, err := filepath.Abs(c.OfflineOutput); err == nil {
+			c.OfflineOutput = abs
+		}
+	}
+	if c.IPFallbackAfter == 0 {
+		c.IPFallbackAfter = time.Minute
+	}
+	if c.VMStartTimeout == 0 {
+		c.VMStartTimeout = 5 * time.Minute
+	}
+	if c.RegistryRetryBudget == 0 {
+		c.RegistryRetryBudget = 10 * time.Minute
+	}
+	if c.PushConcurrency == 0 {
+		c.PushConcurrency = 3
+	}
+	if c.NetworkIsolation == "" {
+		c.NetworkIsolation = "none"
+	}
+	if c.DiffReportMinFileSize == "" {
+		c.DiffReportMinFileSize = "10M"
+	}
+	if c.CaptureMode == "" {
+		c.CaptureMode = "stop"
+	}
+	if c.FirstBootMethod == "" {
+		c.FirstBootMethod = "auto"
+	}
+	if c.FileTransferFallback == "" {
+		c.FileTransferFallback = "auto"
+	}
+	if c.SSHReconnectTimeout == 0 {
+		c.SSHReconnectTimeout = 5 * time.Minute
+	}
+	if c.CloudInitTimeout == 0 {
+		c.CloudInitTimeout = 10 * time.Minute
+	}
+	if c.GuestReadyTimeout == 0 {
+		c.GuestReadyTimeout = 30 * time.Minute
+	}
+	if c.GuestReadyInterval == 0 {
+		c.GuestReadyInterval = 10 * time.Second
+	}
+
+	if c.OrphanMaxAge == 0 {
+		c.OrphanMaxAge = time.Hour
+	}
+
+	// Validation
+	var errs []error
+
+	// Set up communicator defaults first, the validation below depends on
+	// the communicator type
+	if c.Comm.Type == "" {
+		c.Comm.Type = "ssh"
+	}
+	if c.Comm.SSHPort == 0 {
+		c.Comm.SSHPort = 22
+	}
+	if c.Comm.SSHTimeout == 0 {
+		c.Comm.SSHTimeout = 5 * time.Minute
+	}
+	// Default credentials and user-data depend on the guest OS family
+	if err := c.applyCredentialProfile(); err != nil {
+		errs = append(errs, err)
+	} else if c.Comm.Type != "serial" {
+		// serial is handled by this plugin, the SDK doesn't know it
+		errs = append(errs, c.Comm.Prepare(&c.ctx)...)
+	}
+
+	if c.VMName == "" {
+		errs = append(errs, fmt.Errorf("vm_name is required"))
+	}
+
+	switch {
+	case c.BaseImage == "" && c.SourceVM == "":
+		errs = append(errs, fmt.Errorf("base_image or source_vm is required"))
+	case c.BaseImage != "" && c.SourceVM != "":
+		errs = append(errs, fmt.Errorf("base_image and source_vm cannot be combined"))
+	}
+
+	if c.OutputImageName == "" {
+		errs = append(errs, fmt.Errorf("output_image_name is required"))
+	}
+
+	if c.ManageMedaServer && !c.UseAPI.True() {
+		errs = append(errs, fmt.Errorf("manage_meda_server requires use_api = true"))
+	}
+	if c.SSHViaAPI && (!c.UseAPI.True() || c.Comm.Type != "ssh") {
+		errs = append(errs, fmt.Errorf("ssh_via_api requires use_api = true and the ssh communicator"))
+	}
+	if c.SSHViaAPI && (c.Comm.SSHBastionHost != "" || c.Comm.SSHProxyHost != "") {
+		errs = append(errs, fmt.Errorf("ssh_via_api cannot be combined with ssh_bastion_host or ssh_proxy_host"))
+	}
+	if len(c.MedaHosts) > 0 {
+		if !c.UseAPI.True() {
+			errs = append(errs, fmt.Errorf("meda_hosts requires use_api = true"))
+		}
+		if c.ManageMedaServer || c.APIFallbackToCLI {
+			errs = append(errs, fmt.Errorf("meda_hosts cannot be combined with manage_meda_server or api_fallback_to_cli"))
+		}
+		for _, entry := range c.MedaHosts {
+			if host, _, err := medaHostAddress(entry, c.MedaPort); err != nil {
+				errs = append(errs, fmt.Errorf("meda_hosts: %s", err))
+			} else if host == "" {
+				errs = append(errs, fmt.Errorf("meda_hosts must not contain empty entries"))
+			}
+		}
+	}
+	for _, entry := range c.ReplicateTo {
+		if host, _, err := medaHostAddress(entry, 7777); err != nil {
+			errs = append(errs, fmt.Errorf("replicate_to: %s", err))
+		} else if host == "" {
+			errs = append(errs, fmt.Errorf("replicate_to must not contain empty entries"))
+		}
+	}
+	switch c.MedaHostSelection {
+	case "least-loaded", "round-robin":
+	default:
+		errs = append(errs, fmt.Errorf("meda_host_selection must be least-loaded or round-robin, got %q", c.MedaHostSelection))
+	}
+
+	if c.MedaWorkingDir != "" {
+		if info, err := os.Stat(c.MedaWorkingDir); err != nil || !info.IsDir() {
+			errs = append(errs, fmt.Errorf("meda_working_dir is not a directory: %s", c.MedaWorkingDir))
+		}
+	}
+
+	if c.HeartbeatInterval < 0 {
+		errs = append(errs, fmt.Errorf("heartbeat_interval must not be negative"))
+	}
+	if c.AuditLogFile != "" {
+		// Fail before changing anything rather than act unrecorded
+		f, err := os.OpenFile(c.AuditLogFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("audit_log_file is not writable: %s", err))
+		} else {
+			f.Close()
+		}
+	}
+
+	if c.ExpiresAfter < 0 {
+		errs = append(errs, fmt.Errorf("expires_after must not be negative"))
+	}
+	if c.RegistryRetryBudget < 0 {
+		errs = append(errs, fmt.Errorf("registry_retry_budget must not be negative"))
+	}
+	if c.PushConcurrency < 0 {
+		errs = append(errs, fmt.Errorf("push_concurrency must not be negative"))
+	}
+	seenTags := map[string]bool{c.OutputTag: true}
+	for _, tag := range c.PushTags {
+		if tag == "" || strings.ContainsAny(tag, ":/@ ") {
+			errs = append(errs, fmt.Errorf("push_tags contains an invalid tag %q", tag))
+		} else if seenTags[tag] {
+			errs = append(errs, fmt.Errorf("push_tags contains %q more than once or repeats output_tag", tag))
+		}
+		seenTags[tag] = true
+	}
+	if c.PushToRegistry {
+		tags := append([]string{c.OutputTag}, c.PushTags...)
+		for _, cp := range c.Checkpoints {
+			if c.checkpointRetention(cp.Name) == "push" {
+				tags = append(tags, cp.OutputTag)
+			}
+		}
+		errs = append(errs, validateOCIReference(c.Registry, c.Organization, c.OutputImageName, tags)...)
+	}
+	if c.IOThreads < 0 || c.VirtioQueues < 0 {
+		errs = append(errs, fmt.Errorf("io_threads and virtio_queues must not be negative"))
+	}
+	if c.VirtioQueues > c.provisionCPUs() {
+		errs = append(errs, fmt.Errorf("virtio_queues (%d) must not exceed the CPUs of the build VM (%d)", c.VirtioQueues, c.provisionCPUs()))
+	}
+	if c.CPUAffinity != "" {
+		if cpus, err := parseCPUList(c.CPUAffinity); err != nil {
+			errs = append(errs, fmt.Errorf("cpu_affinity: %s", err))
+		} else if len(cpus) < c.provisionCPUs() {
+			errs = append(errs, fmt.Errorf("cpu_affinity names %d host CPUs, fewer than the %d CPUs of the build VM", len(cpus), c.provisionCPUs()))
+		}
+	}
+	if c.MaxMemory != "" && !c.MemoryBallooning {
+		errs = append(errs, fmt.Errorf("max_memory requires memory_ballooning = true"))
+	}
+	if c.MemoryBallooning {
+		if c.Hugepages {
+			errs = append(errs, fmt.Errorf("memory_ballooning cannot be combined with hugepages, huge pages can't be reclaimed"))
+		}
+		memory, err := parseSize(c.provisionMemory())
+		if err != nil {
+			errs = append(errs, fmt.Errorf("memory: %s", err))
+		}
+		if c.MaxMemory != "" {
+			if max, err := parseSize(c.MaxMemory); err != nil {
+				errs = append(errs, fmt.Errorf("max_memory: %s", err))
+			} else if memory > 0 && max < memory {
+				errs = append(errs, fmt.Errorf("max_memory (%s) must not be less than the memory of the build VM (%s)", c.MaxMemory, c.provisionMemory()))
+			}
+		}
+	}
+	if c.NUMANode != nil && *c.NUMANode < 0 {
+		errs = append(errs, fmt.Errorf("numa_node must not be negative"))
+	}
+	if c.DiskIOLimitMBps < 0 {
+		errs = append(errs, fmt.Errorf("disk_io_limit_mbps must not be negative"))
+	}
+	if c.CPUShares != 0 && (c.CPUShares < 2 || c.CPUShares > 262144) {
+		errs = append(errs, fmt.Errorf("cpu_shares must be between 2 and 262144, got %d", c.CPUShares))
+	}
+	if !findSizePattern.MatchString(c.DiffReportMinFileSize) {
+		errs = append(errs, fmt.Errorf("diff_report_min_file_size must be a size such as 500k, 10M or 1G, got %q", c.DiffReportMinFileSize))
+	}
+	if c.DiffReportFile != "" && c.Comm.Type != "ssh" {
+		errs = append(errs, fmt.Errorf("diff_report_file requires the ssh communicator"))
+	}
+	switch c.CaptureMode {
+	case "stop":
+	case "live-snapshot":
+		if c.resizeBeforeCapture() {
+			errs = append(errs, fmt.Errorf("capture_mode live-snapshot can't be combined with provision_memory or provision_cpus, resizing needs a stopped VM"))
+		}
+		if c.waitsForPowerOff() {
+			errs = append(errs, fmt.Errorf("capture_mode live-snapshot can't be used with communicator none, cloud-init powers the VM off"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("capture_mode must be stop or live-snapshot, got %q", c.CaptureMode))
+	}
+	switch c.FirstBootMethod {
+	case "auto", "systemd", "cloud-init":
+	default:
+		errs = append(errs, fmt.Errorf("first_boot_method must be one of auto, systemd or cloud-init, got %q", c.FirstBootMethod))
+	}
+	for _, script := range c.FirstBootScripts {
+		if info, err := os.Stat(script); err != nil {
+			errs = append(errs, fmt.Errorf("first_boot_scripts: %s", err))
+		} else if info.IsDir() {
+			errs = append(errs, fmt.Errorf("first_boot_scripts: %s is a directory", script))
+		}
+	}
+	if len(c.FirstBootScripts) > 0 && c.Comm.Type != "ssh" {
+		errs = append(errs, fmt.Errorf("first_boot_scripts requires the ssh communicator"))
+	}
+	for _, pkg := range c.Packages {
+		if !packageNamePattern.MatchString(pkg) {
+			errs = append(errs, fmt.Errorf("packages contains an invalid package name %q", pkg))
+		}
+	}
+	if len(c.Packages) > 0 && c.Comm.Type != "ssh" {
+		errs = append(errs, fmt.Errorf("packages requires the ssh communicator"))
+	}
+	if c.AnsibleInventoryFile != "" && c.Comm.Type != "ssh" {
+		errs = append(errs, fmt.Errorf("ansible_inventory_file requires the ssh communicator"))
+	}
+	if c.ProvisionCPUs < 0 {
+		errs = append(errs, fmt.Errorf("provision_cpus must not be negative"))
+	}
+	if c.IPFallbackAfter < 0 {
+		errs = append(errs, fmt.Errorf("ip_fallback_after must not be negative"))
+	}
+	if c.IPCIDRFilter != "" {
+		if _, _, err := net.ParseCIDR(c.IPCIDRFilter); err != nil {
+			errs = append(errs, fmt.Errorf("ip_cidr_filter must be a CIDR such as 10.0.0.0/24, got %q", c.IPCIDRFilter))
+		}
+	}
+	if c.VMStartTimeout < 0 {
+		errs = append(errs, fmt.Errorf("vm_start_timeout must not be negative"))
+	}
+	switch c.FileTransferFallback {
+	case "auto", "always", "never":
+	default:
+		errs = append(errs, fmt.Errorf("file_transfer_fallback must be one of auto, always or never, got %q", c.FileTransferFallback))
+	}
+	if c.SSHReconnectTimeout < 0 {
+		errs = append(errs, fmt.Errorf("ssh_reconnect_timeout must not be negative"))
+	}
+	if c.CloudInitTimeout < 0 {
+		errs = append(errs, fmt.Errorf("cloud_init_timeout must not be negative"))
+	}
+	if c.GuestReadyTimeout < 0 || c.GuestReadyInterval < 0 {
+		errs = append(errs, fmt.Errorf("guest_ready_timeout and guest_ready_interval must not be negative"))
+	}
+	if c.waitsForGuestReady() && c.Comm.Type != "ssh" {
+		errs = append(errs, fmt.Errorf("guest_ready_file and guest_ready_command require the ssh communicator"))
+	}
+	if c.OrphanMaxAge < 0 {
+		errs = append(errs, fmt.Errorf("orphan_max_age must not be negative"))
+	}
+
+	// Check if meda binary exists if not using API. With api_fallback_to_cli
+	// the binary is only looked up if the fallback is actually taken.
+	if (!c.UseAPI.True() || c.ManageMedaServer) && !c.MockMode {
+		if _, err := os.Stat(c.MedaBinary); os.IsNotExist(err) {
+			// Try to find meda in PATH
+			if _, err := exec.LookPath(c.MedaBinary); err != nil {
+				errs = append(errs, fmt.Errorf("meda binary not found: %s", c.MedaBinary))
+			}
+		}
+	}
+
+	if c.Comm.Type == "serial" {
+		if c.Comm.SSHUsername == "" || c.Comm.SSHPassword == "" {
+			errs = append(errs, fmt.Errorf("communicator serial logs in with ssh_username and ssh_password, both must be set"))
+		}
+		if c.UseAPI.True() && !isLoopbackHost(c.MedaHost) {
+			errs = append(errs, fmt.Errorf("communicator serial needs Meda on this host, meda_host is %s", c.MedaHost))
+		}
+		if len(c.MedaHosts) > 0 {
+			errs = append(errs, fmt.Errorf("communicator serial cannot be combined with meda_hosts"))
+		}
+	}
+
+	if c.RegistryCAFile != "" {
+		if _, err := os.Stat(c.RegistryCAFile); err != nil {
+			errs = append(errs, fmt.Errorf("registry_ca_file is not readable: %s", err))
+		}
+	}
+
+	if c.PushCondition != nil {
+		errs = append(errs, c.PushCondition.prepare()...)
+	}
+	if c.VaultAuth != nil {
+		errs = append(errs, c.VaultAuth.prepare()...)
+	}
+	if c.Scan != nil {
+		errs = append(errs, c.Scan.prepare(c)...)
+	}
+	if c.Cirun != nil {
+		if !c.PushToRegistry {
+			errs = append(errs, fmt.Errorf("cirun requires push_to_registry = true"))
+		}
+		errs = append(errs, c.Cirun.prepare()...)
+	}
+	if c.Commands != nil {
+		if c.UseAPI.True() && !c.APIFallbackToCLI {
+			errs = append(errs, fmt.Errorf("commands only applies to the meda CLI, not to use_api"))
+		}
+		errs = append(errs, c.Commands.prepare()...)
+	}
+	if c.ObjectStorageExport != nil {
+		errs = append(errs, c.ObjectStorageExport.prepare(c)...)
+	}
+	if c.OfflineOutput != "" {
+		if c.PushToRegistry {
+			errs = append(errs, fmt.Errorf("offline_output never contacts a registry and cannot be combined with push_to_registry"))
+		}
+		if c.AutoCreateBaseImage.True() {
+			errs = append(errs, fmt.Errorf("offline_output never contacts a registry and cannot be combined with auto_create_base_image = true"))
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, cp := range c.Checkpoints {
+		switch {
+		case !checkpointNamePattern.MatchString(cp.Name):
+			errs = append(errs, fmt.Errorf("checkpoint name %q must only contain letters, digits, '.', '_' and '-'", cp.Name))
+		case seen[cp.Name]:
+			errs = append(errs, fmt.Errorf("duplicate checkpoint name %q", cp.Name))
+		case cp.OutputTag == c.OutputTag:
+			errs = append(errs, fmt.Errorf("checkpoint %q must not use the final output_tag", cp.Name))
+		}
+		switch cp.Retention {
+		case "", "keep", "push", "delete":
+		default:
+			errs = append(errs, fmt.Errorf("checkpoint %q: retention must be keep, push or delete, got %q", cp.Name, cp.Retention))
+		}
+		seen[cp.Name] = true
+	}
+
+	if len(c.Checkpoints) > 0 && c.Comm.Type != "ssh" {
+		errs = append(errs, fmt.Errorf("checkpoint requires the ssh communicator"))
+	}
+	if c.StopAtCheckpoints {
+		if c.Comm.Type != "ssh" {
+			errs = append(errs, fmt.Errorf("stop_at_checkpoints requires the ssh communicator"))
+		}
+		if c.CaptureMode != "stop" {
+			errs = append(errs, fmt.Errorf("stop_at_checkpoints stops the VM and requires capture_mode = \"stop\""))
+		}
+		if c.NonInteractive.True() {
+			errs = append(errs, fmt.Errorf("stop_at_checkpoints waits for enter and cannot be combined with non_interactive"))
+		}
+	}
+
+	seenStages := make(map[string]bool)
+	for i := range c.ProvisionStages {
+		errs = append(errs, c.ProvisionStages[i].prepare()...)
+		if seenStages[c.ProvisionStages[i].Name] {
+			errs = append(errs, fmt.Errorf("duplicate provision_stage name %q", c.ProvisionStages[i].Name))
+		}
+		seenStages[c.ProvisionStages[i].Name] = true
+	}
+	if len(c.ProvisionStages) > 0 && c.Comm.Type != "ssh" {
+		errs = append(errs, fmt.Errorf("provision_stage requires the ssh communicator"))
+	}
+
+	switch c.CheckpointRetention {
+	case "keep", "push", "delete":
+	default:
+		errs = append(errs, fmt.Errorf("checkpoint_retention must be keep, push or delete, got %q", c.CheckpointRetention))
+	}
+
+	if _, err := driver.CompilePatterns(c.PushErrorPatterns); err != nil {
+		errs = append(errs, fmt.Errorf("push_error_patterns: %s", err))
+	}
+	if _, err := driver.CompilePatterns(c.PushWarningPatterns); err != nil {
+		errs = append(errs, fmt.Errorf("push_warning_patterns: %s", err))
+	}
+
+	switch c.CloudInitDatasource {
+	case "", "nocloud", "configdrive", "meda":
+	default:
+		errs = append(errs, fmt.Errorf("cloud_init_datasource must be one of nocloud, configdrive or meda, got %q", c.CloudInitDatasource))
+	}
+	if c.IgnitionFile != "" && c.Butane != "" {
+		errs = append(errs, fmt.Errorf("only one of ignition_file and butane can be set"))
+	}
+	if c.usesIgnition() {
+		for _, opt := range []struct {
+			name string
+			set  bool
+		}{
+			{"user_data_file", c.UserDataFile != ""},
+			{"cloud_init_datasource", c.CloudInitDatasource != ""},
+			{"guest_hostname", c.GuestHostname != ""},
+			{"guest_timezone", c.GuestTimezone != ""},
+			{"ntp_servers", len(c.NTPServers) > 0},
+			{"dns_servers", len(c.DNSServers) > 0},
+			{"dns_search", len(c.DNSSearch) > 0},
+			{"host_entries", len(c.HostEntries) > 0},
+			{"locale", c.Locale != ""},
+			{"keyboard_layout", c.KeyboardLayout != ""},
+		} {
+			if opt.set {
+				errs = append(errs, fmt.Errorf("%s configures cloud-init and cannot be combined with ignition_file or butane", opt.name))
+			}
+		}
+	}
+	if c.MACAddress != "" {
+		if mac, err := net.ParseMAC(c.MACAddress); err != nil || len(mac) != 6 {
+			errs = append(errs, fmt.Errorf("mac_address must be a MAC address such as 52:54:00:12:34:56, got %q", c.MACAddress))
+		}
+	}
+	switch c.NetworkIsolation {
+	case "none", "nat", "isolated":
+	default:
+		errs = append(errs, fmt.Errorf("network_isolation must be one of none, nat or isolated, got %q", c.NetworkIsolation))
+	}
+	if len(c.NetworkAllow) > 0 && c.NetworkIsolation != "isolated" {
+		errs = append(errs, fmt.Errorf("network_allow requires network_isolation = \"isolated\""))
+	}
+	for _, entry := range c.NetworkAllow {
+		if !validNetworkAllowEntry(entry) {
+			errs = append(errs, fmt.Errorf("network_allow entries must be an IP address, CIDR range or hostname with an optional port, got %q", entry))
+		}
+	}
+	if c.GuestHostname != "" && !hostnamePattern.MatchString(c.GuestHostname) {
+		errs = append(errs, fmt.Errorf("guest_hostname must be a valid hostname, got %q", c.GuestHostname))
+	}
+	seenServices := map[string]bool{}
+	for i := range c.Services {
+		errs = append(errs, c.Services[i].prepare()...)
+		if seenServices[c.Services[i].Name] {
+			errs = append(errs, fmt.Errorf("duplicate service name %q", c.Services[i].Name))
+		}
+		seenServices[c.Services[i].Name] = true
+	}
+	for i := range c.Webhooks {
+		errs = append(errs, c.Webhooks[i].prepare()...)
+		for _, v := range c.Webhooks[i].Headers {
+			packer.LogSecretFilter.Set(v)
+		}
+	}
+	seenVolumes := map[string]bool{}
+	for _, volume := range c.AttachVolumes {
+		if volume == "" {
+			errs = append(errs, fmt.Errorf("attach_volumes must not contain empty entries"))
+		} else if seenVolumes[volume] {
+			errs = append(errs, fmt.Errorf("attach_volumes contains %q more than once", volume))
+		}
+		seenVolumes[volume] = true
+	}
+	if strings.ContainsAny(c.GuestTimezone, " \t\n") {
+		errs = append(errs, fmt.Errorf("guest_timezone must be a tz database name such as Etc/UTC, got %q", c.GuestTimezone))
+	}
+	if c.Locale != "" && !localePattern.MatchString(c.Locale) {
+		errs = append(errs, fmt.Errorf("locale must be a locale name such as de_DE.UTF-8, got %q", c.Locale))
+	}
+	if c.KeyboardLayout != "" && !keyboardLayoutPattern.MatchString(c.KeyboardLayout) {
+		errs = append(errs, fmt.Errorf("keyboard_layout must be an XKB layout such as de or us, got %q", c.KeyboardLayout))
+	}
+	for _, server := range c.NTPServers {
+		if server == "" || strings.ContainsAny(server, " \t\n") {
+			errs = append(errs, fmt.Errorf("ntp_servers contains an invalid server %q", server))
+		}
+	}
+	for _, server := range c.DNSServers {
+		if net.ParseIP(server) == nil {
+			errs = append(errs, fmt.Errorf("dns_servers entries must be IP addresses, got %q", server))
+		}
+	}
+	for _, domain := range c.DNSSearch {
+		if !hostnamePattern.MatchString(domain) {
+			errs = append(errs, fmt.Errorf("dns_search entries must be domain names, got %q", domain))
+		}
+	}
+	for hostname, ip := range c.HostEntries {
+		if !hostnamePattern.MatchString(hostname) {
+			errs = append(errs, fmt.Errorf("host_entries contains an invalid hostname %q", hostname))
+		}
+		if net.ParseIP(ip) == nil {
+			errs = append(errs, fmt.Errorf("host_entries: %q must map to an IP address, got %q", hostname, ip))
+		}
+	}
+
+	if c.AttachBuildRecord && !c.PushToRegistry {
+		errs = append(errs, fmt.Errorf("attach_build_record requires push_to_registry = true"))
+	}
+
+	if c.RotateCredentials && c.Comm.Type != "ssh" {
+		errs = append(errs, fmt.Errorf("rotate_credentials requires the ssh communicator"))
+	}
+	if c.TemporarySSHUser && c.Comm.Type != "ssh" {
+		errs = append(errs, fmt.Errorf("temporary_ssh_user requires the ssh communicator"))
+	}
+	if c.TemporarySSHUser && c.RotateCredentials {
+		errs = append(errs, fmt.Errorf("temporary_ssh_user and rotate_credentials cannot be combined"))
+	}
+	if c.SSHTemporaryKeyPath == "" && c.Comm.SSHKeyPairName != "" {
+		if strings.ContainsAny(c.Comm.SSHKeyPairName, `/\`) || c.Comm.SSHKeyPairName == "." || c.Comm.SSHKeyPairName == ".." {
+			errs = append(errs, fmt.Errorf("ssh_keypair_name must not contain path separators, got %q", c.Comm.SSHKeyPairName))
+		} else if path, err := sshKeyCachePath(c.Comm.SSHKeyPairName); err != nil {
+			errs = append(errs, fmt.Errorf("ssh_keypair_name: %s", err))
+		} else {
+			c.SSHTemporaryKeyPath = path
+		}
+	}
+	if c.SSHTemporaryKeyPath != "" {
+		switch {
+		case c.Comm.Type != "ssh":
+			errs = append(errs, fmt.Errorf("ssh_temporary_key_path requires the ssh communicator"))
+		case c.Comm.SSHPrivateKeyFile != "":
+			errs = append(errs, fmt.Errorf("ssh_temporary_key_path and ssh_private_key_file cannot be combined"))
+		case c.TemporarySSHUser:
+			errs = append(errs, fmt.Errorf("ssh_temporary_key_path and temporary_ssh_user cannot be combined"))
+		case c.usesIgnition():
+			errs = append(errs, fmt.Errorf("ssh_temporary_key_path is not supported with ignition_file or butane"))
+		case c.VaultAuth != nil && c.VaultAuth.SSHPrivateKey != "":
+			errs = append(errs, fmt.Errorf("ssh_temporary_key_path and vault.ssh_private_key cannot be combined"))
+		}
+	}
+	if c.DisablePasswordAuth && !c.RotateCredentials {
+		errs = append(errs, fmt.Errorf("disable_password_auth requires rotate_credentials = true"))
+	}
+
+	// SSH tuning; guests may take a while to accept connections, and agent
+	// forwarding stays off unless explicitly requested
+	if c.Comm.SSHHandshakeAttempts == 0 {
+		c.Comm.SSHHandshakeAttempts = 10
+	}
+	if c.Comm.SSHKeepAliveInterval == 0 {
+		c.Comm.SSHKeepAliveInterval = 5 * time.Second
+	}
+	c.Comm.SSHDisableAgentForwarding = !c.SSHAgentForwarding
+
+	// SSH host will be set dynamically in the step
+
+	if len(errs) > 0 {
+		return fmt.Errorf("validation errors: %v", errs)
+	}
+
+	return nil
+}
@@ -0,0 +1,202 @@
+package meda
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testConfig returns the smallest template Prepare accepts. use_api avoids
+// looking up the meda binary.
+func testConfig() map[string]interface{} {
+	return map[string]interface{}{
+		"vm_name":           "packer-test",
+		"base_image":        "ubuntu:latest",
+		"output_image_name": "test-image",
+		"use_api":           true,
+	}
+}
+
+// isolateSettings keeps the settings file and MEDA_* variables of the
+// machine running the tests out of Prepare
+func isolateSettings(t *testing.T) {
+	t.Helper()
+	t.Setenv("PACKER_MEDA_CONFIG", filepath.Join(t.TempDir(), "missing.hcl"))
+	t.Setenv("PACKER_MEDA_PROFILE", "")
+	for _, name := range []string{"MEDA_BINARY", "MEDA_HOST", "MEDA_PORT", "MEDA_REGISTRY", "MEDA_ORG"} {
+		t.Setenv(name, "")
+	}
+}
+
+func TestConfigPrepare_defaultCommunicator(t *testing.T) {
+	isolateSettings(t)
+
+	script := filepath.Join(t.TempDir(), "first-boot.sh")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// Options that require the ssh communicator must accept templates
+	// without a communicator key, ssh is the default
+	tests := map[string]map[string]interface{}{
+		"no options":             {},
+		"packages":               {"packages": []string{"curl"}},
+		"ansible_inventory_file": {"ansible_inventory_file": "inventory.ini"},
+		"first_boot_scripts":     {"first_boot_scripts": []string{script}},
+		"ssh_via_api":            {"ssh_via_api": true},
+		"guest_ready_file":       {"guest_ready_file": "/run/ready"},
+		"diff_report_file":       {"diff_report_file": "diff.txt"},
+	}
+
+	for name, options := range tests {
+		t.Run(name, func(t *testing.T) {
+			raw := testConfig()
+			for k, v := range options {
+				raw[k] = v
+			}
+
+			var c Config
+			if err := c.Prepare(raw); err != nil {
+				t.Fatalf("Prepare: %s", err)
+			}
+			if c.Comm.Type != "ssh" {
+				t.Errorf("communicator = %q, want ssh", c.Comm.Type)
+			}
+		})
+	}
+}
+
+func TestConfigPrepare_sshOnlyOptionsRejectNone(t *testing.T) {
+	isolateSettings(t)
+
+	for _, key := range []string{"ansible_inventory_file", "diff_report_file", "guest_ready_file"} {
+		t.Run(key, func(t *testing.T) {
+			raw := testConfig()
+			raw["communicator"] = "none"
+			raw[key] = "value"
+
+			var c Config
+			if err := c.Prepare(raw); err == nil {
+				t.Fatalf("Prepare accepted %s with communicator none", key)
+			}
+		})
+	}
+}
+
+// Connection settings come from the template, then MEDA_* variables, then
+// the settings file, then the built-in defaults
+func TestConfigPrepare_settingsPrecedence(t *testing.T) {
+	settings := []byte(`
+meda_host = "settings.example.com"
+meda_port = 7001
+registry  = "registry.settings.example.com"
+`)
+	env := map[string]string{
+		"MEDA_HOST":     "env.example.com",
+		"MEDA_PORT":     "7002",
+		"MEDA_REGISTRY": "registry.env.example.com",
+	}
+	template := map[string]interface{}{
+		"meda_host": "template.example.com",
+		"meda_port": 7003,
+		"registry":  "registry.template.example.com",
+	}
+
+	tests := []struct {
+		name                    string
+		template, env, settings bool
+		wantHost, wantRegistry  string
+		wantPort                int
+	}{
+		{"defaults", false, false, false, "127.0.0.1", "ghcr.io", 7777},
+		{"settings over defaults", false, false, true, "settings.example.com", "registry.settings.example.com", 7001},
+		{"env over defaults", false, true, false, "env.example.com", "registry.env.example.com", 7002},
+		{"env over settings", false, true, true, "env.example.com", "registry.env.example.com", 7002},
+		{"template over settings", true, false, true, "template.example.com", "registry.template.example.com", 7003},
+		{"template over env", true, true, false, "template.example.com", "registry.template.example.com", 7003},
+		{"template over env and settings", true, true, true, "template.example.com", "registry.template.example.com", 7003},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			isolateSettings(t)
+			if tt.settings {
+				path := filepath.Join(t.TempDir(), "config.hcl")
+				if err := os.WriteFile(path, settings, 0644); err != nil {
+					t.Fatal(err)
+				}
+				t.Setenv("PACKER_MEDA_CONFIG", path)
+			}
+			if tt.env {
+				for k, v := range env {
+					t.Setenv(k, v)
+				}
+			}
+			raw := testConfig()
+			if tt.template {
+				for k, v := range template {
+					raw[k] = v
+				}
+			}
+
+			var c Config
+			if err := c.Prepare(raw); err != nil {
+				t.Fatalf("Prepare: %s", err)
+			}
+			if c.MedaHost != tt.wantHost {
+				t.Errorf("meda_host = %q, want %q", c.MedaHost, tt.wantHost)
+			}
+			if c.MedaPort != tt.wantPort {
+				t.Errorf("meda_port = %d, want %d", c.MedaPort, tt.wantPort)
+			}
+			if c.Registry != tt.wantRegistry {
+				t.Errorf("registry = %q, want %q", c.Registry, tt.wantRegistry)
+			}
+		})
+	}
+}
+
+// An explicit false in the template is a value, the settings file must not
+// turn it on
+func TestConfigPrepare_settingsDoNotOverrideExplicitFalse(t *testing.T) {
+	isolateSettings(t)
+	path := filepath.Join(t.TempDir(), "config.hcl")
+	settings := []byte("use_api = true\nregistry_insecure = true\n")
+	if err := os.WriteFile(path, settings, 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PACKER_MEDA_CONFIG", path)
+
+	tests := map[string]struct {
+		options      map[string]interface{}
+		wantAPI      bool
+		wantInsecure bool
+	}{
+		"unset":          {map[string]interface{}{}, true, true},
+		"explicit false": {map[string]interface{}{"use_api": false, "registry_insecure": false}, false, false},
+		"explicit true":  {map[string]interface{}{"use_api": true, "registry_insecure": true}, true, true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			raw := testConfig()
+			delete(raw, "use_api")
+			// The CLI is looked up without use_api
+			raw["meda_binary"] = "/bin/sh"
+			for k, v := range tt.options {
+				raw[k] = v
+			}
+
+			var c Config
+			if err := c.Prepare(raw); err != nil {
+				t.Fatalf("Prepare: %s", err)
+			}
+			if c.UseAPI.True() != tt.wantAPI {
+				t.Errorf("use_api = %v, want %v", c.UseAPI.True(), tt.wantAPI)
+			}
+			if c.RegistryInsecure.True() != tt.wantInsecure {
+				t.Errorf("registry_insecure = %v, want %v", c.RegistryInsecure.True(), tt.wantInsecure)
+			}
+		})
+	}
+}
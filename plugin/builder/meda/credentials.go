@@ -0,0 +1,71 @@
+package meda
+
+import (
+	"fmt"
+)
+
+// CredentialProfile holds the default communicator credentials and
+// user-data for a guest OS family
+type CredentialProfile struct {
+	// Name is matched against guest_os
+	Name         string `mapstructure:"name" required:"true"`
+	SSHUsername  string `mapstructure:"ssh_username"`
+	SSHPassword  string `mapstructure:"ssh_password"`
+	UserDataFile string `mapstructure:"user_data_file"`
+
+	// createUser adds ssh_username with ssh_password through user-data.
+	// Stock cloud images only have a default user with a locked password.
+	createUser bool
+}
+
+// builtinCredentialProfiles are the profiles selectable with guest_os
+// without defining them in the template. "cirun" matches the Meda images
+// published by Cirun and is the default. The others are for stock cloud
+// images and create their user on first boot.
+var builtinCredentialProfiles = map[string]CredentialProfile{
+	"cirun":  {Name: "cirun", SSHUsername: "cirun", SSHPassword: "cirun"},
+	"ubuntu": {Name: "ubuntu", SSHUsername: "ubuntu", SSHPassword: "ubuntu", createUser: true},
+	"debian": {Name: "debian", SSHUsername: "debian", SSHPassword: "debian", createUser: true},
+	"alpine": {Name: "alpine", SSHUsername: "alpine", SSHPassword: "alpine", createUser: true},
+	// custom provides no defaults, everything comes from the template
+	"custom": {Name: "custom"},
+}
+
+// credentialProfile resolves guest_os to a profile. Profiles defined in the
+// template take precedence over the built-in ones.
+func (c *Config) credentialProfile() (CredentialProfile, error) {
+	for _, p := range c.CredentialProfiles {
+		if p.Name == c.GuestOS {
+			return p, nil
+		}
+	}
+	if p, ok := builtinCredentialProfiles[c.GuestOS]; ok {
+		return p, nil
+	}
+	return CredentialProfile{}, fmt.Errorf("unknown guest_os %q: use one of cirun, ubuntu, debian, alpine, custom or define a credential_profile block", c.GuestOS)
+}
+
+// applyCredentialProfile fills unset SSH credentials and user-data from the
+// selected profile
+func (c *Config) applyCredentialProfile() error {
+	profile, err := c.credentialProfile()
+	if err != nil {
+		return err
+	}
+
+	if c.Comm.SSHUsername == "" {
+		c.Comm.SSHUsername = profile.SSHUsername
+	}
+	if c.Comm.SSHPassword == "" {
+		c.Comm.SSHPassword = profile.SSHPassword
+	}
+	if c.UserDataFile == "" {
+		c.UserDataFile = profile.UserDataFile
+	}
+	c.createSSHUser = profile.createUser && c.Comm.SSHPassword != ""
+
+	if c.Comm.Type == "ssh" && c.Comm.SSHUsername == "" {
+		return fmt.Errorf("ssh_username is required for guest_os %q", c.GuestOS)
+	}
+	return nil
+}
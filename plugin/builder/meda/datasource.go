@@ -0,0 +1,110 @@
+// Code generation: packer-sdc mapstructure-to-hcl2 -type DatasourceConfig,DatasourceOutput,DatasourceVM
+// Generated file: datasource.hcl2spec.go
+
+package meda
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cirunlabs/packer-plugin-meda/driver"
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/hashicorp/packer-plugin-sdk/hcl2helper"
+	"github.com/hashicorp/packer-plugin-sdk/template/config"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// DatasourceConfig configures the meda-vms data source
+type DatasourceConfig struct {
+	// Meda configuration, same meaning and defaults as for the builder
+	MedaBinary     string            `mapstructure:"meda_binary"`
+	MedaHost       string            `mapstructure:"meda_host"`
+	MedaPort       int               `mapstructure:"meda_port"`
+	UseAPI         bool              `mapstructure:"use_api"`
+	MedaEnv        map[string]string `mapstructure:"meda_env"`
+	MedaWorkingDir string            `mapstructure:"meda_working_dir"`
+
+	// Only return VMs whose name starts with this prefix
+	NamePrefix string `mapstructure:"name_prefix"`
+}
+
+// DatasourceVM is a single VM in the data source output
+type DatasourceVM struct {
+	Name  string `mapstructure:"name"`
+	State string `mapstructure:"state"`
+	IP    string `mapstructure:"ip"`
+	Image string `mapstructure:"image"`
+}
+
+// DatasourceOutput is the value exposed as data.meda-vms.<name>
+type DatasourceOutput struct {
+	VMs   []DatasourceVM `mapstructure:"vms"`
+	Names []string       `mapstructure:"names"`
+}
+
+// Datasource lists the VMs currently defined in Meda
+type Datasource struct {
+	config DatasourceConfig
+}
+
+func (d *Datasource) ConfigSpec() hcldec.ObjectSpec {
+	return d.config.FlatMapstructure().HCL2Spec()
+}
+
+func (d *Datasource) Configure(raws ...interface{}) error {
+	if err := config.Decode(&d.config, nil, raws...); err != nil {
+		return err
+	}
+
+	if d.config.MedaBinary == "" {
+		d.config.MedaBinary = "meda"
+	}
+	if d.config.MedaHost == "" {
+		d.config.MedaHost = "127.0.0.1"
+	}
+	if d.config.MedaPort == 0 {
+		d.config.MedaPort = 7777
+	}
+
+	return nil
+}
+
+func (d *Datasource) OutputSpec() hcldec.ObjectSpec {
+	return (&DatasourceOutput{}).FlatMapstructure().HCL2Spec()
+}
+
+func (d *Datasource) Execute() (cty.Value, error) {
+	driver := driver.NewDriver(&driver.Config{
+		MedaBinary:     d.config.MedaBinary,
+		MedaHost:       d.config.MedaHost,
+		MedaPort:       d.config.MedaPort,
+		UseAPI:         d.config.UseAPI,
+		MedaEnv:        d.config.MedaEnv,
+		MedaWorkingDir: d.config.MedaWorkingDir,
+	}, nil)
+
+	output := DatasourceOutput{
+		VMs:   []DatasourceVM{},
+		Names: []string{},
+	}
+
+	vms, err := driver.ListVMs()
+	if err != nil {
+		return cty.NullVal(cty.EmptyObject), fmt.Errorf("failed to list Meda VMs: %s", err)
+	}
+
+	for _, vm := range vms {
+		if !strings.HasPrefix(vm.Name, d.config.NamePrefix) {
+			continue
+		}
+		output.VMs = append(output.VMs, DatasourceVM{
+			Name:  vm.Name,
+			State: vm.State,
+			IP:    vm.IP,
+			Image: vm.Image,
+		})
+		output.Names = append(output.Names, vm.Name)
+	}
+
+	return hcl2helper.HCL2ValueFromConfig(output, d.OutputSpec()), nil
+}
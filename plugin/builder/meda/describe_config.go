@@ -0,0 +1,270 @@
+package meda
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cirunlabs/packer-plugin-meda/version"
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/hashicorp/packer-plugin-sdk/template/config"
+)
+
+// configSchema is the output of the describe-config command
+type configSchema struct {
+	PluginVersion string            `json:"plugin_version"`
+	Components    []componentSchema `json:"components"`
+}
+
+// componentSchema describes the configuration of one plugin component
+type componentSchema struct {
+	Kind    string        `json:"kind"`
+	Name    string        `json:"name"`
+	Aliases []string      `json:"aliases,omitempty"`
+	Fields  []fieldSchema `json:"fields"`
+}
+
+// fieldSchema describes one attribute or block. Type is the HCL type,
+// with duration for strings parsed as Go durations, or block and list of
+// block for nested blocks described by Fields.
+type fieldSchema struct {
+	Name     string        `json:"name"`
+	Type     string        `json:"type"`
+	Required bool          `json:"required,omitempty"`
+	Default  interface{}   `json:"default,omitempty"`
+	Fields   []fieldSchema `json:"fields,omitempty"`
+}
+
+// describedComponent is a plugin component, its configuration and the
+// function filling in the defaults
+type describedComponent struct {
+	kind, name string
+	spec       hcldec.ObjectSpec
+	config     interface{}
+	prepare    func(raws ...interface{}) error
+}
+
+// describedComponents returns the components of Components with their
+// configuration
+func describedComponents() []describedComponent {
+	builder := new(Builder)
+	datasource := new(Datasource)
+	provisioner := new(ExecProvisioner)
+	checkpoint := new(CheckpointProvisioner)
+	postProcessor := new(CloudImportPostProcessor)
+	prune := new(PrunePostProcessor)
+
+	return []describedComponent{
+		{
+			kind: "builder", name: "meda-vm",
+			spec: builder.ConfigSpec(), config: &builder.config,
+			prepare: func(raws ...interface{}) error {
+				_, _, err := builder.Prepare(raws...)
+				return err
+			},
+		},
+		{
+			kind: "data-source", name: "meda-vms",
+			spec: datasource.ConfigSpec(), config: &datasource.config,
+			prepare: datasource.Configure,
+		},
+		{
+			kind: "provisioner", name: "meda-exec",
+			spec: provisioner.ConfigSpec(), config: &provisioner.config,
+			prepare: provisioner.Prepare,
+		},
+		{
+			kind: "provisioner", name: "meda-checkpoint",
+			spec: checkpoint.ConfigSpec(), config: &checkpoint.config,
+			prepare: checkpoint.Prepare,
+		},
+		{
+			kind: "post-processor", name: "meda-cloud-import",
+			spec: postProcessor.ConfigSpec(), config: &postProcessor.config,
+			prepare: postProcessor.Configure,
+		},
+		{
+			kind: "post-processor", name: "meda-prune",
+			spec: prune.ConfigSpec(), config: &prune.config,
+			prepare: prune.Configure,
+		},
+	}
+}
+
+// isolateEnvironment keeps the MEDA_* variables and the shared settings
+// file of this host out of the described defaults. It returns a function
+// removing the empty directory the settings file is looked up in.
+func isolateEnvironment() (func(), error) {
+	for _, kv := range os.Environ() {
+		if name, _, _ := strings.Cut(kv, "="); strings.HasPrefix(name, "MEDA_") || name == "CI" {
+			os.Unsetenv(name)
+		}
+	}
+	dir, err := os.MkdirTemp("", "packer-meda-describe")
+	if err != nil {
+		return nil, err
+	}
+	os.Setenv("PACKER_MEDA_CONFIG", filepath.Join(dir, "config.hcl"))
+	return func() { os.RemoveAll(dir) }, nil
+}
+
+// describeComponent prepares an empty configuration of c and describes
+// every field of its HCL spec
+func describeComponent(c describedComponent) componentSchema {
+	// Defaults are filled in before validating, so the errors about
+	// required fields, or meda missing on this host, don't matter here
+	_ = c.prepare(map[string]interface{}{})
+	fields := describeFields(c.spec, reflect.ValueOf(c.config).Elem(), true)
+	var aliases []string
+	for _, registered := range Components {
+		if registered.Kind == c.kind && templateName(registered.Name) == c.name {
+			for _, alias := range registered.Aliases {
+				aliases = append(aliases, templateName(alias))
+			}
+		}
+	}
+	return componentSchema{Kind: c.kind, Name: c.name, Aliases: aliases, Fields: fields}
+}
+
+// describeFields describes the fields of spec, looking up their Go types
+// and required tags on v. Defaults are only read at the top level, blocks
+// get theirs per instance.
+func describeFields(spec hcldec.ObjectSpec, v reflect.Value, withDefaults bool) []fieldSchema {
+	structFields := mapstructureFields(v)
+
+	var fields []fieldSchema
+	for name, s := range spec {
+		f := fieldSchema{Name: name}
+		sv, ok := structFields[name]
+		if ok {
+			f.Required = sv.field.Tag.Get("required") == "true"
+		}
+
+		switch s := s.(type) {
+		case *hcldec.BlockSpec:
+			f.Type = "block"
+			f.Fields = describeFields(s.Nested.(hcldec.ObjectSpec), reflect.New(blockType(sv.value.Type())).Elem(), false)
+		case *hcldec.BlockListSpec:
+			f.Type = "list of block"
+			f.Fields = describeFields(s.Nested.(hcldec.ObjectSpec), reflect.New(blockType(sv.value.Type())).Elem(), false)
+		case *hcldec.AttrSpec:
+			f.Type = s.Type.FriendlyNameForConstraint()
+			if ok && sv.value.Type() == reflect.TypeOf(time.Duration(0)) {
+				f.Type = "duration"
+			}
+			if ok && withDefaults && !f.Required {
+				f.Default = defaultValue(sv.value)
+			}
+		default:
+			f.Type = "unknown"
+		}
+		fields = append(fields, f)
+	}
+
+	sort.Slice(fields, func(i, j int) bool { return fields[i].Name < fields[j].Name })
+	return fields
+}
+
+// structField is a field of a config struct and its value
+type structField struct {
+	field reflect.StructField
+	value reflect.Value
+}
+
+// mapstructureFields returns the fields of the struct v by mapstructure
+// name, descending into squashed embedded structs
+func mapstructureFields(v reflect.Value) map[string]structField {
+	fields := map[string]structField{}
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(field.Tag.Get("mapstructure"), ",")
+		if strings.Contains(opts, "squash") {
+			for name, f := range mapstructureFields(v.Field(i)) {
+				fields[name] = f
+			}
+			continue
+		}
+		if name != "" && name != "-" {
+			fields[name] = structField{field: field, value: v.Field(i)}
+		}
+	}
+	return fields
+}
+
+// blockType returns the struct type behind a block field
+func blockType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	return t
+}
+
+// defaultValue returns the JSON value of a prepared field, or nil when
+// the field was left unset
+func defaultValue(v reflect.Value) interface{} {
+	if v.IsZero() {
+		return nil
+	}
+	switch value := v.Interface().(type) {
+	case time.Duration:
+		return value.String()
+	case config.Trilean:
+		return value.True()
+	}
+	if v.Kind() == reflect.Slice && v.Len() == 0 {
+		return nil
+	}
+	return v.Interface()
+}
+
+// runDescribeConfig implements the describe-config command, printing the
+// configuration schema of the plugin components as JSON
+func runDescribeConfig(args []string, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet("describe-config", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: packer-plugin-meda describe-config [options]")
+		fmt.Fprintln(stderr, "\nPrints the configuration schema of the plugin components as JSON.")
+		fmt.Fprintln(stderr, "\nOptions:")
+		flags.PrintDefaults()
+	}
+	component := flags.String("component", "", "only describe this component, e.g. meda-vm")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return fmt.Errorf("unexpected arguments: %s", strings.Join(flags.Args(), " "))
+	}
+
+	cleanup, err := isolateEnvironment()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	schema := configSchema{PluginVersion: version.Version}
+	for _, c := range describedComponents() {
+		if *component != "" && c.name != *component {
+			continue
+		}
+		schema.Components = append(schema.Components, describeComponent(c))
+	}
+	if len(schema.Components) == 0 {
+		return fmt.Errorf("unknown component %q", *component)
+	}
+
+	encoder := json.NewEncoder(stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(schema)
+}
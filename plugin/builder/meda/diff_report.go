@@ -0,0 +1,184 @@
+package meda
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cirunlabs/packer-plugin-meda/driver"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// findSizePattern matches the file sizes accepted by diff_report_min_file_size,
+// in find -size syntax
+var findSizePattern = regexp.MustCompile(`^[1-9][0-9]*[kMG]$`)
+
+// Section markers of the manifest collection output
+const (
+	manifestPackagesMarker = "## packages"
+	manifestFilesMarker    = "## files"
+)
+
+// imageManifest is the state of the guest the diff report compares:
+// installed packages by name and large files by path
+type imageManifest struct {
+	Packages map[string]string
+	Files    map[string]int64
+}
+
+// manifestCommand returns the guest command listing installed packages
+// and regular files of at least minSize on the root filesystem
+func manifestCommand(sudo, minSize string) string {
+	return strings.Join([]string{
+		"echo '" + manifestPackagesMarker + "'",
+		"if command -v dpkg-query >/dev/null 2>&1; then dpkg-query -W -f='${Package} ${Version}\\n';" +
+			" elif command -v rpm >/dev/null 2>&1; then rpm -qa --qf '%{NAME} %{VERSION}-%{RELEASE}\\n';" +
+			" elif command -v apk >/dev/null 2>&1; then apk info -v; fi",
+		"echo '" + manifestFilesMarker + "'",
+		sudo + "find / -xdev -type f -size +" + minSize + " -printf '%s %p\\n' 2>/dev/null || true",
+	}, "; ")
+}
+
+// parseManifest parses the output of manifestCommand
+func parseManifest(output string) *imageManifest {
+	m := &imageManifest{Packages: map[string]string{}, Files: map[string]int64{}}
+	section := ""
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "":
+		case line == manifestPackagesMarker || line == manifestFilesMarker:
+			section = line
+		case section == manifestPackagesMarker:
+			name, version, _ := strings.Cut(line, " ")
+			m.Packages[name] = version
+		case section == manifestFilesMarker:
+			size, path, ok := strings.Cut(line, " ")
+			if n, err := strconv.ParseInt(size, 10, 64); ok && err == nil {
+				m.Files[path] = n
+			}
+		}
+	}
+	return m
+}
+
+// diffReport renders the changes between the manifests before and after
+// provisioning as Markdown. It also returns a one-line summary.
+func diffReport(image, baseImage, minSize string, before, after *imageManifest) (report, summary string) {
+	var added, removed, changed, files []string
+
+	for _, name := range sortedKeys(after.Packages) {
+		version := after.Packages[name]
+		old, existed := before.Packages[name]
+		switch {
+		case !existed:
+			added = append(added, fmt.Sprintf("- %s %s", name, version))
+		case old != version:
+			changed = append(changed, fmt.Sprintf("- %s %s → %s", name, old, version))
+		}
+	}
+	for _, name := range sortedKeys(before.Packages) {
+		if _, ok := after.Packages[name]; !ok {
+			removed = append(removed, fmt.Sprintf("- %s %s", name, before.Packages[name]))
+		}
+	}
+
+	// Largest first, a new file or one that grew
+	var paths []string
+	for path, size := range after.Files {
+		if old, ok := before.Files[path]; !ok || size > old {
+			paths = append(paths, path)
+		}
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		if after.Files[paths[i]] != after.Files[paths[j]] {
+			return after.Files[paths[i]] > after.Files[paths[j]]
+		}
+		return paths[i] < paths[j]
+	})
+	for _, path := range paths {
+		line := fmt.Sprintf("- `%s` %s", path, driver.FormatBytes(after.Files[path]))
+		if old, ok := before.Files[path]; ok {
+			line += fmt.Sprintf(" (was %s)", driver.FormatBytes(old))
+		}
+		files = append(files, line)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Changes in %s\n\nCompared to base image `%s`.\n", image, baseImage)
+	section := func(title string, lines []string) {
+		fmt.Fprintf(&b, "\n## %s (%d)\n\n", title, len(lines))
+		if len(lines) == 0 {
+			b.WriteString("None\n")
+			return
+		}
+		b.WriteString(strings.Join(lines, "\n") + "\n")
+	}
+	section("Added packages", added)
+	section("Removed packages", removed)
+	section("Changed packages", changed)
+	section("New or grown files of "+minSize+" or more", files)
+
+	summary = fmt.Sprintf("%d packages added, %d removed, %d changed, %d large files new or grown",
+		len(added), len(removed), len(changed), len(files))
+	return b.String(), summary
+}
+
+// stepCollectManifest records the packages and large files of the guest
+// in the state under key, before and after provisioning
+type stepCollectManifest struct {
+	key string
+}
+
+func (s *stepCollectManifest) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	config := state.Get("config").(*Config)
+	comm := state.Get("communicator").(packer.Communicator)
+	ui := state.Get("ui").(packer.Ui)
+
+	ui.Say("Collecting package and file manifest for the diff report")
+	output, err := runRemote(ctx, comm, manifestCommand(sudoPrefix(config.Comm.SSHUsername), config.DiffReportMinFileSize))
+	if err != nil {
+		err := fmt.Errorf("failed to collect manifest: %s", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+	state.Put(s.key, parseManifest(output))
+	return multistep.ActionContinue
+}
+
+func (s *stepCollectManifest) Cleanup(state multistep.StateBag) {}
+
+// stepWriteDiffReport writes the diff report once the image is captured
+type stepWriteDiffReport struct{}
+
+func (s *stepWriteDiffReport) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	config := state.Get("config").(*Config)
+	ui := state.Get("ui").(packer.Ui)
+
+	before := state.Get("manifest_before").(*imageManifest)
+	after := state.Get("manifest_after").(*imageManifest)
+	image := config.OutputImageName + ":" + config.OutputTag
+	report, summary := diffReport(image, config.BaseImage, config.DiffReportMinFileSize, before, after)
+
+	err := os.MkdirAll(filepath.Dir(config.DiffReportFile), 0755)
+	if err == nil {
+		err = os.WriteFile(config.DiffReportFile, []byte(report), 0644)
+	}
+	if err != nil {
+		ui.Say(fmt.Sprintf("Warning: failed to write diff report: %s", err))
+		return multistep.ActionContinue
+	}
+
+	ui.Say(fmt.Sprintf("Image changes: %s (report: %s)", summary, config.DiffReportFile))
+	appendGitHubFile("GITHUB_STEP_SUMMARY", fmt.Sprintf("### Image changes\n\n%s (report: `%s`)\n\n", summary, config.DiffReportFile))
+	return multistep.ActionContinue
+}
+
+func (s *stepWriteDiffReport) Cleanup(state multistep.StateBag) {}
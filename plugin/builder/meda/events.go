@@ -0,0 +1,90 @@
+package meda
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// stepName returns a readable name for step, looking through the wrappers
+// of this package
+func stepName(step multistep.Step) string {
+	if wrapper, ok := step.(multistep.StepWrapper); ok {
+		return wrapper.InnerStepName()
+	}
+	name := fmt.Sprintf("%T", step)
+	return name[strings.LastIndex(name, ".")+1:]
+}
+
+// stepEvents wraps a step and reports its start and outcome as
+// machine-readable "meda-step" events, shown with -machine-readable:
+//
+//	meda-step,<step>,started
+//	meda-step,<step>,finished|failed|cancelled,<seconds>
+type stepEvents struct {
+	multistep.Step
+}
+
+// withEvents wraps every step that will run with stepEvents
+func withEvents(steps []multistep.Step) []multistep.Step {
+	wrapped := make([]multistep.Step, 0, len(steps))
+	for _, step := range steps {
+		if stepName(step) == "nullStep" {
+			wrapped = append(wrapped, step)
+			continue
+		}
+		wrapped = append(wrapped, &stepEvents{Step: step})
+	}
+	return wrapped
+}
+
+func (s *stepEvents) InnerStepName() string {
+	return stepName(s.Step)
+}
+
+func (s *stepEvents) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	ui := state.Get("ui").(packer.Ui)
+	name := s.InnerStepName()
+
+	ui.Machine("meda-step", name, "started")
+	started := time.Now()
+
+	action := s.Step.Run(ctx, state)
+
+	outcome := "finished"
+	if _, ok := state.GetOk("error"); ok {
+		outcome = "failed"
+	} else if action == multistep.ActionHalt {
+		outcome = "cancelled"
+	}
+	ui.Machine("meda-step", name, outcome, strconv.FormatFloat(time.Since(started).Seconds(), 'f', 1, 64))
+	return action
+}
+
+// reportArtifactEvents emits one "meda-artifact" event per produced image
+func reportArtifactEvents(ui packer.Ui, a *Artifact) {
+	ui.Machine("meda-artifact", "image", a.ImageName)
+	if digest, _ := a.State("digest").(string); digest != "" {
+		ui.Machine("meda-artifact", "digest", digest)
+	}
+	if a.PushedImage != "" {
+		ui.Machine("meda-artifact", "pushed_image", a.PushedImage)
+	}
+	if a.ObjectStorageURL != "" {
+		ui.Machine("meda-artifact", "object_storage_url", a.ObjectStorageURL)
+	}
+	if a.OfflineOutput != "" {
+		ui.Machine("meda-artifact", "offline_output", a.OfflineOutput)
+	}
+	for _, host := range a.ReplicatedTo {
+		ui.Machine("meda-artifact", "replicated_to", host)
+	}
+	for _, cp := range a.Checkpoints {
+		ui.Machine("meda-artifact", "checkpoint", cp.Name, cp.Image)
+	}
+}
@@ -0,0 +1,148 @@
+package meda
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// Guest paths of the systemd first-boot runner
+const (
+	firstBootDir     = "/usr/local/lib/meda-first-boot"
+	firstBootDone    = "/var/lib/meda-first-boot/done"
+	firstBootUnit    = "/etc/systemd/system/meda-first-boot.service"
+	firstBootStaging = "/tmp/meda-first-boot"
+	// cloud-init runs these once per instance ID, i.e. on every clone
+	cloudInitPerInstanceDir = "/var/lib/cloud/scripts/per-instance"
+)
+
+// firstBootRunner runs the installed scripts in order and marks the first
+// boot as done once all of them succeeded
+const firstBootRunner = `#!/bin/sh
+set -e
+for script in ` + firstBootDir + `/scripts.d/*; do
+  [ -x "$script" ] || continue
+  echo "Running $script"
+  "$script"
+done
+mkdir -p ` + "$(dirname " + firstBootDone + ")" + `
+touch ` + firstBootDone + `
+`
+
+const firstBootUnitFile = `[Unit]
+Description=Meda first boot initialization
+Wants=network-online.target
+After=network-online.target
+ConditionPathExists=!` + firstBootDone + `
+
+[Service]
+Type=oneshot
+RemainAfterExit=yes
+ExecStart=` + firstBootDir + `/run
+
+[Install]
+WantedBy=multi-user.target
+`
+
+// firstBootScriptName returns the guest file name of the i-th script. The
+// index prefix keeps the configured order.
+func firstBootScriptName(i int, path string) string {
+	return fmt.Sprintf("%02d-%s", i+1, filepath.Base(path))
+}
+
+// stepInstallFirstBootScripts installs first_boot_scripts into the guest
+// so that they run on the first boot of every VM created from the image,
+// not during the build
+type stepInstallFirstBootScripts struct{}
+
+func (s *stepInstallFirstBootScripts) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	config := state.Get("config").(*Config)
+	comm := state.Get("communicator").(packer.Communicator)
+	ui := state.Get("ui").(packer.Ui)
+	sudo := sudoPrefix(config.Comm.SSHUsername)
+
+	halt := func(err error) multistep.StepAction {
+		err = fmt.Errorf("failed to install first boot scripts: %s", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	method := config.FirstBootMethod
+	if method == "auto" {
+		if _, err := runRemote(ctx, comm, "test -d /run/systemd/system"); err == nil {
+			method = "systemd"
+		} else if _, err := runRemote(ctx, comm, "test -d /var/lib/cloud"); err == nil {
+			method = "cloud-init"
+		} else {
+			return halt(fmt.Errorf("the guest has neither systemd nor cloud-init, set first_boot_method"))
+		}
+	}
+	ui.Say(fmt.Sprintf("Installing %d first boot script(s) using %s", len(config.FirstBootScripts), method))
+
+	if _, err := runRemote(ctx, comm, "rm -rf "+firstBootStaging+" && mkdir -p "+firstBootStaging); err != nil {
+		return halt(err)
+	}
+	defer runRemote(ctx, comm, "rm -rf "+firstBootStaging)
+
+	upload := func(name string, content *os.File) error {
+		fi, err := content.Stat()
+		if err != nil {
+			return err
+		}
+		return comm.Upload(firstBootStaging+"/"+name, content, &fi)
+	}
+	var names []string
+	for i, path := range config.FirstBootScripts {
+		f, err := os.Open(path)
+		if err != nil {
+			return halt(err)
+		}
+		name := firstBootScriptName(i, path)
+		err = upload(name, f)
+		f.Close()
+		if err != nil {
+			return halt(fmt.Errorf("upload of %s failed: %s", path, err))
+		}
+		names = append(names, name)
+	}
+
+	var script []string
+	switch method {
+	case "systemd":
+		runner := strings.NewReader(firstBootRunner)
+		if err := comm.Upload(firstBootStaging+"/run", runner, nil); err != nil {
+			return halt(err)
+		}
+		if err := comm.Upload(firstBootStaging+"/meda-first-boot.service", strings.NewReader(firstBootUnitFile), nil); err != nil {
+			return halt(err)
+		}
+		script = []string{
+			sudo + "mkdir -p " + firstBootDir + "/scripts.d",
+			sudo + "install -m 0755 " + firstBootStaging + "/run " + firstBootDir + "/run",
+			sudo + "install -m 0644 " + firstBootStaging + "/meda-first-boot.service " + firstBootUnit,
+			sudo + "rm -f " + firstBootDone,
+		}
+		for _, name := range names {
+			script = append(script, sudo+"install -m 0755 "+firstBootStaging+"/"+name+" "+firstBootDir+"/scripts.d/"+name)
+		}
+		script = append(script, sudo+"systemctl daemon-reload", sudo+"systemctl enable meda-first-boot.service")
+	case "cloud-init":
+		script = []string{sudo + "mkdir -p " + cloudInitPerInstanceDir}
+		for _, name := range names {
+			script = append(script, sudo+"install -m 0755 "+firstBootStaging+"/"+name+" "+cloudInitPerInstanceDir+"/meda-"+name)
+		}
+	}
+
+	if _, err := runRemote(ctx, comm, strings.Join(script, " && ")); err != nil {
+		return halt(err)
+	}
+	return multistep.ActionContinue
+}
+
+func (s *stepInstallFirstBootScripts) Cleanup(state multistep.StateBag) {}
@@ -0,0 +1,67 @@
+package meda
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+)
+
+// refInvalidChars matches characters that may not appear in an image tag
+var refInvalidChars = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// gitTemplateFuncs are template functions exposing git metadata of the
+// working directory, e.g. output_tag = "{{ gitshortsha }}". CI variables
+// are preferred over running git, since CI checkouts are often detached or
+// shallow.
+func gitTemplateFuncs() map[string]interface{} {
+	return map[string]interface{}{
+		"gitsha":      gitSHA,
+		"gitshortsha": gitShortSHA,
+		"gitbranch":   gitBranch,
+		"gittag":      gitTag,
+	}
+}
+
+// gitSHA returns the full commit hash being built
+func gitSHA() (string, error) {
+	for _, env := range []string{"GITHUB_SHA", "CI_COMMIT_SHA", "BUILDKITE_COMMIT", "CIRCLE_SHA1", "GIT_COMMIT"} {
+		if v := os.Getenv(env); v != "" {
+			return v, nil
+		}
+	}
+	if sha := gitOutput("rev-parse", "HEAD"); sha != "" {
+		return sha, nil
+	}
+	return "", fmt.Errorf("gitsha: not in a git repository")
+}
+
+// gitShortSHA returns the first seven characters of the commit hash
+func gitShortSHA() (string, error) {
+	sha, err := gitSHA()
+	if err != nil {
+		return "", fmt.Errorf("gitshortsha: %s", err)
+	}
+	if len(sha) > 7 {
+		sha = sha[:7]
+	}
+	return sha, nil
+}
+
+// gitBranch returns the branch being built, with characters that aren't
+// allowed in image tags replaced by '-', e.g. feature/x becomes feature-x
+func gitBranch() (string, error) {
+	branch := currentBranch()
+	if branch == "" {
+		return "", fmt.Errorf("gitbranch: the build does not run on a branch")
+	}
+	return refInvalidChars.ReplaceAllString(branch, "-"), nil
+}
+
+// gitTag returns the git tag being built, sanitized like gitBranch
+func gitTag() (string, error) {
+	tag := currentTag()
+	if tag == "" {
+		return "", fmt.Errorf("gittag: the build does not run for a git tag")
+	}
+	return refInvalidChars.ReplaceAllString(tag, "-"), nil
+}
@@ -0,0 +1,82 @@
+package meda
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// inGitHubActions reports whether the build runs in a GitHub Actions job
+func inGitHubActions() bool {
+	return os.Getenv("GITHUB_ACTIONS") == "true"
+}
+
+// githubCommand formats a GitHub Actions workflow command such as
+// ::error::message, escaping the message as the runner expects
+func githubCommand(command, message string) string {
+	message = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(message)
+	return fmt.Sprintf("::%s title=Meda build::%s", command, message)
+}
+
+// githubActionsUi adds workflow annotations for errors and warnings.
+// Packer prefixes every line a plugin prints, so the annotation lines only
+// become annotations with the problem matcher described in the README.
+type githubActionsUi struct {
+	packer.Ui
+}
+
+func (u *githubActionsUi) Say(message string) {
+	u.Ui.Say(message)
+	if warning, ok := strings.CutPrefix(message, "Warning: "); ok {
+		u.Ui.Message(githubCommand("warning", warning))
+	}
+}
+
+func (u *githubActionsUi) Error(message string) {
+	u.Ui.Error(message)
+	u.Ui.Message(githubCommand("error", message))
+}
+
+// appendGitHubFile appends content to the file named by the environment
+// variable env, as used for GITHUB_OUTPUT and GITHUB_STEP_SUMMARY
+func appendGitHubFile(env, content string) {
+	path := os.Getenv(env)
+	if path == "" {
+		return
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		log.Printf("Failed to open %s: %s", env, err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.WriteString(content); err != nil {
+		log.Printf("Failed to write %s: %s", env, err)
+	}
+}
+
+// reportGitHubSuccess sets the image, digest and pushed_image step outputs
+// and adds the image to the job summary
+func reportGitHubSuccess(a *Artifact) {
+	digest, _ := a.State("digest").(string)
+
+	appendGitHubFile("GITHUB_OUTPUT", fmt.Sprintf("image=%s\ndigest=%s\npushed_image=%s\n", a.ImageName, digest, a.PushedImage))
+
+	summary := fmt.Sprintf("### Meda image built\n\n- Image: `%s`\n", a.ImageName)
+	if digest != "" {
+		summary += fmt.Sprintf("- Digest: `%s`\n", digest)
+	}
+	if a.PushedImage != "" {
+		summary += fmt.Sprintf("- Pushed to: `%s`\n", a.PushedImage)
+	}
+	appendGitHubFile("GITHUB_STEP_SUMMARY", summary+"\n")
+}
+
+// reportGitHubFailure adds the build error to the job summary
+func reportGitHubFailure(err error) {
+	appendGitHubFile("GITHUB_STEP_SUMMARY", fmt.Sprintf("### Meda build failed\n\n```\n%s\n```\n\n", err))
+}
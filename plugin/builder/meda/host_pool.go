@@ -0,0 +1,129 @@
+package meda
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/cirunlabs/packer-plugin-meda/driver"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// medaHostAddress splits a meda_hosts entry into host and port, using
+// defaultPort when the entry has none
+func medaHostAddress(entry string, defaultPort int) (string, int, error) {
+	host, portStr, err := net.SplitHostPort(entry)
+	if err != nil {
+		// No port given
+		return strings.Trim(entry, "[]"), defaultPort, nil
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 1 || port > 65535 {
+		return "", 0, fmt.Errorf("invalid port in %q", entry)
+	}
+	return host, port, nil
+}
+
+// nextRoundRobin returns the next position in the round-robin sequence of
+// the pool and advances it. The position is kept in Packer's cache
+// directory so consecutive and parallel builds continue where the last
+// one left off.
+func nextRoundRobin(ctx context.Context, ui packer.Ui, hosts []string) (int, error) {
+	// Pools with different hosts keep separate positions
+	sum := sha256.Sum256([]byte(strings.Join(hosts, ",")))
+	path, err := packer.CachePath("meda-host-pool", hex.EncodeToString(sum[:8]))
+	if err != nil {
+		return 0, err
+	}
+	unlock, err := lockCacheFile(ctx, ui, path)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	next := 0
+	if data, err := os.ReadFile(path); err == nil {
+		next, _ = strconv.Atoi(strings.TrimSpace(string(data)))
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return 0, err
+	}
+	if err := os.WriteFile(path, []byte(strconv.Itoa(next+1)), 0644); err != nil {
+		return 0, err
+	}
+	return next, nil
+}
+
+// stepSelectMedaHost picks the Meda API server of meda_hosts the build
+// runs on, and points meda_host, meda_port and the driver at it
+type stepSelectMedaHost struct{}
+
+func (s *stepSelectMedaHost) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	config := state.Get("config").(*Config)
+	ui := state.Get("ui").(packer.Ui)
+
+	// Ask every host for its VMs. Unreachable hosts are left out.
+	type candidate struct {
+		host string
+		port int
+		vms  int
+	}
+	var candidates []candidate
+	for _, entry := range config.MedaHosts {
+		host, port, _ := medaHostAddress(entry, config.MedaPort)
+		d := driver.NewAPIDriver(&driver.Config{MedaHost: host, MedaPort: port}, nil)
+		if err := d.Ping(); err != nil {
+			ui.Say(fmt.Sprintf("Warning: skipping Meda host %s: %s", entry, err))
+			continue
+		}
+		vms, err := d.ListVMs()
+		if err != nil {
+			ui.Say(fmt.Sprintf("Warning: skipping Meda host %s: %s", entry, err))
+			continue
+		}
+		log.Printf("Meda host %s:%d runs %d VM(s)", host, port, len(vms))
+		candidates = append(candidates, candidate{host: host, port: port, vms: len(vms)})
+	}
+	if len(candidates) == 0 {
+		err := fmt.Errorf("none of the meda_hosts is reachable")
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	chosen := candidates[0]
+	switch config.MedaHostSelection {
+	case "round-robin":
+		next, err := nextRoundRobin(ctx, ui, config.MedaHosts)
+		if err != nil {
+			err := fmt.Errorf("failed to select Meda host: %s", err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+		chosen = candidates[next%len(candidates)]
+	default:
+		// Least loaded, ties go to the host listed first
+		for _, c := range candidates[1:] {
+			if c.vms < chosen.vms {
+				chosen = c
+			}
+		}
+	}
+
+	ui.Say(fmt.Sprintf("Building on Meda host %s:%d (%d VM(s) running)", chosen.host, chosen.port, chosen.vms))
+	config.MedaHost = chosen.host
+	config.MedaPort = chosen.port
+	resetDriver(state)
+	return multistep.ActionContinue
+}
+
+func (s *stepSelectMedaHost) Cleanup(state multistep.StateBag) {}
@@ -0,0 +1,67 @@
+package meda
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"github.com/cirunlabs/packer-plugin-meda/driver"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	packerconfig "github.com/hashicorp/packer-plugin-sdk/template/config"
+)
+
+// fakeMedaHost is a Meda API server listing vms and counting the requests
+// it got
+type fakeMedaHost struct {
+	*httptest.Server
+	requests atomic.Int32
+}
+
+func newFakeMedaHost(t *testing.T, vms string) *fakeMedaHost {
+	h := &fakeMedaHost{}
+	h.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.requests.Add(1)
+		w.Write([]byte(vms))
+	}))
+	t.Cleanup(h.Close)
+	return h
+}
+
+func TestStepSelectMedaHost_driverUsesChosenHost(t *testing.T) {
+	busy := newFakeMedaHost(t, `[{"name":"a"},{"name":"b"}]`)
+	idle := newFakeMedaHost(t, `[]`)
+
+	config := &Config{
+		MedaHost:          "127.0.0.1",
+		MedaPort:          7777,
+		UseAPI:            packerconfig.TriTrue,
+		MedaHosts:         []string{busy.Listener.Addr().String(), idle.Listener.Addr().String()},
+		MedaHostSelection: "least-loaded",
+	}
+	state := new(multistep.BasicStateBag)
+	state.Put("config", config)
+	state.Put("ui", packer.TestUi(t))
+	state.Put("driver", driver.NewDriver(config.DriverConfig(), nil))
+
+	if action := (&stepSelectMedaHost{}).Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("step halted: %v", state.Get("error"))
+	}
+	if got, want := net.JoinHostPort(config.MedaHost, strconv.Itoa(config.MedaPort)), idle.Listener.Addr().String(); got != want {
+		t.Fatalf("config points at %s, want %s", got, want)
+	}
+
+	busy.requests.Store(0)
+	idle.requests.Store(0)
+	if _, err := state.Get("driver").(driver.MedaDriver).ListVMs(); err != nil {
+		t.Fatalf("ListVMs: %s", err)
+	}
+	if idle.requests.Load() != 1 || busy.requests.Load() != 0 {
+		t.Errorf("driver in state sent %d request(s) to the chosen host and %d to the other, want 1 and 0",
+			idle.requests.Load(), busy.requests.Load())
+	}
+}
@@ -0,0 +1,173 @@
+package meda
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/cirunlabs/packer-plugin-meda/driver"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// ignitionSpecVersion is the Ignition spec of the config the builder
+// generates around the configured one. Ignition merges configs of older
+// 3.x specs into it.
+const ignitionSpecVersion = "3.4.0"
+
+// usesIgnition reports whether the guest is configured through Ignition
+// instead of cloud-init
+func (c *Config) usesIgnition() bool {
+	return c.IgnitionFile != "" || c.Butane != ""
+}
+
+// isButane reports whether a config file holds Butane YAML rather than
+// Ignition JSON, going by the file extension and then by the content
+func isButane(path string, data []byte) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".bu", ".yaml", ".yml":
+		return true
+	case ".ign", ".json":
+		return false
+	}
+	return !bytes.HasPrefix(bytes.TrimSpace(data), []byte("{"))
+}
+
+// transpileButane converts a Butane config to Ignition JSON with the
+// butane tool from the host
+func transpileButane(data []byte, filesDir string) ([]byte, error) {
+	path, err := exec.LookPath("butane")
+	if err != nil {
+		return nil, fmt.Errorf("butane not found in PATH; install it or use an Ignition (.ign) file")
+	}
+
+	args := []string{"--strict"}
+	if filesDir != "" {
+		args = append(args, "--files-dir", filesDir)
+	}
+	cmd := exec.Command(path, args...)
+	cmd.Stdin = bytes.NewReader(data)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	finished := driver.LogCommand(cmd)
+	out, err := cmd.Output()
+	finished(err)
+	if err != nil {
+		return nil, fmt.Errorf("butane failed: %s - %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// ignitionUser and ignitionFile are the parts of the Ignition spec used
+// by the generated config
+type ignitionUser struct {
+	Name              string   `json:"name"`
+	SSHAuthorizedKeys []string `json:"sshAuthorizedKeys,omitempty"`
+}
+
+type ignitionFile struct {
+	Path     string `json:"path"`
+	Mode     int    `json:"mode"`
+	Contents struct {
+		Source string `json:"source"`
+	} `json:"contents"`
+}
+
+// ignitionConfig returns an Ignition config that merges child and, when
+// user is set, adds user with passwordless sudo authorized for publicKey
+func ignitionConfig(child []byte, user, publicKey string) ([]byte, error) {
+	if !json.Valid(child) {
+		return nil, fmt.Errorf("ignition config is not valid JSON")
+	}
+
+	type source struct {
+		Source string `json:"source"`
+	}
+	config := map[string]interface{}{
+		"ignition": map[string]interface{}{
+			"version": ignitionSpecVersion,
+			"config": map[string]interface{}{
+				"merge": []source{{Source: "data:;base64," + base64.StdEncoding.EncodeToString(child)}},
+			},
+		},
+	}
+
+	if user != "" {
+		sudoers := ignitionFile{Path: "/etc/sudoers.d/" + user, Mode: 0440}
+		sudoers.Contents.Source = "data:," + strings.ReplaceAll(user+" ALL=(ALL) NOPASSWD:ALL\n", "\n", "%0A")
+		config["passwd"] = map[string]interface{}{
+			"users": []ignitionUser{{Name: user, SSHAuthorizedKeys: []string{strings.TrimSpace(publicKey)}}},
+		}
+		config["storage"] = map[string]interface{}{
+			"files": []ignitionFile{sudoers},
+		}
+	}
+	return json.Marshal(config)
+}
+
+// stepIgnition prepares the Ignition config delivered to the VM in place
+// of cloud-init user-data. Butane configs are transpiled first, and the
+// temporary SSH user is added when one is used.
+type stepIgnition struct{}
+
+func (s *stepIgnition) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	config := state.Get("config").(*Config)
+	ui := state.Get("ui").(packer.Ui)
+
+	data := []byte(config.Butane)
+	filesDir := ""
+	if config.IgnitionFile != "" {
+		var err error
+		data, err = os.ReadFile(config.IgnitionFile)
+		if err != nil {
+			err := fmt.Errorf("failed to read ignition_file: %s", err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+		filesDir = filepath.Dir(config.IgnitionFile)
+	}
+
+	if config.Butane != "" || isButane(config.IgnitionFile, data) {
+		ui.Say("Transpiling Butane config to Ignition")
+		var err error
+		data, err = transpileButane(data, filesDir)
+		if err != nil {
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+	}
+
+	user := ""
+	if v, ok := state.GetOk("temporary_ssh_user"); ok {
+		user = v.(string)
+	}
+	ignition, err := ignitionConfig(data, user, string(config.Comm.SSHPublicKey))
+	if err != nil {
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	// Kept with the build directory when the build fails
+	path := filepath.Join(state.Get("build_dir").(string), "config.ign")
+	if err := os.WriteFile(path, ignition, 0600); err != nil {
+		err := fmt.Errorf("failed to write ignition file: %s", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	state.Put("ignition_file", path)
+	return multistep.ActionContinue
+}
+
+func (s *stepIgnition) Cleanup(state multistep.StateBag) {}
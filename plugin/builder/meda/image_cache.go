@@ -0,0 +1,113 @@
+package meda
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cirunlabs/packer-plugin-meda/driver"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+const (
+	// cacheLockStaleAfter is the age after which a lock file left behind by
+	// a crashed build is broken
+	cacheLockStaleAfter = 2 * time.Hour
+	// cacheLockPollInterval is how often a waiting build retries the lock
+	cacheLockPollInterval = 5 * time.Second
+)
+
+// imageCachePath returns the cache file holding the disk of image ref
+func imageCachePath(dir, ref string) string {
+	name := strings.NewReplacer("/", "_", ":", "_").Replace(ref)
+	return filepath.Join(dir, name+".qcow2")
+}
+
+// lockCacheFile takes the lock file next to path, waiting while another
+// build holds it. The returned function releases the lock.
+func lockCacheFile(ctx context.Context, ui packer.Ui, path string) (func(), error) {
+	lockPath := path + ".lock"
+	waiting := false
+
+	for {
+		f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			hostname, _ := os.Hostname()
+			fmt.Fprintf(f, "%s %d\n", hostname, os.Getpid())
+			f.Close()
+			return func() { os.Remove(lockPath) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, fmt.Errorf("failed to lock %s: %s", path, err)
+		}
+
+		if info, err := os.Stat(lockPath); err == nil && time.Since(info.ModTime()) > cacheLockStaleAfter {
+			ui.Say(fmt.Sprintf("Warning: breaking stale image cache lock %s", lockPath))
+			os.Remove(lockPath)
+			continue
+		}
+
+		if !waiting {
+			ui.Say(fmt.Sprintf("Waiting for another build to finish with %s...", path))
+			waiting = true
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(cacheLockPollInterval):
+		}
+	}
+}
+
+// lockBaseImage takes the lock for creating the base image name on the
+// Meda instance the build uses. The lock lives in Packer's cache
+// directory, so it covers every build of the user on this host, while
+// builds against different Meda servers don't wait for each other.
+func lockBaseImage(ctx context.Context, ui packer.Ui, config *Config, name string) (func(), error) {
+	target := "local"
+	if config.UseAPI.True() {
+		target = fmt.Sprintf("%s:%d", config.MedaHost, config.MedaPort)
+	}
+	sum := sha256.Sum256([]byte(target + "/" + name))
+	path, err := packer.CachePath("meda-base-images", hex.EncodeToString(sum[:8]))
+	if err != nil {
+		return nil, err
+	}
+	return lockCacheFile(ctx, ui, path)
+}
+
+// restoreCachedImage imports ref as name from the image cache. It reports
+// false when the cache has no copy of the image.
+func restoreCachedImage(driver driver.MedaDriver, ui packer.Ui, cacheFile, name string) (bool, error) {
+	if _, err := os.Stat(cacheFile); os.IsNotExist(err) {
+		return false, nil
+	}
+
+	ui.Say(fmt.Sprintf("Importing base image '%s' from cache %s", name, cacheFile))
+	if err := driver.ImportImage(cacheFile, name); err != nil {
+		return false, fmt.Errorf("failed to import cached image %s: %s", cacheFile, err)
+	}
+	return true, nil
+}
+
+// storeCachedImage exports ref into the image cache. The disk is written to
+// a temporary file first so other builds never import a partial copy.
+func storeCachedImage(driver driver.MedaDriver, ui packer.Ui, cacheFile, ref string) error {
+	if err := os.MkdirAll(filepath.Dir(cacheFile), 0755); err != nil {
+		return err
+	}
+
+	ui.Say(fmt.Sprintf("Storing base image '%s' in cache %s", ref, cacheFile))
+	partial := cacheFile + ".partial"
+	os.Remove(partial)
+	if err := driver.ExportImage(ref, partial, "qcow2"); err != nil {
+		os.Remove(partial)
+		return err
+	}
+	return os.Rename(partial, cacheFile)
+}
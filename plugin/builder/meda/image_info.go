@@ -0,0 +1,198 @@
+package meda
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/cirunlabs/packer-plugin-meda/driver"
+	"github.com/cirunlabs/packer-plugin-meda/version"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// imageInfoPath is where the build provenance is written in the guest
+const imageInfoPath = "/etc/meda-image-info.json"
+
+// imageInfo describes how an image was built. Running VMs read it to report
+// their provenance.
+type imageInfo struct {
+	Builder          string `json:"builder"`
+	BuilderVersion   string `json:"builder_version"`
+	PackerVersion    string `json:"packer_version,omitempty"`
+	BuildName        string `json:"build_name,omitempty"`
+	BuildTime        string `json:"build_time"`
+	RunUUID          string `json:"run_uuid"`
+	BaseImage        string `json:"base_image"`
+	SourceVM         string `json:"source_vm,omitempty"`
+	BaseImageDigest  string `json:"base_image_digest,omitempty"`
+	OutputImage      string `json:"output_image"`
+	ProvisionersHash string `json:"provisioners_sha256"`
+}
+
+// builderVersion returns the plugin version including the prerelease marker
+func builderVersion() string {
+	if version.VersionPrerelease != "" {
+		return version.Version + "-" + version.VersionPrerelease
+	}
+	return version.Version
+}
+
+// provisionerDigest hashes the content of everything uploaded to the guest
+// while the provisioners run. Commands aren't part of it since provisioners
+// put random names in their remote paths.
+type provisionerDigest struct {
+	mu   sync.Mutex
+	hash hash.Hash
+}
+
+func newProvisionerDigest() *provisionerDigest {
+	return &provisionerDigest{hash: sha256.New()}
+}
+
+func (d *provisionerDigest) write(r io.Reader) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	_, err := io.Copy(d.hash, r)
+	return err
+}
+
+func (d *provisionerDigest) sum() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return hex.EncodeToString(d.hash.Sum(nil))
+}
+
+// digestCommunicator feeds uploads into a provisionerDigest before passing
+// them on to the wrapped communicator
+type digestCommunicator struct {
+	packer.Communicator
+
+	digest *provisionerDigest
+}
+
+func (c *digestCommunicator) Upload(dst string, r io.Reader, fi *os.FileInfo) error {
+	// Seekable sources are hashed up front and rewound so the wrapped
+	// communicator can still retry the upload
+	if rs, ok := r.(io.ReadSeeker); ok {
+		start, err := rs.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+		if err := c.digest.write(rs); err != nil {
+			return err
+		}
+		if _, err := rs.Seek(start, io.SeekStart); err != nil {
+			return err
+		}
+		return c.Communicator.Upload(dst, rs, fi)
+	}
+
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- c.digest.write(pr)
+	}()
+	err := c.Communicator.Upload(dst, io.TeeReader(r, pw), fi)
+	pw.CloseWithError(err)
+	if digestErr := <-done; err == nil && digestErr != nil {
+		err = digestErr
+	}
+	return err
+}
+
+func (c *digestCommunicator) UploadDir(dst string, src string, exclude []string) error {
+	err := filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return c.digest.write(f)
+	})
+	if err != nil {
+		return err
+	}
+	return c.Communicator.UploadDir(dst, src, exclude)
+}
+
+// stepDigestProvisioners wraps the communicator so that the files uploaded
+// by the provisioners end up in the image info
+type stepDigestProvisioners struct{}
+
+func (s *stepDigestProvisioners) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	comm := state.Get("communicator").(packer.Communicator)
+
+	digest := newProvisionerDigest()
+	state.Put("provisioner_digest", digest)
+	state.Put("communicator", &digestCommunicator{Communicator: comm, digest: digest})
+	return multistep.ActionContinue
+}
+
+func (s *stepDigestProvisioners) Cleanup(state multistep.StateBag) {}
+
+// stepWriteImageInfo writes /etc/meda-image-info.json into the guest right
+// before it is stopped for capture
+type stepWriteImageInfo struct{}
+
+func (s *stepWriteImageInfo) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	config := state.Get("config").(*Config)
+	comm := state.Get("communicator").(packer.Communicator)
+	driver := state.Get("driver").(driver.MedaDriver)
+	ui := state.Get("ui").(packer.Ui)
+	sudo := sudoPrefix(config.Comm.SSHUsername)
+
+	info := imageInfo{
+		Builder:          "packer-plugin-meda",
+		BuilderVersion:   builderVersion(),
+		PackerVersion:    config.PackerCoreVersion,
+		BuildName:        config.PackerBuildName,
+		BuildTime:        time.Now().UTC().Format(time.RFC3339),
+		RunUUID:          state.Get("run_uuid").(string),
+		BaseImage:        config.BaseImage,
+		SourceVM:         config.SourceVM,
+		OutputImage:      config.OutputImageName + ":" + config.OutputTag,
+		ProvisionersHash: state.Get("provisioner_digest").(*provisionerDigest).sum(),
+	}
+	if base, err := driver.InspectImage(baseImageRef(config.BaseImage)); err == nil {
+		info.BaseImageDigest = base.Digest
+	} else {
+		ui.Say(fmt.Sprintf("Warning: failed to inspect base image, its digest is left out of the image info: %s", err))
+	}
+
+	halt := func(err error) multistep.StepAction {
+		err = fmt.Errorf("failed to write image info: %s", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	data, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return halt(err)
+	}
+
+	ui.Say("Writing build provenance to " + imageInfoPath)
+	staging := "/tmp/meda-image-info.json"
+	if err := comm.Upload(staging, bytes.NewReader(append(data, '\n')), nil); err != nil {
+		return halt(err)
+	}
+	if _, err := runRemote(ctx, comm, fmt.Sprintf("%sinstall -m 0644 %s %s && rm -f %s", sudo, staging, imageInfoPath, staging)); err != nil {
+		return halt(err)
+	}
+	return multistep.ActionContinue
+}
+
+func (s *stepWriteImageInfo) Cleanup(state multistep.StateBag) {}
@@ -0,0 +1,158 @@
+package meda
+
+import (
+	"bufio"
+	"bytes"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cirunlabs/packer-plugin-meda/driver"
+)
+
+// arpEntryPattern matches a line of `arp -an` output on macOS and BSD:
+// ? (192.168.64.5) at 52:54:0:12:34:56 on bridge100 ifscope [ethernet]
+var arpEntryPattern = regexp.MustCompile(`\(([0-9.]+)\) at ([0-9a-fA-F:]+) on (\S+)`)
+
+// sameMAC compares two MAC addresses, tolerating the leading zeros that
+// `arp` leaves out of each octet
+func sameMAC(a, b string) bool {
+	normalize := func(mac string) string {
+		parts := strings.Split(strings.ToLower(mac), ":")
+		for i, p := range parts {
+			if len(p) == 1 {
+				parts[i] = "0" + p
+			}
+		}
+		return strings.Join(parts, ":")
+	}
+	x, errX := net.ParseMAC(normalize(a))
+	y, errY := net.ParseMAC(normalize(b))
+	return errX == nil && errY == nil && bytes.Equal(x, y)
+}
+
+// neighborIP looks mac up in the host's neighbor (ARP) table, optionally
+// restricted to device. It returns "" when there is no entry.
+func neighborIP(mac, device string) string {
+	if data, err := os.ReadFile("/proc/net/arp"); err == nil {
+		// IP address  HW type  Flags  HW address  Mask  Device
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		scanner.Scan() // header
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) < 6 || fields[2] == "0x0" {
+				continue
+			}
+			if sameMAC(fields[3], mac) && (device == "" || fields[5] == device) {
+				return fields[0]
+			}
+		}
+		return ""
+	}
+
+	out, err := exec.Command("arp", "-an").Output()
+	if err != nil {
+		return ""
+	}
+	for _, m := range arpEntryPattern.FindAllStringSubmatch(string(out), -1) {
+		if sameMAC(m[2], mac) && (device == "" || m[3] == device) {
+			return m[1]
+		}
+	}
+	return ""
+}
+
+// vmMAC returns the MAC address of the VM, from the configuration or as
+// reported by meda, or "" if it is unknown
+func vmMAC(driver driver.MedaDriver, config *Config, vmName string) string {
+	if config.MACAddress != "" {
+		return config.MACAddress
+	}
+	vms, err := driver.ListVMs()
+	if err != nil {
+		return ""
+	}
+	for _, vm := range vms {
+		if vm.Name == vmName {
+			return vm.MAC
+		}
+	}
+	return ""
+}
+
+// vmIPDialTimeout bounds the reachability check of a candidate address
+const vmIPDialTimeout = 3 * time.Second
+
+// filtersVMIP reports whether the VM address is picked by ip_interface or
+// ip_cidr_filter instead of taking the one `meda ip` lists first
+func (c *Config) filtersVMIP() bool {
+	return c.IPInterface != "" || c.IPCIDRFilter != ""
+}
+
+// acceptsVMIP reports whether ip lies in ip_cidr_filter, if set
+func (c *Config) acceptsVMIP(ip string) bool {
+	if c.IPCIDRFilter == "" {
+		return true
+	}
+	// Validated in Prepare
+	_, subnet, _ := net.ParseCIDR(c.IPCIDRFilter)
+	parsed := net.ParseIP(ip)
+	return parsed != nil && subnet.Contains(parsed)
+}
+
+// dialsVMIP reports whether candidate addresses are checked by connecting
+// to the SSH port. Through the Meda API tunnel, a bastion or a proxy the
+// host can't be expected to reach the VM directly.
+func (c *Config) dialsVMIP() bool {
+	return c.Comm.Type == "ssh" && !c.SSHViaAPI && c.Comm.SSHBastionHost == "" && c.Comm.SSHProxyHost == ""
+}
+
+// vmIP returns the address to connect to the VM with, or "" while it has
+// none. With ip_interface or ip_cidr_filter the addresses meda reports are
+// filtered, and the first one accepting TCP connections on the SSH port
+// is used.
+func vmIP(driver driver.MedaDriver, config *Config, vmName string) (string, error) {
+	if !config.filtersVMIP() {
+		return driver.GetVMIP(vmName)
+	}
+
+	addrs, err := driver.GetVMAddresses(vmName)
+	if err != nil {
+		return "", err
+	}
+	var candidates []string
+	for _, addr := range addrs {
+		if config.IPInterface != "" && addr.Interface != config.IPInterface {
+			continue
+		}
+		if config.acceptsVMIP(addr.IP) {
+			candidates = append(candidates, addr.IP)
+		}
+	}
+	if len(candidates) == 0 {
+		if len(addrs) > 0 {
+			log.Printf("No address of VM %s matches ip_interface %q and ip_cidr_filter %q: %v", vmName, config.IPInterface, config.IPCIDRFilter, addrs)
+		}
+		return "", nil
+	}
+	if !config.dialsVMIP() {
+		return candidates[0], nil
+	}
+
+	for _, ip := range candidates {
+		address := net.JoinHostPort(ip, strconv.Itoa(config.Comm.SSHPort))
+		conn, err := net.DialTimeout("tcp", address, vmIPDialTimeout)
+		if err != nil {
+			log.Printf("VM address %s is not reachable yet: %s", address, err)
+			continue
+		}
+		conn.Close()
+		return ip, nil
+	}
+	return "", nil
+}
@@ -0,0 +1,33 @@
+package meda
+
+import (
+	"context"
+
+	"github.com/cirunlabs/packer-plugin-meda/driver"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// stepMockVM stands in for waiting for the VM and connecting to it in
+// mock_mode: the VM has driver.MockVMIP, and provisioners run against a
+// communicator that accepts every command and upload
+type stepMockVM struct{}
+
+func (s *stepMockVM) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	config := state.Get("config").(*Config)
+	ui := state.Get("ui").(packer.Ui)
+
+	state.Put("vm_ip", driver.MockVMIP)
+	state.Put("instance_ip", driver.MockVMIP)
+	config.Comm.SSHHost = driver.MockVMIP
+
+	generatedData := state.Get("generated_data").(map[string]interface{})
+	generatedData["MedaVMIP"] = driver.MockVMIP
+	generatedData["MedaSSHUsername"] = config.Comm.SSHUsername
+
+	state.Put("communicator", &packer.MockCommunicator{})
+	ui.Say("Mock mode: simulated VM at " + driver.MockVMIP + ", remote commands are not run")
+	return multistep.ActionContinue
+}
+
+func (s *stepMockVM) Cleanup(state multistep.StateBag) {}
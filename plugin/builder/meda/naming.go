@@ -0,0 +1,85 @@
+package meda
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+)
+
+// runUUID returns the UUID Packer assigns to a `packer build` invocation,
+// or a random one when the plugin runs outside of Packer
+func runUUID() string {
+	if id := os.Getenv("PACKER_RUN_UUID"); id != "" {
+		return id
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// buildID derives a short identifier from the run UUID and the build name.
+// Builds of one run share the run UUID, so the build name keeps sources
+// built with -parallel-builds apart.
+func buildID(runUUID, buildName string) string {
+	sum := sha256.Sum256([]byte(runUUID + "/" + buildName))
+	return hex.EncodeToString(sum[:4])
+}
+
+// buildVMName returns packer-<vm_name>-<unix time>-<build id>. The
+// timestamp lets orphan cleanup tell the VM's age.
+func buildVMName(vmName, id string, now time.Time) string {
+	return fmt.Sprintf("packer-%s-%d-%s", vmName, now.Unix(), id)
+}
+
+// parseBuildVMName extracts creation time and build id from a VM name made
+// by buildVMName. Names from older releases without a build id are
+// understood as well. Anything else is rejected, including VMs of
+// templates whose vm_name starts with this one, like runner-2 for runner.
+func parseBuildVMName(name, vmName string) (createdAt time.Time, id string, ok bool) {
+	pattern := regexp.MustCompile(`^packer-` + regexp.QuoteMeta(vmName) + `-(\d{9,})(?:-([0-9a-f]{8}))?$`)
+	m := pattern.FindStringSubmatch(name)
+	if m == nil {
+		return time.Time{}, "", false
+	}
+	unix, err := strconv.ParseInt(m[1], 10, 64)
+	if err != nil {
+		return time.Time{}, "", false
+	}
+	return time.Unix(unix, 0), m[2], true
+}
+
+// expiresAtLabel records when meda-prune may delete an image, in RFC 3339
+const expiresAtLabel = "packer.expires_at"
+
+// imageLabels returns the labels attached to every image of a build
+func imageLabels(state multistep.StateBag) map[string]string {
+	labels := map[string]string{
+		"packer.run_uuid": state.Get("run_uuid").(string),
+		"packer.vm_name":  state.Get("vm_name").(string),
+	}
+	if config := state.Get("config").(*Config); config.ExpiresAfter > 0 {
+		labels[expiresAtLabel] = time.Now().Add(config.ExpiresAfter).UTC().Format(time.RFC3339)
+	}
+	return labels
+}
+
+// sortedKeys returns the keys of m in sorted order
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
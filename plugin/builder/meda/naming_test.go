@@ -0,0 +1,54 @@
+package meda
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseBuildVMName(t *testing.T) {
+	started := time.Unix(1700000000, 0)
+
+	tests := []struct {
+		name   string
+		vmName string
+		ok     bool
+		id     string
+	}{
+		{buildVMName("runner", "0a1b2c3d", started), "runner", true, "0a1b2c3d"},
+		{"packer-runner-1700000000", "runner", true, ""},
+		{"packer-runner-1.2-1700000000-0a1b2c3d", "runner-1.2", true, "0a1b2c3d"},
+
+		// Another template whose vm_name starts with this one
+		{buildVMName("runner-2", "0a1b2c3d", started), "runner", false, ""},
+		{"packer-runner-2-1700000000", "runner", false, ""},
+		{buildVMName("runner-1700000000", "0a1b2c3d", started), "runner", false, ""},
+		{"packer-runner.x-1700000000-0a1b2c3d", "runner", false, ""},
+
+		// Not made by buildVMName
+		{"packer-runner-1700000000-0a1b2c3d-clone", "runner", false, ""},
+		{"packer-runner-1700000000-0A1B2C3D", "runner", false, ""},
+		{"packer-runner-1700000000-0a1b2c", "runner", false, ""},
+		{"packer-runner-latest", "runner", false, ""},
+		{"packer-runner-", "runner", false, ""},
+		{"runner-1700000000-0a1b2c3d", "runner", false, ""},
+		{"packer-other-1700000000-0a1b2c3d", "runner", false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name+"/"+tt.vmName, func(t *testing.T) {
+			createdAt, id, ok := parseBuildVMName(tt.name, tt.vmName)
+			if ok != tt.ok {
+				t.Fatalf("ok = %v, want %v", ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+			if !createdAt.Equal(started) {
+				t.Errorf("created at %s, want %s", createdAt, started)
+			}
+			if id != tt.id {
+				t.Errorf("id = %q, want %q", id, tt.id)
+			}
+		})
+	}
+}
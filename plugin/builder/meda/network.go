@@ -0,0 +1,47 @@
+package meda
+
+import (
+	"net"
+	"strconv"
+)
+
+// validNetworkAllowEntry reports whether entry is an IP address, a CIDR
+// range or a hostname, optionally followed by :port
+func validNetworkAllowEntry(entry string) bool {
+	host := entry
+	if h, port, err := net.SplitHostPort(entry); err == nil {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return false
+		}
+		host = h
+	}
+	if net.ParseIP(host) != nil {
+		return true
+	}
+	if _, _, err := net.ParseCIDR(host); err == nil {
+		return true
+	}
+	return hostnamePattern.MatchString(host)
+}
+
+// networkMode returns the network mode meda creates the build VM with,
+// "" for meda's default network
+func (c *Config) networkMode() string {
+	if c.NetworkIsolation == "none" {
+		return ""
+	}
+	return c.NetworkIsolation
+}
+
+// networkAllow returns what an isolated build VM may reach: network_allow,
+// the service VMs started for the build and DNS on dns_servers
+func networkAllow(config *Config, serviceIPs []string) []string {
+	if config.NetworkIsolation != "isolated" {
+		return nil
+	}
+	allow := append(append([]string(nil), config.NetworkAllow...), serviceIPs...)
+	for _, server := range config.DNSServers {
+		allow = append(allow, net.JoinHostPort(server, "53"))
+	}
+	return allow
+}
@@ -0,0 +1,160 @@
+package meda
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/cirunlabs/packer-plugin-meda/driver"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// ObjectStorageExport uploads the exported image disk to cloud object
+// storage after the build
+type ObjectStorageExport struct {
+	// Provider is one of s3, gcs or azure
+	Provider string `mapstructure:"provider" required:"true"`
+	// Bucket is the S3/GCS bucket or Azure container
+	Bucket string `mapstructure:"bucket" required:"true"`
+	// Key is the object name. Defaults to <output_image_name>-<output_tag>.<format>.
+	Key string `mapstructure:"key"`
+	// Format of the exported disk, raw or qcow2
+	Format string `mapstructure:"format"`
+	// Region and Endpoint configure S3 and S3-compatible stores
+	Region   string `mapstructure:"region"`
+	Endpoint string `mapstructure:"endpoint"`
+	// Credentials are environment variables for the upload tool, e.g.
+	// AWS_ACCESS_KEY_ID or AZURE_STORAGE_CONNECTION_STRING
+	Credentials map[string]string `mapstructure:"credentials"`
+}
+
+// prepare applies defaults and validates the export configuration
+func (e *ObjectStorageExport) prepare(c *Config) []error {
+	var errs []error
+
+	if e.Format == "" {
+		e.Format = "qcow2"
+	}
+	if e.Key == "" {
+		e.Key = fmt.Sprintf("%s-%s.%s", c.OutputImageName, c.OutputTag, e.Format)
+	}
+
+	switch e.Provider {
+	case "s3", "gcs", "azure":
+	default:
+		errs = append(errs, fmt.Errorf("object_storage_export.provider must be one of s3, gcs or azure, got %q", e.Provider))
+	}
+	if e.Bucket == "" {
+		errs = append(errs, fmt.Errorf("object_storage_export.bucket is required"))
+	}
+	if e.Format != "raw" && e.Format != "qcow2" {
+		errs = append(errs, fmt.Errorf("object_storage_export.format must be raw or qcow2, got %q", e.Format))
+	}
+
+	for _, v := range e.Credentials {
+		packer.LogSecretFilter.Set(v)
+	}
+	return errs
+}
+
+// URL returns the location of the uploaded object
+func (e *ObjectStorageExport) URL() string {
+	switch e.Provider {
+	case "s3":
+		return "s3://" + e.Bucket + "/" + e.Key
+	case "gcs":
+		return "gs://" + e.Bucket + "/" + e.Key
+	default:
+		return "azure://" + e.Bucket + "/" + e.Key
+	}
+}
+
+// uploadCommand returns the provider CLI invocation uploading path
+func (e *ObjectStorageExport) uploadCommand(path string) *exec.Cmd {
+	var cmd *exec.Cmd
+	switch e.Provider {
+	case "s3":
+		args := []string{"s3", "cp", path, e.URL()}
+		if e.Region != "" {
+			args = append(args, "--region", e.Region)
+		}
+		if e.Endpoint != "" {
+			args = append(args, "--endpoint-url", e.Endpoint)
+		}
+		cmd = exec.Command("aws", args...)
+	case "gcs":
+		cmd = exec.Command("gcloud", "storage", "cp", path, e.URL())
+	default:
+		cmd = exec.Command("az", "storage", "blob", "upload",
+			"--file", path,
+			"--container-name", e.Bucket,
+			"--name", e.Key,
+			"--overwrite")
+	}
+
+	cmd.Env = os.Environ()
+	for k, v := range e.Credentials {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	return cmd
+}
+
+// stepExportObjectStorage exports the built image and uploads it to object
+// storage
+type stepExportObjectStorage struct {
+	tempDir string
+}
+
+func (s *stepExportObjectStorage) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	config := state.Get("config").(*Config)
+	d := state.Get("driver").(driver.MedaDriver)
+	ui := state.Get("ui").(packer.Ui)
+	imageName := state.Get("image_name").(string)
+	export := config.ObjectStorageExport
+
+	// Removed even when the build fails, disk images are large
+	tempDir, err := os.MkdirTemp(state.Get("build_dir").(string), "export-")
+	if err != nil {
+		err := fmt.Errorf("failed to create export directory: %s", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+	s.tempDir = tempDir
+	path := filepath.Join(tempDir, filepath.Base(export.Key))
+
+	ui.Say(fmt.Sprintf("Exporting image '%s' as %s", imageName, export.Format))
+	if err := d.ExportImage(imageName, path, export.Format); err != nil {
+		err := fmt.Errorf("failed to export image: %s", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	ui.Say(fmt.Sprintf("Uploading image to %s", export.URL()))
+	stderr, err := driver.RunStreaming(export.uploadCommand(path), ui)
+	if err != nil {
+		err := fmt.Errorf("failed to upload image: %s - %s", err, strings.TrimSpace(stderr))
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	state.Put("object_storage_url", export.URL())
+	ui.Say("Image uploaded to " + export.URL())
+	return multistep.ActionContinue
+}
+
+func (s *stepExportObjectStorage) Cleanup(state multistep.StateBag) {
+	if s.tempDir == "" {
+		return
+	}
+	if err := os.RemoveAll(s.tempDir); err != nil {
+		log.Printf("Failed to remove export directory: %s", err)
+	}
+}
@@ -0,0 +1,82 @@
+package meda
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Reference grammar of the OCI distribution specification
+var (
+	ociPathComponentPattern = regexp.MustCompile(`^[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*$`)
+	ociRegistryPattern      = regexp.MustCompile(`^(?:[a-zA-Z0-9](?:[a-zA-Z0-9-]*[a-zA-Z0-9])?)(?:\.[a-zA-Z0-9](?:[a-zA-Z0-9-]*[a-zA-Z0-9])?)*(?::[0-9]+)?$`)
+	ociTagPattern           = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]{0,127}$`)
+	ociInvalidCharsPattern  = regexp.MustCompile(`[^a-z0-9._-]+`)
+	ociSeparatorRunPattern  = regexp.MustCompile(`[._-]*[._][._-]*|-+`)
+)
+
+// ociMaxNameLength is the longest repository name registries must accept
+const ociMaxNameLength = 255
+
+// normalizeOCIComponent turns s into a valid repository path component:
+// lowercase, illegal characters replaced by '-', no leading, trailing or
+// repeated separators
+func normalizeOCIComponent(s string) string {
+	s = ociInvalidCharsPattern.ReplaceAllString(strings.ToLower(s), "-")
+	s = ociSeparatorRunPattern.ReplaceAllStringFunc(s, func(sep string) string {
+		if strings.Trim(sep, "-") == "" {
+			return "-"
+		}
+		return sep[len(sep)-1:]
+	})
+	return strings.Trim(s, "._-")
+}
+
+// validateOCIRepository checks the repository path made of organization
+// and name, each of which may contain several '/'-separated components.
+// Invalid components come with a suggested replacement.
+func validateOCIRepository(field, value string) []error {
+	var errs []error
+	for _, component := range strings.Split(value, "/") {
+		if ociPathComponentPattern.MatchString(component) {
+			continue
+		}
+		if suggestion := normalizeOCIComponent(component); suggestion != "" {
+			errs = append(errs, fmt.Errorf("%s %q is not a valid image name component: use lowercase letters, digits and '.', '_' or '-' separators, e.g. %q",
+				field, component, suggestion))
+		} else {
+			errs = append(errs, fmt.Errorf("%s %q is not a valid image name component", field, component))
+		}
+	}
+	return errs
+}
+
+// validateOCIReference checks the reference the image is pushed as, so an
+// invalid name fails the build before anything is created rather than at
+// push time
+func validateOCIReference(registry, organization, name string, tags []string) []error {
+	var errs []error
+
+	if !ociRegistryPattern.MatchString(registry) {
+		errs = append(errs, fmt.Errorf("registry %q is not a valid registry host name", registry))
+	}
+	if organization != "" {
+		errs = append(errs, validateOCIRepository("organization", organization)...)
+	}
+	errs = append(errs, validateOCIRepository("output_image_name", name)...)
+
+	repository := name
+	if organization != "" {
+		repository = organization + "/" + name
+	}
+	if len(repository) > ociMaxNameLength {
+		errs = append(errs, fmt.Errorf("repository %q is longer than %d characters", repository, ociMaxNameLength))
+	}
+
+	for _, tag := range tags {
+		if !ociTagPattern.MatchString(tag) {
+			errs = append(errs, fmt.Errorf("tag %q is not a valid image tag: use up to 128 letters, digits, '_', '.' and '-', not starting with '.' or '-'", tag))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,53 @@
+package meda
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/cirunlabs/packer-plugin-meda/driver"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// offlineImportCommand is the command importing an offline_output tarball
+// on an air-gapped Meda host
+func offlineImportCommand(path, image string) string {
+	return fmt.Sprintf("meda import %s --name %s", shellQuote(filepath.Base(path)), shellQuote(image))
+}
+
+// stepExportOffline writes the built image as an OCI layout tarball to
+// offline_output, for hosts without registry access
+type stepExportOffline struct{}
+
+func (s *stepExportOffline) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	config := state.Get("config").(*Config)
+	d := state.Get("driver").(driver.MedaDriver)
+	ui := state.Get("ui").(packer.Ui)
+	imageName := state.Get("image_name").(string)
+
+	if err := os.MkdirAll(filepath.Dir(config.OfflineOutput), 0755); err != nil {
+		err := fmt.Errorf("failed to create offline_output directory: %s", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	ui.Say(fmt.Sprintf("Exporting image '%s' to %s", imageName, config.OfflineOutput))
+	if err := d.ExportImage(imageName, config.OfflineOutput, "oci"); err != nil {
+		err := fmt.Errorf("failed to export image to offline_output: %s", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	if fi, err := os.Stat(config.OfflineOutput); err == nil {
+		ui.Say(fmt.Sprintf("Wrote %s (%s)", config.OfflineOutput, driver.FormatBytes(fi.Size())))
+	}
+	ui.Say("Import it on the air-gapped host with: " + offlineImportCommand(config.OfflineOutput, imageName))
+	state.Put("offline_output", config.OfflineOutput)
+	return multistep.ActionContinue
+}
+
+func (s *stepExportOffline) Cleanup(state multistep.StateBag) {}
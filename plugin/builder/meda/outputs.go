@@ -0,0 +1,62 @@
+package meda
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/cirunlabs/packer-plugin-meda/driver"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// tfvars is the content of the tfvars_output file
+type tfvars struct {
+	Image       string `json:"meda_image"`
+	ImageName   string `json:"meda_image_name"`
+	ImageTag    string `json:"meda_image_tag"`
+	ImageDigest string `json:"meda_image_digest"`
+	PushedImage string `json:"meda_pushed_image"`
+}
+
+// stepWriteTfvars writes the image reference as Terraform variables so
+// downstream configurations pick up the image that was just built
+type stepWriteTfvars struct{}
+
+func (s *stepWriteTfvars) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	config := state.Get("config").(*Config)
+	ui := state.Get("ui").(packer.Ui)
+
+	vars := tfvars{
+		Image:     state.Get("image_name").(string),
+		ImageName: config.OutputImageName,
+		ImageTag:  config.OutputTag,
+	}
+	if info, ok := state.GetOk("image_info"); ok {
+		vars.ImageDigest = info.(*driver.ImageInfo).Digest
+	}
+	if pushed, ok := state.GetOk("pushed_image"); ok {
+		vars.PushedImage = pushed.(string)
+	}
+
+	data, err := json.MarshalIndent(vars, "", "  ")
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(config.TfvarsOutput), 0755)
+	}
+	if err == nil {
+		err = os.WriteFile(config.TfvarsOutput, append(data, '\n'), 0644)
+	}
+	if err != nil {
+		err := fmt.Errorf("failed to write tfvars_output: %s", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	ui.Say("Wrote Terraform variables to " + config.TfvarsOutput)
+	return multistep.ActionContinue
+}
+
+func (s *stepWriteTfvars) Cleanup(state multistep.StateBag) {}
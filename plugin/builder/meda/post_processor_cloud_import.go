@@ -0,0 +1,376 @@
+// Code generation: packer-sdc mapstructure-to-hcl2 -type CloudImportConfig
+// Generated file: post_processor_cloud_import.hcl2spec.go
+
+package meda
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/cirunlabs/packer-plugin-meda/driver"
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/hashicorp/packer-plugin-sdk/common"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/template/config"
+	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
+)
+
+const CloudImportBuilderId = "meda.cloud-import"
+
+// CloudImportConfig configures the meda-cloud-import post-processor
+type CloudImportConfig struct {
+	common.PackerConfig `mapstructure:",squash"`
+
+	// Meda configuration, same meaning and defaults as for the builder
+	MedaBinary     string            `mapstructure:"meda_binary"`
+	MedaHost       string            `mapstructure:"meda_host"`
+	MedaPort       int               `mapstructure:"meda_port"`
+	UseAPI         bool              `mapstructure:"use_api"`
+	MedaEnv        map[string]string `mapstructure:"meda_env"`
+	MedaWorkingDir string            `mapstructure:"meda_working_dir"`
+
+	// Provider is aws or gcp
+	Provider string `mapstructure:"provider" required:"true"`
+	// ImageName is the name of the cloud image. Defaults to the Meda image
+	// name with ':' replaced by '-'.
+	ImageName string `mapstructure:"image_name"`
+	// Description of the cloud image
+	Description string `mapstructure:"description"`
+	// Format of the exported disk, raw or qcow2. AWS only accepts raw.
+	Format string `mapstructure:"format"`
+	// ImportTimeout bounds how long to wait for the cloud import
+	ImportTimeout time.Duration `mapstructure:"import_timeout"`
+
+	// AWS VM Import settings
+	S3Bucket    string `mapstructure:"s3_bucket"`
+	S3KeyPrefix string `mapstructure:"s3_key_prefix"`
+	Region      string `mapstructure:"region"`
+	RoleName    string `mapstructure:"role_name"`
+
+	// GCE image import settings
+	Project string `mapstructure:"project"`
+	Zone    string `mapstructure:"zone"`
+	// OS is the --os value of `gcloud compute images import`, e.g.
+	// ubuntu-2204. Without it the disk is imported as a data disk.
+	OS string `mapstructure:"os"`
+
+	ctx interpolate.Context
+}
+
+var gceImageNameInvalid = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// CloudImportPostProcessor imports the disk of a Meda image into a cloud
+// provider, so the same image boots on Meda runners and in the cloud
+type CloudImportPostProcessor struct {
+	config CloudImportConfig
+}
+
+func (p *CloudImportPostProcessor) ConfigSpec() hcldec.ObjectSpec {
+	return p.config.FlatMapstructure().HCL2Spec()
+}
+
+func (p *CloudImportPostProcessor) Configure(raws ...interface{}) error {
+	err := config.Decode(&p.config, &config.DecodeOpts{
+		PluginType:         "meda-cloud-import",
+		Interpolate:        true,
+		InterpolateContext: &p.config.ctx,
+	}, raws...)
+	if err != nil {
+		return err
+	}
+
+	c := &p.config
+	if c.MedaBinary == "" {
+		c.MedaBinary = "meda"
+	}
+	if c.MedaHost == "" {
+		c.MedaHost = "127.0.0.1"
+	}
+	if c.MedaPort == 0 {
+		c.MedaPort = 7777
+	}
+	if c.Format == "" {
+		c.Format = "raw"
+	}
+	if c.ImportTimeout == 0 {
+		c.ImportTimeout = time.Hour
+	}
+	if c.RoleName == "" {
+		c.RoleName = "vmimport"
+	}
+
+	var errs []error
+	switch c.Provider {
+	case "aws":
+		if c.S3Bucket == "" {
+			errs = append(errs, fmt.Errorf("s3_bucket is required for provider aws"))
+		}
+		if c.Format != "raw" {
+			errs = append(errs, fmt.Errorf("AWS VM Import needs format = \"raw\""))
+		}
+	case "gcp":
+		if c.Format != "raw" && c.Format != "qcow2" {
+			errs = append(errs, fmt.Errorf("format must be raw or qcow2, got %q", c.Format))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("provider must be aws or gcp, got %q", c.Provider))
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("validation errors: %v", errs)
+	}
+	return nil
+}
+
+func (p *CloudImportPostProcessor) PostProcess(ctx context.Context, ui packer.Ui, artifact packer.Artifact) (packer.Artifact, bool, bool, error) {
+	imageName, _ := artifact.State("image_name").(string)
+
+	name := p.config.ImageName
+	if name == "" {
+		name = strings.ReplaceAll(imageName, ":", "-")
+	}
+	if name == "" {
+		return nil, false, false, fmt.Errorf("artifact %s has no Meda image and image_name is not set", artifact.Id())
+	}
+
+	disk, cleanup, err := p.diskFile(ui, artifact, imageName)
+	if err != nil {
+		return nil, false, false, err
+	}
+	defer cleanup()
+
+	var result *CloudImageArtifact
+	switch p.config.Provider {
+	case "aws":
+		result, err = p.importAWS(ctx, ui, name, disk)
+	default:
+		result, err = p.importGCP(ctx, ui, name, disk)
+	}
+	if err != nil {
+		return nil, false, false, err
+	}
+
+	ui.Say(fmt.Sprintf("Imported %s", result))
+	return result, true, false, nil
+}
+
+// diskFile returns a raw or qcow2 disk for the artifact. A disk among the
+// artifact's files is used as is, otherwise the Meda image is exported.
+func (p *CloudImportPostProcessor) diskFile(ui packer.Ui, artifact packer.Artifact, imageName string) (string, func(), error) {
+	for _, f := range artifact.Files() {
+		if strings.TrimPrefix(filepath.Ext(f), ".") == p.config.Format {
+			return f, func() {}, nil
+		}
+	}
+	if imageName == "" {
+		return "", nil, fmt.Errorf("artifact %s has no %s disk and no Meda image to export", artifact.Id(), p.config.Format)
+	}
+
+	tempDir, err := os.MkdirTemp("", "packer-meda-import-")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create export directory: %s", err)
+	}
+	cleanup := func() {
+		if err := os.RemoveAll(tempDir); err != nil {
+			log.Printf("Failed to remove export directory: %s", err)
+		}
+	}
+
+	d := driver.NewDriver(&driver.Config{
+		MedaBinary:     p.config.MedaBinary,
+		MedaHost:       p.config.MedaHost,
+		MedaPort:       p.config.MedaPort,
+		UseAPI:         p.config.UseAPI,
+		MedaEnv:        p.config.MedaEnv,
+		MedaWorkingDir: p.config.MedaWorkingDir,
+	}, ui)
+
+	path := filepath.Join(tempDir, "disk."+p.config.Format)
+	ui.Say(fmt.Sprintf("Exporting image '%s' as %s", imageName, p.config.Format))
+	if err := d.ExportImage(imageName, path, p.config.Format); err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("failed to export image: %s", err)
+	}
+	return path, cleanup, nil
+}
+
+// awsImportTask is the part of `aws ec2 describe-import-image-tasks` we use
+type awsImportTask struct {
+	ImportTaskId  string `json:"ImportTaskId"`
+	ImageId       string `json:"ImageId"`
+	Status        string `json:"Status"`
+	StatusMessage string `json:"StatusMessage"`
+	Progress      string `json:"Progress"`
+}
+
+// importAWS uploads the disk to S3 and runs EC2 VM Import
+func (p *CloudImportPostProcessor) importAWS(ctx context.Context, ui packer.Ui, name, disk string) (*CloudImageArtifact, error) {
+	c := p.config
+	key := c.S3KeyPrefix + name + "." + c.Format
+	s3URL := "s3://" + c.S3Bucket + "/" + key
+
+	ui.Say("Uploading disk to " + s3URL)
+	if stderr, err := driver.RunStreaming(p.aws(ctx, "s3", "cp", disk, s3URL), ui); err != nil {
+		return nil, fmt.Errorf("failed to upload disk: %s - %s", err, strings.TrimSpace(stderr))
+	}
+	defer func() {
+		if err := p.aws(ctx, "s3", "rm", s3URL).Run(); err != nil {
+			log.Printf("Failed to remove %s: %s", s3URL, err)
+		}
+	}()
+
+	description := c.Description
+	if description == "" {
+		description = "Imported from Meda image " + name
+	}
+	ui.Say("Starting EC2 VM Import")
+	output, err := p.aws(ctx, "ec2", "import-image",
+		"--description", description,
+		"--role-name", c.RoleName,
+		"--disk-containers", fmt.Sprintf("Format=%s,UserBucket={S3Bucket=%s,S3Key=%s}", c.Format, c.S3Bucket, key),
+	).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start VM import: %s", commandError(err))
+	}
+	var task awsImportTask
+	if err := json.Unmarshal(output, &task); err != nil {
+		return nil, fmt.Errorf("failed to parse import-image output: %s", err)
+	}
+
+	timeout := time.After(c.ImportTimeout)
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-timeout:
+			return nil, fmt.Errorf("timeout waiting for import task %s", task.ImportTaskId)
+		case <-ticker.C:
+		}
+
+		output, err := p.aws(ctx, "ec2", "describe-import-image-tasks", "--import-task-ids", task.ImportTaskId).Output()
+		if err != nil {
+			log.Printf("Failed to query import task %s: %s", task.ImportTaskId, commandError(err))
+			continue
+		}
+		var tasks struct {
+			ImportImageTasks []awsImportTask `json:"ImportImageTasks"`
+		}
+		if err := json.Unmarshal(output, &tasks); err != nil || len(tasks.ImportImageTasks) == 0 {
+			log.Printf("Unexpected describe-import-image-tasks output: %s", output)
+			continue
+		}
+
+		t := tasks.ImportImageTasks[0]
+		switch t.Status {
+		case "completed":
+			return &CloudImageArtifact{Provider: "aws", ImageID: t.ImageId, Location: c.Region}, nil
+		case "deleting", "deleted":
+			return nil, fmt.Errorf("import task %s failed: %s", t.ImportTaskId, t.StatusMessage)
+		default:
+			ui.Say(fmt.Sprintf("Import %s: %s %s%%", t.Status, t.StatusMessage, t.Progress))
+		}
+	}
+}
+
+// aws builds an aws CLI invocation in the configured region
+func (p *CloudImportPostProcessor) aws(ctx context.Context, args ...string) *exec.Cmd {
+	if p.config.Region != "" {
+		args = append(args, "--region", p.config.Region)
+	}
+	return exec.CommandContext(ctx, "aws", args...)
+}
+
+// importGCP runs `gcloud compute images import`, which uploads the disk
+// and waits for the import itself
+func (p *CloudImportPostProcessor) importGCP(ctx context.Context, ui packer.Ui, name, disk string) (*CloudImageArtifact, error) {
+	c := p.config
+
+	// GCE image names are lowercase letters, digits and dashes
+	name = strings.Trim(gceImageNameInvalid.ReplaceAllString(strings.ToLower(name), "-"), "-")
+
+	args := []string{"compute", "images", "import", name,
+		"--source-file", disk,
+		"--timeout", fmt.Sprintf("%ds", int(c.ImportTimeout.Seconds())),
+		"--quiet"}
+	if c.OS != "" {
+		args = append(args, "--os", c.OS)
+	} else {
+		args = append(args, "--data-disk")
+	}
+	if c.Description != "" {
+		args = append(args, "--description", c.Description)
+	}
+	if c.Project != "" {
+		args = append(args, "--project", c.Project)
+	}
+	if c.Zone != "" {
+		args = append(args, "--zone", c.Zone)
+	}
+
+	ui.Say("Importing disk as GCE image " + name)
+	if stderr, err := driver.RunStreaming(exec.CommandContext(ctx, "gcloud", args...), ui); err != nil {
+		return nil, fmt.Errorf("failed to import image: %s - %s", err, strings.TrimSpace(stderr))
+	}
+	return &CloudImageArtifact{Provider: "gcp", ImageID: name, Location: c.Project}, nil
+}
+
+// commandError includes the stderr of a failed exec command
+func commandError(err error) string {
+	if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+		return fmt.Sprintf("%s - %s", err, strings.TrimSpace(string(exitErr.Stderr)))
+	}
+	return err.Error()
+}
+
+// CloudImageArtifact is an image imported into a cloud provider
+type CloudImageArtifact struct {
+	Provider string
+	ImageID  string
+	// Location is the AWS region or GCP project
+	Location string
+}
+
+func (a *CloudImageArtifact) BuilderId() string {
+	return CloudImportBuilderId
+}
+
+func (a *CloudImageArtifact) Files() []string {
+	return nil
+}
+
+func (a *CloudImageArtifact) Id() string {
+	if a.Location != "" {
+		return a.Location + ":" + a.ImageID
+	}
+	return a.ImageID
+}
+
+func (a *CloudImageArtifact) String() string {
+	return fmt.Sprintf("%s image: %s", strings.ToUpper(a.Provider), a.Id())
+}
+
+func (a *CloudImageArtifact) State(name string) interface{} {
+	switch name {
+	case "provider":
+		return a.Provider
+	case "image_id":
+		return a.ImageID
+	case "location":
+		return a.Location
+	}
+	return nil
+}
+
+func (a *CloudImageArtifact) Destroy() error {
+	return fmt.Errorf("destroying imported %s images is not supported, remove %s manually", a.Provider, a.ImageID)
+}
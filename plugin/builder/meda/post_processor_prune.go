@@ -0,0 +1,239 @@
+// Code generation: packer-sdc mapstructure-to-hcl2 -type PruneConfig
+// Generated file: post_processor_prune.hcl2spec.go
+
+package meda
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cirunlabs/packer-plugin-meda/driver"
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/hashicorp/packer-plugin-sdk/common"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/template/config"
+	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
+)
+
+// PruneConfig configures the meda-prune post-processor and the prune
+// command
+type PruneConfig struct {
+	common.PackerConfig `mapstructure:",squash"`
+
+	// Meda configuration, same meaning and defaults as for the builder
+	MedaBinary     string            `mapstructure:"meda_binary"`
+	MedaHost       string            `mapstructure:"meda_host"`
+	MedaPort       int               `mapstructure:"meda_port"`
+	UseAPI         bool              `mapstructure:"use_api"`
+	MedaEnv        map[string]string `mapstructure:"meda_env"`
+	MedaWorkingDir string            `mapstructure:"meda_working_dir"`
+
+	// DeleteFromRegistry also deletes the pushed copy of every expired
+	// image, registry/organization/name:tag
+	DeleteFromRegistry bool   `mapstructure:"delete_from_registry"`
+	Registry           string `mapstructure:"registry"`
+	Organization       string `mapstructure:"organization"`
+	RegistryUsername   string `mapstructure:"registry_username"`
+	RegistryPassword   string `mapstructure:"registry_password"`
+	RegistryInsecure   bool   `mapstructure:"registry_insecure"`
+	RegistryCAFile     string `mapstructure:"registry_ca_file"`
+
+	// DryRun lists expired images without deleting them
+	DryRun bool `mapstructure:"dry_run"`
+
+	ctx interpolate.Context
+}
+
+// prepare sets defaults and validates the configuration
+func (c *PruneConfig) prepare() error {
+	if c.MedaBinary == "" {
+		c.MedaBinary = "meda"
+	}
+	if c.MedaHost == "" {
+		c.MedaHost = "127.0.0.1"
+	}
+	if c.MedaPort == 0 {
+		c.MedaPort = 7777
+	}
+	if c.Registry == "" {
+		c.Registry = "ghcr.io"
+	}
+	if c.RegistryPassword != "" {
+		packer.LogSecretFilter.Set(c.RegistryPassword)
+	}
+	if c.RegistryCAFile != "" {
+		if _, err := os.Stat(c.RegistryCAFile); err != nil {
+			return fmt.Errorf("registry_ca_file: %s", err)
+		}
+	}
+	return nil
+}
+
+// registryRef returns the registry copy of the local image ref
+func (c *PruneConfig) registryRef(ref string) string {
+	if c.Organization != "" {
+		return c.Registry + "/" + c.Organization + "/" + ref
+	}
+	return c.Registry + "/" + ref
+}
+
+// pruneImages deletes the local images whose expires_after has passed,
+// and with delete_from_registry their registry copies. Failures don't stop
+// the other images from being pruned. The expired images are returned.
+func pruneImages(driver driver.MedaDriver, ui packer.Ui, c *PruneConfig, now time.Time) ([]string, error) {
+	refs, err := driver.ListImages()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list images: %s", err)
+	}
+
+	var registry *registryClient
+	if c.DeleteFromRegistry && !c.DryRun {
+		registry, err = newRegistryClient(c.RegistryUsername, c.RegistryPassword, c.RegistryInsecure, c.RegistryCAFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var expired []string
+	var failed []string
+	for _, ref := range refs {
+		info, err := driver.InspectImage(ref)
+		if err != nil {
+			ui.Say(fmt.Sprintf("Warning: failed to inspect image '%s': %s", ref, err))
+			continue
+		}
+		value := info.Labels[expiresAtLabel]
+		if value == "" {
+			continue
+		}
+		expiresAt, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			ui.Say(fmt.Sprintf("Warning: image '%s' has an invalid %s label %q", ref, expiresAtLabel, value))
+			continue
+		}
+		if now.Before(expiresAt) {
+			continue
+		}
+
+		expired = append(expired, ref)
+		if c.DryRun {
+			ui.Say(fmt.Sprintf("Image '%s' expired at %s (dry run, not deleted)", ref, value))
+			continue
+		}
+
+		ui.Say(fmt.Sprintf("Deleting image '%s', expired at %s", ref, value))
+		if err := driver.DeleteImage(ref); err != nil {
+			ui.Error(fmt.Sprintf("Failed to delete image '%s': %s", ref, err))
+			failed = append(failed, ref)
+			continue
+		}
+		if registry != nil {
+			target := c.registryRef(ref)
+			deleted, err := registry.deleteTag(target)
+			switch {
+			case err != nil:
+				ui.Error(fmt.Sprintf("Failed to delete '%s' from the registry: %s", target, err))
+				failed = append(failed, target)
+			case deleted:
+				ui.Say(fmt.Sprintf("Deleted '%s' from the registry", target))
+			default:
+				ui.Say(fmt.Sprintf("'%s' is not in the registry", target))
+			}
+		}
+	}
+
+	if len(failed) > 0 {
+		return expired, fmt.Errorf("failed to prune %s", strings.Join(failed, ", "))
+	}
+	return expired, nil
+}
+
+// newPruneDriver returns the driver for the Meda the prune config points at
+func newPruneDriver(c *PruneConfig, ui packer.Ui) driver.MedaDriver {
+	return driver.NewDriver(&driver.Config{
+		MedaBinary:     c.MedaBinary,
+		MedaHost:       c.MedaHost,
+		MedaPort:       c.MedaPort,
+		UseAPI:         c.UseAPI,
+		MedaEnv:        c.MedaEnv,
+		MedaWorkingDir: c.MedaWorkingDir,
+	}, ui)
+}
+
+// PrunePostProcessor deletes expired images after a build, so retention
+// is enforced by the builds themselves. The artifact is passed through.
+type PrunePostProcessor struct {
+	config PruneConfig
+}
+
+func (p *PrunePostProcessor) ConfigSpec() hcldec.ObjectSpec {
+	return p.config.FlatMapstructure().HCL2Spec()
+}
+
+func (p *PrunePostProcessor) Configure(raws ...interface{}) error {
+	err := config.Decode(&p.config, &config.DecodeOpts{
+		PluginType:         "meda-prune",
+		Interpolate:        true,
+		InterpolateContext: &p.config.ctx,
+	}, raws...)
+	if err != nil {
+		return err
+	}
+	return p.config.prepare()
+}
+
+func (p *PrunePostProcessor) PostProcess(ctx context.Context, ui packer.Ui, artifact packer.Artifact) (packer.Artifact, bool, bool, error) {
+	ui.Say("Pruning expired images")
+	expired, err := pruneImages(newPruneDriver(&p.config, ui), ui, &p.config, time.Now())
+	if err != nil {
+		return nil, false, false, err
+	}
+	if len(expired) == 0 {
+		ui.Say("No expired images")
+	}
+	return artifact, true, false, nil
+}
+
+// runPrune implements `packer-plugin-meda prune`, for pruning from cron
+// or CI outside of a build
+func runPrune(args []string, stdout, stderr io.Writer) error {
+	var c PruneConfig
+	flags := flag.NewFlagSet("prune", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.StringVar(&c.MedaBinary, "meda-binary", "", "path to the meda binary (default: meda)")
+	flags.BoolVar(&c.UseAPI, "use-api", false, "use the Meda REST API instead of the CLI")
+	flags.StringVar(&c.MedaHost, "meda-host", "", "Meda API host (default: 127.0.0.1)")
+	flags.IntVar(&c.MedaPort, "meda-port", 0, "Meda API port (default: 7777)")
+	flags.BoolVar(&c.DeleteFromRegistry, "delete-from-registry", false, "also delete the registry copy of expired images")
+	flags.StringVar(&c.Registry, "registry", "", "registry of the pushed images (default: ghcr.io)")
+	flags.StringVar(&c.Organization, "organization", "", "registry organization of the pushed images")
+	flags.StringVar(&c.RegistryUsername, "registry-username", "", "registry user; the password is read from MEDA_REGISTRY_PASSWORD")
+	flags.BoolVar(&c.RegistryInsecure, "registry-insecure", false, "skip registry certificate verification")
+	flags.StringVar(&c.RegistryCAFile, "registry-ca-file", "", "PEM bundle to verify the registry certificate with")
+	flags.BoolVar(&c.DryRun, "dry-run", false, "list expired images without deleting them")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		return fmt.Errorf("prune takes no arguments, got %q", flags.Args())
+	}
+	c.RegistryPassword = os.Getenv("MEDA_REGISTRY_PASSWORD")
+	if err := c.prepare(); err != nil {
+		return err
+	}
+
+	ui := &packer.BasicUi{Reader: os.Stdin, Writer: stdout, ErrorWriter: stderr}
+	expired, err := pruneImages(newPruneDriver(&c, ui), ui, &c, time.Now())
+	if err != nil {
+		return err
+	}
+	if len(expired) == 0 {
+		ui.Say("No expired images")
+	}
+	return nil
+}
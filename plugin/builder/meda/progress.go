@@ -0,0 +1,108 @@
+package meda
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// activityUi is a packer.Ui that remembers when it last printed anything,
+// so heartbeats are only emitted while a step is silent
+type activityUi struct {
+	packer.Ui
+
+	mu   sync.Mutex
+	last time.Time
+}
+
+func newActivityUi(ui packer.Ui) *activityUi {
+	return &activityUi{Ui: ui, last: time.Now()}
+}
+
+func (u *activityUi) touch() {
+	u.mu.Lock()
+	u.last = time.Now()
+	u.mu.Unlock()
+}
+
+// Idle returns how long it has been since the UI last printed
+func (u *activityUi) Idle() time.Duration {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return time.Since(u.last)
+}
+
+func (u *activityUi) Say(message string) {
+	u.touch()
+	u.Ui.Say(message)
+}
+
+func (u *activityUi) Message(message string) {
+	u.touch()
+	u.Ui.Message(message)
+}
+
+func (u *activityUi) Error(message string) {
+	u.touch()
+	u.Ui.Error(message)
+}
+
+// startHeartbeat prints "still working on <what>" with the elapsed time
+// whenever ui has been silent for interval, until the returned stop function
+// is called. Without an activityUi the message is printed every interval.
+func startHeartbeat(ui packer.Ui, what string, interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	started := time.Now()
+	activity, _ := ui.(*activityUi)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if activity != nil && activity.Idle() < interval {
+					continue
+				}
+				elapsed := time.Since(started).Round(time.Second)
+				ui.Say(fmt.Sprintf("Still working on %s (%s elapsed)", what, elapsed))
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+	}
+}
+
+// stepHeartbeat wraps a step and emits heartbeats while it runs quietly
+type stepHeartbeat struct {
+	multistep.Step
+	what string
+}
+
+// withHeartbeat wraps step so that a silent run of it keeps the log alive
+func withHeartbeat(what string, step multistep.Step) multistep.Step {
+	return &stepHeartbeat{Step: step, what: what}
+}
+
+func (s *stepHeartbeat) InnerStepName() string {
+	return stepName(s.Step)
+}
+
+func (s *stepHeartbeat) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	config := state.Get("config").(*Config)
+	ui := state.Get("ui").(packer.Ui)
+
+	stop := startHeartbeat(ui, s.what, config.HeartbeatInterval)
+	defer stop()
+
+	return s.Step.Run(ctx, state)
+}
@@ -0,0 +1,245 @@
+package meda
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	sshcomm "github.com/hashicorp/packer-plugin-sdk/sdk-internals/communicator/ssh"
+)
+
+// provisionStageMarkerDir is where provisioners start a stage by creating
+// a file named after it. It is world-writable so that the users of every
+// stage can move on to the next one.
+const provisionStageMarkerDir = "/run/meda-stage"
+
+// ProvisionStage switches the communicator to another user while
+// provisioning is running
+type ProvisionStage struct {
+	// Name identifies the stage. A provisioner starts it by creating
+	// /run/meda-stage/<name> in the guest.
+	Name string `mapstructure:"name" required:"true"`
+	// User to connect as from this stage on
+	User string `mapstructure:"user" required:"true"`
+	// Password or private key of User
+	Password       string `mapstructure:"password"`
+	PrivateKeyFile string `mapstructure:"private_key_file"`
+}
+
+// prepare validates the stage
+func (s *ProvisionStage) prepare() []error {
+	var errs []error
+	if !checkpointNamePattern.MatchString(s.Name) {
+		errs = append(errs, fmt.Errorf("provision_stage name %q must only contain letters, digits, '.', '_' and '-'", s.Name))
+	}
+	if s.User == "" {
+		errs = append(errs, fmt.Errorf("provision_stage %q: user must be set", s.Name))
+	}
+	if s.Password == "" && s.PrivateKeyFile == "" {
+		errs = append(errs, fmt.Errorf("provision_stage %q: password or private_key_file must be set", s.Name))
+	}
+	if s.PrivateKeyFile != "" {
+		if _, err := os.Stat(s.PrivateKeyFile); err != nil {
+			errs = append(errs, fmt.Errorf("provision_stage %q: private_key_file is invalid: %s", s.Name, err))
+		}
+	}
+	if s.Password != "" {
+		packer.LogSecretFilter.Set(s.Password)
+	}
+	return errs
+}
+
+// stageCommunicator wraps the build communicator. Before every operation
+// it looks for stage markers left by the previous provisioner and connects
+// again as the user of the latest stage requested.
+type stageCommunicator struct {
+	state  multistep.StateBag
+	stages []ProvisionStage
+	base   packer.Communicator
+
+	mu   sync.Mutex
+	comm packer.Communicator
+	// current is the index of the running stage, -1 before the first
+	current int
+}
+
+// switchStage returns the communicator of the latest stage requested,
+// connecting as its user first when it wasn't running yet
+func (c *stageCommunicator) switchStage(ctx context.Context) (packer.Communicator, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.current == len(c.stages)-1 {
+		return c.comm, nil
+	}
+
+	output, err := runRemote(ctx, c.comm, fmt.Sprintf("ls -1 %s 2>/dev/null || true", provisionStageMarkerDir))
+	if err != nil {
+		log.Printf("Failed to look for provision stage markers: %s", err)
+		return c.comm, nil
+	}
+	requested := c.current
+	for _, name := range strings.Fields(output) {
+		for i := requested + 1; i < len(c.stages); i++ {
+			if c.stages[i].Name == name {
+				requested = i
+			}
+		}
+	}
+	if requested == c.current {
+		return c.comm, nil
+	}
+
+	stage := c.stages[requested]
+	comm, err := c.connect(stage)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start provision stage %s: %s", stage.Name, err)
+	}
+	c.comm = comm
+	c.current = requested
+	return c.comm, nil
+}
+
+// connect opens an SSH connection to the VM as the user of stage
+func (c *stageCommunicator) connect(stage ProvisionStage) (packer.Communicator, error) {
+	config := c.state.Get("config").(*Config)
+	ui := c.state.Get("ui").(packer.Ui)
+
+	ui.Say(fmt.Sprintf("Starting provision stage '%s' as '%s'", stage.Name, stage.User))
+
+	// Only the credentials of the stage, not those of the build user
+	comm := config.Comm
+	comm.SSHUsername = stage.User
+	comm.SSHPassword = stage.Password
+	comm.SSHPrivateKeyFile = stage.PrivateKeyFile
+	comm.SSHPrivateKey = nil
+	comm.SSHAgentAuth = false
+	comm.SSHCertificateFile = ""
+	sshConfig, err := comm.SSHConfigFunc()(new(multistep.BasicStateBag))
+	if err != nil {
+		return nil, err
+	}
+
+	address := net.JoinHostPort(c.state.Get("vm_ip").(string), fmt.Sprint(config.Comm.SSHPort))
+	if port, ok := c.state.GetOk("api_proxy_port"); ok {
+		address = net.JoinHostPort("127.0.0.1", fmt.Sprint(port))
+	}
+	return sshcomm.New(address, &sshcomm.Config{
+		Connection:             sshcomm.ConnectFunc("tcp", address),
+		SSHConfig:              sshConfig,
+		Pty:                    config.Comm.SSHPty,
+		DisableAgentForwarding: config.Comm.SSHDisableAgentForwarding,
+		UseSftp:                config.Comm.SSHFileTransferMethod == "sftp",
+		KeepAliveInterval:      config.Comm.SSHKeepAliveInterval,
+		Timeout:                config.Comm.SSHReadWriteTimeout,
+	})
+}
+
+// restore switches back to the build user for the steps after
+// provisioning and returns the stages that never started
+func (c *stageCommunicator) restore() []ProvisionStage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.comm = c.base
+	return c.stages[c.current+1:]
+}
+
+func (c *stageCommunicator) Start(ctx context.Context, cmd *packer.RemoteCmd) error {
+	comm, err := c.switchStage(ctx)
+	if err != nil {
+		return err
+	}
+	return comm.Start(ctx, cmd)
+}
+
+func (c *stageCommunicator) Upload(path string, input io.Reader, fi *os.FileInfo) error {
+	comm, err := c.switchStage(context.Background())
+	if err != nil {
+		return err
+	}
+	return comm.Upload(path, input, fi)
+}
+
+func (c *stageCommunicator) UploadDir(dst string, src string, exclude []string) error {
+	comm, err := c.switchStage(context.Background())
+	if err != nil {
+		return err
+	}
+	return comm.UploadDir(dst, src, exclude)
+}
+
+func (c *stageCommunicator) Download(path string, output io.Writer) error {
+	comm, err := c.switchStage(context.Background())
+	if err != nil {
+		return err
+	}
+	return comm.Download(path, output)
+}
+
+func (c *stageCommunicator) DownloadDir(src string, dst string, exclude []string) error {
+	comm, err := c.switchStage(context.Background())
+	if err != nil {
+		return err
+	}
+	return comm.DownloadDir(src, dst, exclude)
+}
+
+// stepProvisionStages creates the marker directory and installs the stage
+// communicator before provisioning
+type stepProvisionStages struct{}
+
+func (s *stepProvisionStages) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	config := state.Get("config").(*Config)
+	comm := state.Get("communicator").(packer.Communicator)
+	ui := state.Get("ui").(packer.Ui)
+	sudo := sudoPrefix(config.Comm.SSHUsername)
+
+	_, err := runRemote(ctx, comm, fmt.Sprintf("%smkdir -p %s && %schmod 1777 %s",
+		sudo, provisionStageMarkerDir, sudo, provisionStageMarkerDir))
+	if err != nil {
+		err := fmt.Errorf("failed to create %s: %s", provisionStageMarkerDir, err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	stages := &stageCommunicator{
+		state:   state,
+		stages:  config.ProvisionStages,
+		base:    comm,
+		comm:    comm,
+		current: -1,
+	}
+	state.Put("provision_stages", stages)
+	state.Put("communicator", stages)
+	return multistep.ActionContinue
+}
+
+func (s *stepProvisionStages) Cleanup(state multistep.StateBag) {}
+
+// stepFinishProvisionStages switches back to the build user after
+// provisioning and warns about stages that never started
+type stepFinishProvisionStages struct{}
+
+func (s *stepFinishProvisionStages) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	ui := state.Get("ui").(packer.Ui)
+	stages, ok := state.Get("provision_stages").(*stageCommunicator)
+	if !ok {
+		return multistep.ActionContinue
+	}
+
+	for _, stage := range stages.restore() {
+		ui.Say(fmt.Sprintf("Warning: provision stage '%s' was never requested by a provisioner", stage.Name))
+	}
+	return multistep.ActionContinue
+}
+
+func (s *stepFinishProvisionStages) Cleanup(state multistep.StateBag) {}
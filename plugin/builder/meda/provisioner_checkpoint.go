@@ -0,0 +1,78 @@
+// Code generation: packer-sdc mapstructure-to-hcl2 -type CheckpointProvisionerConfig
+// Generated file: provisioner_checkpoint.hcl2spec.go
+
+package meda
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/hashicorp/packer-plugin-sdk/common"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/template/config"
+	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
+)
+
+// CheckpointProvisionerConfig configures the meda-checkpoint provisioner
+type CheckpointProvisionerConfig struct {
+	common.PackerConfig `mapstructure:",squash"`
+
+	// Name of the checkpoint block of the meda-vm source to capture.
+	// Without a name the build only pauses, which requires
+	// stop_at_checkpoints.
+	Name string `mapstructure:"name"`
+
+	ctx interpolate.Context
+}
+
+// CheckpointProvisioner captures a checkpoint of the meda-vm builder at its
+// position in the provisioner list, or pauses the build there. The request
+// goes through the communicator to the builder, which stops the VM,
+// creates the image and reconnects before the next provisioner runs.
+type CheckpointProvisioner struct {
+	config CheckpointProvisionerConfig
+}
+
+func (p *CheckpointProvisioner) ConfigSpec() hcldec.ObjectSpec {
+	return p.config.FlatMapstructure().HCL2Spec()
+}
+
+func (p *CheckpointProvisioner) Prepare(raws ...interface{}) error {
+	err := config.Decode(&p.config, &config.DecodeOpts{
+		PluginType:         "meda-checkpoint",
+		Interpolate:        true,
+		InterpolateContext: &p.config.ctx,
+	}, raws...)
+	if err != nil {
+		return err
+	}
+
+	if p.config.Name != "" && !checkpointNamePattern.MatchString(p.config.Name) {
+		return fmt.Errorf("name must be the name of a checkpoint block, got %q", p.config.Name)
+	}
+	return nil
+}
+
+func (p *CheckpointProvisioner) Provision(ctx context.Context, ui packer.Ui, comm packer.Communicator, generatedData map[string]interface{}) error {
+	var stderr bytes.Buffer
+	cmd := &packer.RemoteCmd{
+		Command: strings.TrimSpace(checkpointCommand + " " + p.config.Name),
+		Stderr:  &stderr,
+	}
+	if err := comm.Start(ctx, cmd); err != nil {
+		return err
+	}
+
+	switch status := cmd.Wait(); status {
+	case 0:
+		return nil
+	case 127:
+		// The command reached the guest's shell
+		return fmt.Errorf("meda-checkpoint only works in builds of the meda-vm builder")
+	default:
+		return fmt.Errorf("meda-checkpoint failed: %s", strings.TrimSpace(stderr.String()))
+	}
+}
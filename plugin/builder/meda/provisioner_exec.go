@@ -0,0 +1,193 @@
+// Code generation: packer-sdc mapstructure-to-hcl2 -type ExecConfig,ExecAPIRequest
+// Generated file: provisioner_exec.hcl2spec.go
+
+package meda
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/cirunlabs/packer-plugin-meda/driver"
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/hashicorp/packer-plugin-sdk/common"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/template/config"
+	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
+)
+
+// ExecAPIRequest is one request against the Meda REST API
+type ExecAPIRequest struct {
+	// Method is the HTTP method (default: POST)
+	Method string `mapstructure:"method"`
+	// Path is relative to /api/v1/, e.g. vms/<name>/exec
+	Path string `mapstructure:"path" required:"true"`
+	// Body is sent as JSON when set
+	Body string `mapstructure:"body"`
+}
+
+// ExecConfig configures the meda-exec provisioner
+type ExecConfig struct {
+	common.PackerConfig `mapstructure:",squash"`
+
+	// Meda configuration, same meaning and defaults as for the builder
+	MedaBinary     string            `mapstructure:"meda_binary"`
+	MedaHost       string            `mapstructure:"meda_host"`
+	MedaPort       int               `mapstructure:"meda_port"`
+	MedaEnv        map[string]string `mapstructure:"meda_env"`
+	MedaWorkingDir string            `mapstructure:"meda_working_dir"`
+
+	// Inline lists meda CLI invocations without the binary name, e.g.
+	// "exec my-vm -- systemctl enable foo". Arguments are split like a
+	// shell would, without expansion.
+	Inline []string `mapstructure:"inline"`
+	// APIRequests are sent to the Meda API after the inline commands ran
+	APIRequests []ExecAPIRequest `mapstructure:"api_request"`
+
+	ctx interpolate.Context
+}
+
+// ExecProvisioner runs meda commands on the build host in the middle of the
+// provisioning pipeline. It doesn't depend on the meda builder, so it can
+// drive Meda from any build.
+type ExecProvisioner struct {
+	config ExecConfig
+}
+
+func (p *ExecProvisioner) ConfigSpec() hcldec.ObjectSpec {
+	return p.config.FlatMapstructure().HCL2Spec()
+}
+
+func (p *ExecProvisioner) Prepare(raws ...interface{}) error {
+	err := config.Decode(&p.config, &config.DecodeOpts{
+		PluginType:         "meda-exec",
+		Interpolate:        true,
+		InterpolateContext: &p.config.ctx,
+	}, raws...)
+	if err != nil {
+		return err
+	}
+
+	c := &p.config
+	if c.MedaBinary == "" {
+		c.MedaBinary = "meda"
+	}
+	if c.MedaHost == "" {
+		c.MedaHost = "127.0.0.1"
+	}
+	if c.MedaPort == 0 {
+		c.MedaPort = 7777
+	}
+	for i := range c.APIRequests {
+		if c.APIRequests[i].Method == "" {
+			c.APIRequests[i].Method = "POST"
+		}
+		c.APIRequests[i].Method = strings.ToUpper(c.APIRequests[i].Method)
+	}
+
+	var errs []error
+	if len(c.Inline) == 0 && len(c.APIRequests) == 0 {
+		errs = append(errs, fmt.Errorf("inline or api_request is required"))
+	}
+	for _, line := range c.Inline {
+		if _, err := splitArgs(line); err != nil {
+			errs = append(errs, fmt.Errorf("inline %q: %s", line, err))
+		}
+	}
+	for _, r := range c.APIRequests {
+		if r.Path == "" {
+			errs = append(errs, fmt.Errorf("api_request.path is required"))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("validation errors: %v", errs)
+	}
+	return nil
+}
+
+func (p *ExecProvisioner) Provision(ctx context.Context, ui packer.Ui, comm packer.Communicator, generatedData map[string]interface{}) error {
+	medaConfig := &driver.Config{
+		MedaBinary:     p.config.MedaBinary,
+		MedaHost:       p.config.MedaHost,
+		MedaPort:       p.config.MedaPort,
+		MedaEnv:        p.config.MedaEnv,
+		MedaWorkingDir: p.config.MedaWorkingDir,
+	}
+
+	for _, line := range p.config.Inline {
+		args, _ := splitArgs(line)
+		ui.Say("Running meda " + line)
+
+		cmd, err := driver.MedaCommand(medaConfig, args...)
+		if err != nil {
+			return err
+		}
+		if stderr, err := driver.RunStreaming(cmd, ui); err != nil {
+			return fmt.Errorf("meda %s failed: %s - %s", line, err, strings.TrimSpace(stderr))
+		}
+	}
+
+	api := driver.NewAPIDriver(medaConfig, ui)
+	for _, r := range p.config.APIRequests {
+		ui.Say(fmt.Sprintf("Sending %s %s to the Meda API", r.Method, r.Path))
+		output, err := api.Do(r.Method, strings.TrimPrefix(r.Path, "/"), r.Body)
+		if err != nil {
+			return fmt.Errorf("Meda API request failed: %s", err)
+		}
+		if output = strings.TrimSpace(output); output != "" {
+			ui.Message(output)
+		}
+	}
+	return nil
+}
+
+// splitArgs splits a command line into arguments. Single and double
+// quotes group words and a backslash escapes the next character; no
+// variables or globs are expanded.
+func splitArgs(line string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	inArg := false
+	var quote rune
+
+	runes := []rune(line)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != '\'' && r == '\\':
+			if i+1 == len(runes) {
+				return nil, fmt.Errorf("trailing backslash")
+			}
+			i++
+			current.WriteRune(runes[i])
+			inArg = true
+		case quote != 0:
+			current.WriteRune(r)
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case r == ' ' || r == '\t':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	if len(args) == 0 {
+		return nil, fmt.Errorf("empty command")
+	}
+	return args, nil
+}
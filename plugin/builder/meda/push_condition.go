@@ -0,0 +1,109 @@
+package meda
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// PushCondition restricts push_to_registry to matching builds, so one
+// template can build in pull request CI and push only from main. All set
+// conditions have to hold.
+type PushCondition struct {
+	// Env lists environment variables that must have the given values
+	Env map[string]string `mapstructure:"env"`
+	// Branch is a regular expression the current branch must match
+	Branch string `mapstructure:"branch"`
+	// SkipBranch is a regular expression the current branch must not match
+	SkipBranch string `mapstructure:"skip_branch"`
+	// TagPresent requires the build to run for a git tag
+	TagPresent bool `mapstructure:"tag_present"`
+}
+
+// prepare validates the condition's expressions
+func (p *PushCondition) prepare() []error {
+	var errs []error
+	if _, err := regexp.Compile(p.Branch); err != nil {
+		errs = append(errs, fmt.Errorf("push_condition.branch: %s", err))
+	}
+	if _, err := regexp.Compile(p.SkipBranch); err != nil {
+		errs = append(errs, fmt.Errorf("push_condition.skip_branch: %s", err))
+	}
+	return errs
+}
+
+// Evaluate reports whether the push should happen and, if not, why
+func (p *PushCondition) Evaluate() (ok bool, reason string) {
+	for _, k := range sortedKeys(p.Env) {
+		if v := os.Getenv(k); v != p.Env[k] {
+			return false, fmt.Sprintf("%s is %q, not %q", k, v, p.Env[k])
+		}
+	}
+
+	if p.Branch != "" || p.SkipBranch != "" {
+		branch := currentBranch()
+		if p.Branch != "" && !regexp.MustCompile(p.Branch).MatchString(branch) {
+			return false, fmt.Sprintf("branch %q does not match %q", branch, p.Branch)
+		}
+		if p.SkipBranch != "" && regexp.MustCompile(p.SkipBranch).MatchString(branch) {
+			return false, fmt.Sprintf("branch %q matches skip_branch %q", branch, p.SkipBranch)
+		}
+	}
+
+	if p.TagPresent && currentTag() == "" {
+		return false, "the build does not run for a git tag"
+	}
+	return true, ""
+}
+
+// currentBranch returns the branch being built, as reported by the CI
+// system or else by git. Pull request builds report their source branch.
+func currentBranch() string {
+	if os.Getenv("GITHUB_ACTIONS") == "true" {
+		if ref := os.Getenv("GITHUB_HEAD_REF"); ref != "" {
+			return ref
+		}
+		if os.Getenv("GITHUB_REF_TYPE") == "branch" {
+			return os.Getenv("GITHUB_REF_NAME")
+		}
+		return ""
+	}
+	for _, env := range []string{"CI_COMMIT_BRANCH", "CI_MERGE_REQUEST_SOURCE_BRANCH_NAME", "BUILDKITE_BRANCH", "CIRCLE_BRANCH", "BRANCH_NAME"} {
+		if v := os.Getenv(env); v != "" {
+			return v
+		}
+	}
+	branch := gitOutput("rev-parse", "--abbrev-ref", "HEAD")
+	if branch == "HEAD" {
+		return ""
+	}
+	return branch
+}
+
+// currentTag returns the git tag being built, if any
+func currentTag() string {
+	if os.Getenv("GITHUB_ACTIONS") == "true" {
+		if os.Getenv("GITHUB_REF_TYPE") == "tag" {
+			return os.Getenv("GITHUB_REF_NAME")
+		}
+		return ""
+	}
+	for _, env := range []string{"CI_COMMIT_TAG", "BUILDKITE_TAG", "CIRCLE_TAG", "TAG_NAME"} {
+		if v := os.Getenv(env); v != "" {
+			return v
+		}
+	}
+	return gitOutput("describe", "--exact-match", "--tags", "HEAD")
+}
+
+// gitOutput runs git in the working directory and returns its trimmed
+// output, or "" when git fails
+func gitOutput(args ...string) string {
+	out, err := exec.Command("git", args...).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
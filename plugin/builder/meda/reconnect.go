@@ -0,0 +1,276 @@
+package meda
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cirunlabs/packer-plugin-meda/driver"
+	"github.com/hashicorp/packer-plugin-sdk/communicator"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	sshcomm "github.com/hashicorp/packer-plugin-sdk/sdk-internals/communicator/ssh"
+	"golang.org/x/crypto/ssh"
+)
+
+// Backoff between attempts to reach the VM again after a dropped connection
+const (
+	reconnectInitialDelay = 2 * time.Second
+	reconnectMaxDelay     = 30 * time.Second
+)
+
+// sshClientConfig returns the SSH client configuration for the build VM.
+// Host keys are not checked since every build VM is new.
+func sshClientConfig(config *Config, state multistep.StateBag) (*ssh.ClientConfig, error) {
+	sshConfig, err := config.Comm.SSHConfigFunc()(state)
+	if err != nil {
+		return nil, err
+	}
+	sshConfig.HostKeyCallback = ssh.InsecureIgnoreHostKey()
+	return sshConfig, nil
+}
+
+// newStepConnect returns the step connecting to the build VM, directly or
+// through the local end of the Meda API tunnel
+func newStepConnect(config *Config) *communicator.StepConnect {
+	return &communicator.StepConnect{
+		Config: &config.Comm,
+		Host: func(state multistep.StateBag) (string, error) {
+			if config.SSHViaAPI {
+				return "127.0.0.1", nil
+			}
+			vmIP := state.Get("vm_ip").(string)
+			return vmIP, nil
+		},
+		SSHPort: func(state multistep.StateBag) (int, error) {
+			if port, ok := state.GetOk("api_proxy_port"); ok {
+				return port.(int), nil
+			}
+			return config.Comm.SSHPort, nil
+		},
+		SSHConfig: func(state multistep.StateBag) (*ssh.ClientConfig, error) {
+			return sshClientConfig(config, state)
+		},
+	}
+}
+
+// connectionLost reports whether err means the SSH connection is gone,
+// as opposed to a failure of the remote operation itself
+func connectionLost(err error) bool {
+	if err == nil {
+		return false
+	}
+	var netErr net.Error
+	if errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed) || errors.As(err, &netErr) {
+		return true
+	}
+	msg := err.Error()
+	for _, s := range []string{"connection reset", "broken pipe", "connection refused",
+		"client not available", "use of closed network connection", "i/o timeout", "handshake failed"} {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// reconnectingComm wraps the SSH communicator and connects again when the
+// connection drops, e.g. after the guest restarted its network or the OOM
+// killer took sshd down. The VM's IP is resolved again in case it changed.
+// A command running while the connection drops is not restarted: it ends
+// with packer.CmdDisconnect, which the shell provisioner's
+// expect_disconnect and start_retry_timeout options already handle.
+type reconnectingComm struct {
+	state   multistep.StateBag
+	timeout time.Duration
+
+	mu      sync.Mutex
+	comm    packer.Communicator
+	dropped bool
+}
+
+// current returns the communicator to use, connecting again first when
+// the previous command lost its connection
+func (c *reconnectingComm) current(ctx context.Context) packer.Communicator {
+	c.mu.Lock()
+	dropped := c.dropped
+	c.mu.Unlock()
+
+	if dropped {
+		if err := c.reconnect(ctx); err != nil {
+			log.Printf("Reconnect after dropped connection failed: %s", err)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.comm
+}
+
+// retry runs op and, if the connection was lost, runs it once more on a
+// new connection
+func (c *reconnectingComm) retry(ctx context.Context, op func(packer.Communicator) error) error {
+	err := op(c.current(ctx))
+	if !connectionLost(err) {
+		return err
+	}
+
+	log.Printf("SSH connection lost: %s", err)
+	if rerr := c.reconnect(ctx); rerr != nil {
+		return fmt.Errorf("%s (reconnect failed: %s)", err, rerr)
+	}
+	return op(c.current(ctx))
+}
+
+// reconnect resolves the VM's IP again and opens a new SSH connection,
+// backing off between attempts until the reconnect timeout
+func (c *reconnectingComm) reconnect(ctx context.Context) error {
+	config := c.state.Get("config").(*Config)
+	driver := c.state.Get("driver").(driver.MedaDriver)
+	ui := c.state.Get("ui").(packer.Ui)
+	vmName := c.state.Get("vm_name").(string)
+
+	ui.Say("Warning: SSH connection to the VM was lost, reconnecting...")
+
+	sshConfig, err := sshClientConfig(config, c.state)
+	if err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(c.timeout)
+	delay := reconnectInitialDelay
+	for {
+		ip, err := vmIP(driver, config, vmName)
+		if err == nil && (ip == "" || ip == "null") {
+			err = fmt.Errorf("VM has no IP address")
+		}
+		if err == nil {
+			address := net.JoinHostPort(ip, fmt.Sprint(config.Comm.SSHPort))
+			if port, ok := c.state.GetOk("api_proxy_port"); ok {
+				// The tunnel through the Meda API follows the VM by name
+				address = net.JoinHostPort("127.0.0.1", fmt.Sprint(port))
+			}
+			var comm packer.Communicator
+			comm, err = sshcomm.New(address, &sshcomm.Config{
+				Connection:             sshcomm.ConnectFunc("tcp", address),
+				SSHConfig:              sshConfig,
+				Pty:                    config.Comm.SSHPty,
+				DisableAgentForwarding: config.Comm.SSHDisableAgentForwarding,
+				UseSftp:                config.Comm.SSHFileTransferMethod == "sftp",
+				KeepAliveInterval:      config.Comm.SSHKeepAliveInterval,
+				Timeout:                config.Comm.SSHReadWriteTimeout,
+			})
+			if err == nil {
+				c.mu.Lock()
+				c.comm = comm
+				c.dropped = false
+				c.mu.Unlock()
+				c.state.Put("vm_ip", ip)
+				ui.Say(fmt.Sprintf("Reconnected to the VM at %s", address))
+				return nil
+			}
+		}
+		log.Printf("Reconnect attempt failed: %s", err)
+
+		if time.Now().Add(delay).After(deadline) {
+			return fmt.Errorf("could not reconnect within %s: %s", c.timeout, err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		if delay *= 2; delay > reconnectMaxDelay {
+			delay = reconnectMaxDelay
+		}
+	}
+}
+
+func (c *reconnectingComm) Start(ctx context.Context, cmd *packer.RemoteCmd) error {
+	err := c.retry(ctx, func(comm packer.Communicator) error {
+		return comm.Start(ctx, cmd)
+	})
+	if err != nil {
+		return err
+	}
+
+	// Remember a connection that dropped while the command ran, so the
+	// next operation connects again right away
+	go func() {
+		if cmd.Wait() == packer.CmdDisconnect {
+			c.mu.Lock()
+			c.dropped = true
+			c.mu.Unlock()
+		}
+	}()
+	return nil
+}
+
+func (c *reconnectingComm) Upload(path string, input io.Reader, fi *os.FileInfo) error {
+	// Only seekable input can be sent again after a partial upload
+	seeker, ok := input.(io.Seeker)
+	if !ok {
+		return c.current(context.Background()).Upload(path, input, fi)
+	}
+	start, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return c.current(context.Background()).Upload(path, input, fi)
+	}
+	return c.retry(context.Background(), func(comm packer.Communicator) error {
+		if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+			return err
+		}
+		return comm.Upload(path, input, fi)
+	})
+}
+
+func (c *reconnectingComm) UploadDir(dst string, src string, exclude []string) error {
+	return c.retry(context.Background(), func(comm packer.Communicator) error {
+		return comm.UploadDir(dst, src, exclude)
+	})
+}
+
+func (c *reconnectingComm) Download(path string, output io.Writer) error {
+	// Output already written can't be taken back, so there is no retry
+	err := c.current(context.Background()).Download(path, output)
+	if connectionLost(err) {
+		c.mu.Lock()
+		c.dropped = true
+		c.mu.Unlock()
+	}
+	return err
+}
+
+func (c *reconnectingComm) DownloadDir(src string, dst string, exclude []string) error {
+	return c.retry(context.Background(), func(comm packer.Communicator) error {
+		return comm.DownloadDir(src, dst, exclude)
+	})
+}
+
+// stepReconnectingCommunicator replaces the communicator StepConnect
+// created with one that survives dropped connections
+type stepReconnectingCommunicator struct{}
+
+func (s *stepReconnectingCommunicator) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	config := state.Get("config").(*Config)
+
+	comm, ok := state.GetOk("communicator")
+	if !ok {
+		return multistep.ActionContinue
+	}
+	state.Put("communicator", &reconnectingComm{
+		state:   state,
+		timeout: config.SSHReconnectTimeout,
+		comm:    comm.(packer.Communicator),
+	})
+	return multistep.ActionContinue
+}
+
+func (s *stepReconnectingCommunicator) Cleanup(state multistep.StateBag) {}
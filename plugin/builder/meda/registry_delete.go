@@ -0,0 +1,216 @@
+package meda
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// manifestMediaTypes are the manifest types asked for when resolving a tag
+var manifestMediaTypes = []string{
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+}
+
+// authParamPattern matches the key="value" pairs of a WWW-Authenticate
+// challenge
+var authParamPattern = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// registryClient talks to the OCI distribution API, with the token or
+// basic authentication the registry asks for
+type registryClient struct {
+	username string
+	password string
+	client   *http.Client
+	// actions are requested for the repository in token exchanges
+	actions string
+	// token is the bearer token of the last token exchange
+	token string
+}
+
+// newRegistryClient returns a client trusting caFile in addition to the
+// system roots. insecure skips certificate verification.
+func newRegistryClient(username, password string, insecure bool, caFile string) (*registryClient, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: insecure}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read registry CA file: %s", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	return &registryClient{
+		username: username,
+		password: password,
+		actions:  "pull,push,delete",
+		client: &http.Client{
+			Timeout:   time.Minute,
+			Transport: &http.Transport{TLSClientConfig: tlsConfig, Proxy: http.ProxyFromEnvironment},
+		},
+	}, nil
+}
+
+// deleteTag deletes the manifest ref (registry/repository:tag) points to.
+// It reports false when the tag does not exist.
+func (c *registryClient) deleteTag(ref string) (bool, error) {
+	host, repo, ok := strings.Cut(ref, "/")
+	tag := "latest"
+	if i := strings.LastIndex(repo, ":"); i >= 0 {
+		repo, tag = repo[:i], repo[i+1:]
+	}
+	if !ok || repo == "" {
+		return false, fmt.Errorf("%q is not a registry/repository:tag reference", ref)
+	}
+	base := "https://" + host + "/v2/" + repo + "/manifests/"
+
+	resp, err := c.do("HEAD", base+tag, repo)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("failed to resolve %s: %s", ref, resp.Status)
+	}
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		return false, fmt.Errorf("registry returned no digest for %s", ref)
+	}
+
+	resp, err = c.do("DELETE", base+digest, repo)
+	if err != nil {
+		return false, err
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusAccepted, http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	case http.StatusMethodNotAllowed, http.StatusUnsupportedMediaType:
+		return false, fmt.Errorf("registry %s does not allow deleting manifests (%s)", host, resp.Status)
+	}
+	return false, fmt.Errorf("failed to delete %s: %s - %s", ref, resp.Status, strings.TrimSpace(string(body)))
+}
+
+// do sends a registry request, authenticating and retrying once when the
+// registry challenges it
+func (c *registryClient) do(method, rawURL, repo string) (*http.Response, error) {
+	return c.doBody(method, rawURL, repo, "", nil)
+}
+
+// doBody is do for requests with a body of contentType
+func (c *registryClient) doBody(method, rawURL, repo, contentType string, body []byte) (*http.Response, error) {
+	resp, err := c.sendBody(method, rawURL, contentType, body)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	challenge := resp.Header.Get("WWW-Authenticate")
+	resp.Body.Close()
+
+	scheme, params, _ := strings.Cut(challenge, " ")
+	switch strings.ToLower(scheme) {
+	case "bearer":
+		if err := c.fetchToken(params, repo); err != nil {
+			return nil, err
+		}
+	case "basic":
+		if c.username == "" {
+			return nil, fmt.Errorf("registry requires credentials, set registry_username and registry_password")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported registry authentication %q", challenge)
+	}
+	return c.sendBody(method, rawURL, contentType, body)
+}
+
+func (c *registryClient) send(method, rawURL string) (*http.Response, error) {
+	return c.sendBody(method, rawURL, "", nil)
+}
+
+func (c *registryClient) sendBody(method, rawURL, contentType string, body []byte) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, rawURL, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", strings.Join(manifestMediaTypes, ", "))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	} else if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+	return c.client.Do(req)
+}
+
+// fetchToken exchanges the credentials for a bearer token with the
+// client's actions on repo at the realm of a Bearer challenge
+func (c *registryClient) fetchToken(params, repo string) error {
+	values := map[string]string{}
+	for _, m := range authParamPattern.FindAllStringSubmatch(params, -1) {
+		values[strings.ToLower(m[1])] = m[2]
+	}
+	if values["realm"] == "" {
+		return fmt.Errorf("registry token challenge has no realm")
+	}
+
+	query := url.Values{"scope": {"repository:" + repo + ":" + c.actions}}
+	if values["service"] != "" {
+		query.Set("service", values["service"])
+	}
+	req, err := http.NewRequest("GET", values["realm"]+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to get registry token: %s", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to get registry token: %s", resp.Status)
+	}
+
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return fmt.Errorf("failed to parse registry token: %s", err)
+	}
+	c.token = token.Token
+	if c.token == "" {
+		c.token = token.AccessToken
+	}
+	return nil
+}
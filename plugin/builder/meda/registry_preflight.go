@@ -0,0 +1,135 @@
+package meda
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// checkPush verifies that the client may push to repo on host by opening a
+// blob upload, which needs push rights, and cancelling it again. Nothing
+// is written to the repository.
+func (c *registryClient) checkPush(host, repo string) error {
+	c.actions = "pull,push"
+	resp, err := c.do("POST", "https://"+host+"/v2/"+repo+"/blobs/uploads/", repo)
+	if err != nil {
+		return err
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusAccepted:
+		if location := resp.Header.Get("Location"); location != "" {
+			if u, err := resp.Request.URL.Parse(location); err == nil {
+				if resp, err := c.send("DELETE", u.String()); err == nil {
+					resp.Body.Close()
+				}
+			}
+		}
+		return nil
+	case http.StatusUnauthorized:
+		return fmt.Errorf("%s rejected the credentials (%s)", host, resp.Status)
+	case http.StatusForbidden, http.StatusNotFound:
+		return fmt.Errorf("no permission to push to %s/%s (%s)", host, repo, resp.Status)
+	}
+	return fmt.Errorf("unexpected response from %s: %s - %s", host, resp.Status, strings.TrimSpace(string(body)))
+}
+
+// checkReachable verifies that the registry API of host answers at all.
+// With insecure, a plain-HTTP registry passes too.
+func (c *registryClient) checkReachable(host string, insecure bool) error {
+	resp, err := c.send("GET", "https://"+host+"/v2/")
+	if err != nil && insecure {
+		resp, err = c.send("GET", "http://"+host+"/v2/")
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("%s answered %s", host, resp.Status)
+	}
+	return nil
+}
+
+// medaEnv returns the variable key of the environment meda runs with
+func medaEnv(config *Config, key string) string {
+	if v := config.MedaEnv[key]; v != "" {
+		return v
+	}
+	return os.Getenv(key)
+}
+
+// newPushRegistryClient returns a client with the credentials meda pushes
+// to the registry with, as far as the plugin knows them: GITHUB_TOKEN for
+// GHCR, none otherwise
+func newPushRegistryClient(config *Config) (*registryClient, error) {
+	username, password := "", ""
+	if strings.Contains(config.Registry, "ghcr.io") {
+		password = medaEnv(config, "GITHUB_TOKEN")
+		if password == "" {
+			return nil, fmt.Errorf("GITHUB_TOKEN environment variable is required for pushing to GHCR")
+		}
+		// GHCR accepts any user name with a token
+		username = medaEnv(config, "GITHUB_ACTOR")
+		if username == "" {
+			username = "token"
+		}
+	}
+	return newRegistryClient(username, password, config.RegistryInsecure.True(), config.RegistryCAFile)
+}
+
+// stepRegistryPreflight checks before any VM is created that the push at
+// the end of the build can succeed, so a wrong token fails the build in
+// seconds. For GHCR, GITHUB_TOKEN and push permission on the repository
+// are verified; other registries are only checked for reachability, the
+// credentials meda uses for them aren't known to the plugin.
+type stepRegistryPreflight struct{}
+
+func (s *stepRegistryPreflight) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	config := state.Get("config").(*Config)
+	ui := state.Get("ui").(packer.Ui)
+
+	if config.PushCondition != nil {
+		if ok, _ := config.PushCondition.Evaluate(); !ok {
+			return multistep.ActionContinue
+		}
+	}
+
+	halt := func(err error) multistep.StepAction {
+		err = fmt.Errorf("registry pre-flight check failed: %s", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	ghcr := strings.Contains(config.Registry, "ghcr.io")
+	client, err := newPushRegistryClient(config)
+	if err != nil {
+		return halt(err)
+	}
+	host, repo, _ := strings.Cut(config.registryRepository(), "/")
+
+	if !ghcr {
+		ui.Say(fmt.Sprintf("Checking that registry %s is reachable", host))
+		if err := client.checkReachable(host, config.RegistryInsecure.True()); err != nil {
+			return halt(err)
+		}
+		return multistep.ActionContinue
+	}
+
+	ui.Say(fmt.Sprintf("Checking push access to %s/%s", host, repo))
+	if err := client.checkPush(host, repo); err != nil {
+		return halt(err)
+	}
+	return multistep.ActionContinue
+}
+
+func (s *stepRegistryPreflight) Cleanup(state multistep.StateBag) {}
@@ -0,0 +1,78 @@
+package meda
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/cirunlabs/packer-plugin-meda/driver"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// Backoff between registry retries without a Retry-After from the registry
+const (
+	registryRetryInitialDelay = 5 * time.Second
+	registryRetryMaxDelay     = 2 * time.Minute
+)
+
+// retryAfterPattern finds a Retry-After value in seconds in a meda error
+var retryAfterPattern = regexp.MustCompile(`(?i)retry[- ]after:?\s*(\d+)`)
+
+// registryRetryDelay reports whether err is a rate limit or a transient
+// registry error, and how long to wait before the next attempt: what the
+// registry asked for with Retry-After, or else backoff. Other quota errors
+// don't clear by waiting and aren't retried.
+func registryRetryDelay(err error, backoff time.Duration) (time.Duration, bool) {
+	if !errors.Is(err, driver.ErrRateLimited) && !errors.Is(err, driver.ErrUnavailable) {
+		return 0, false
+	}
+
+	retryAfter := ""
+	var apiErr *driver.APIError
+	if errors.As(err, &apiErr) {
+		retryAfter = apiErr.RetryAfter
+	}
+	if m := retryAfterPattern.FindStringSubmatch(err.Error()); retryAfter == "" && m != nil {
+		retryAfter = m[1]
+	}
+	if seconds, err := strconv.Atoi(retryAfter); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := time.Parse(time.RFC1123, retryAfter); err == nil && time.Until(t) > 0 {
+		return time.Until(t).Round(time.Second), true
+	}
+	return backoff, true
+}
+
+// retryRegistry runs op, which talks to a registry, and retries it on rate
+// limits and transient server errors until budget is used up
+func retryRegistry(ctx context.Context, ui packer.Ui, budget time.Duration, what string, op func() error) error {
+	deadline := time.Now().Add(budget)
+	backoff := registryRetryInitialDelay
+
+	for attempt := 1; ; attempt++ {
+		err := op()
+		if err == nil {
+			return nil
+		}
+		delay, ok := registryRetryDelay(err, backoff)
+		if !ok {
+			return err
+		}
+		if time.Now().Add(delay).After(deadline) {
+			return fmt.Errorf("%s (giving up after %d attempts within registry_retry_budget %s)", err, attempt, budget)
+		}
+
+		ui.Say(fmt.Sprintf("Registry is rate limiting or unavailable while %s, retrying in %s (attempt %d): %s",
+			what, delay, attempt+1, err))
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		backoff = min(backoff*2, registryRetryMaxDelay)
+	}
+}
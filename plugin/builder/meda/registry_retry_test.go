@@ -0,0 +1,91 @@
+package meda
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cirunlabs/packer-plugin-meda/driver"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+func TestRegistryRetryDelay(t *testing.T) {
+	backoff := 5 * time.Second
+	tests := map[string]struct {
+		err       error
+		retry     bool
+		wantDelay time.Duration
+	}{
+		"rate limited":        {fmt.Errorf("push: %w", driver.ErrRateLimited), true, backoff},
+		"unavailable":         {fmt.Errorf("push: %w", driver.ErrUnavailable), true, backoff},
+		"retry after":         {fmt.Errorf("%w: retry after 3", driver.ErrRateLimited), true, 3 * time.Second},
+		"used up quota":       {fmt.Errorf("push: %w", driver.ErrQuota), false, 0},
+		"not found":           {fmt.Errorf("push: %w", driver.ErrNotFound), false, 0},
+		"status only in text": {fmt.Errorf("exit status 1 - blob 503 bytes"), false, 0},
+		"plain error":         {fmt.Errorf("boom"), false, 0},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			delay, retry := registryRetryDelay(tt.err, backoff)
+			if retry != tt.retry || delay != tt.wantDelay {
+				t.Errorf("registryRetryDelay(%v) = %s, %v, want %s, %v", tt.err, delay, retry, tt.wantDelay, tt.retry)
+			}
+		})
+	}
+}
+
+// The base image is pulled by `meda run`, a 429 from the registry is retried
+// after removing what the failed attempt left behind
+func TestStepCreateVM_retriesRateLimitedPull(t *testing.T) {
+	dir := t.TempDir()
+	meda := filepath.Join(dir, "meda")
+	script := fmt.Sprintf(`#!/bin/sh
+case "$1" in
+delete) echo "$2" >> %[1]s/deleted ;;
+run)
+	if [ ! -e %[1]s/attempted ]; then
+		touch %[1]s/attempted
+		echo 'Pulling ubuntu:latest'
+		echo 'Error: 429 Too Many Requests, retry after 1' >&2
+		exit 1
+	fi
+	echo "$@" > %[1]s/created ;;
+esac
+`, dir)
+	if err := os.WriteFile(meda, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	config := &Config{
+		MedaBinary:          meda,
+		BaseImage:           "ubuntu:latest",
+		Memory:              "1G",
+		CPUs:                1,
+		DiskSize:            "10G",
+		RegistryRetryBudget: time.Minute,
+	}
+	ui := packer.TestUi(t)
+	state := new(multistep.BasicStateBag)
+	state.Put("config", config)
+	state.Put("ui", ui)
+	state.Put("driver", driver.NewDriver(config.DriverConfig(), ui))
+	state.Put("vm_name", "packer-test")
+
+	if action := (&stepCreateVM{}).Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("step halted: %v", state.Get("error"))
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "created")); err != nil {
+		t.Errorf("VM was not created on the second attempt: %s", err)
+	}
+	deleted, _ := os.ReadFile(filepath.Join(dir, "deleted"))
+	if strings.TrimSpace(string(deleted)) != "packer-test" {
+		t.Errorf("deleted %q before retrying, want packer-test", deleted)
+	}
+}
@@ -0,0 +1,85 @@
+package meda
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/cirunlabs/packer-plugin-meda/driver"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// replicateImage streams image from the build host's Meda to the Meda
+// API server target and returns the number of bytes transferred
+func replicateImage(driver, target driver.MedaDriver, image string) (int64, error) {
+	if err := target.Ping(); err != nil {
+		return 0, err
+	}
+	src, err := driver.ExportImageStream(image, "oci")
+	if err != nil {
+		return 0, fmt.Errorf("failed to export image: %s", err)
+	}
+	counter := &countingReader{r: src}
+	err = target.ImportImageStream(counter, image)
+	if cerr := src.Close(); err == nil && cerr != nil {
+		err = fmt.Errorf("failed to export image: %s", cerr)
+	}
+	return counter.n, err
+}
+
+// stepReplicateImage copies the built image straight to the Meda hosts of
+// replicate_to, without a registry in between
+type stepReplicateImage struct{}
+
+func (s *stepReplicateImage) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	config := state.Get("config").(*Config)
+	d := state.Get("driver").(driver.MedaDriver)
+	ui := state.Get("ui").(packer.Ui)
+	imageName := state.Get("image_name").(string)
+
+	var replicated []string
+	for _, entry := range config.ReplicateTo {
+		host, port, _ := medaHostAddress(entry, 7777)
+		addr := net.JoinHostPort(host, strconv.Itoa(port))
+		// Through NewDriver like the build's driver, so the audit log and
+		// mock mode cover the target too
+		targetConfig := config.DriverConfig()
+		targetConfig.MedaHost = host
+		targetConfig.MedaPort = port
+		targetConfig.UseAPI = true
+		target := driver.NewDriver(targetConfig, ui)
+
+		ui.Say(fmt.Sprintf("Replicating image '%s' to %s", imageName, addr))
+		started := time.Now()
+		n, err := replicateImage(d, target, imageName)
+		if err != nil {
+			err := fmt.Errorf("failed to replicate image to %s: %s", addr, err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+		ui.Say(fmt.Sprintf("Replicated %s to %s in %s", driver.FormatBytes(n), addr, time.Since(started).Round(time.Second)))
+		replicated = append(replicated, addr)
+	}
+
+	state.Put("replicated_to", replicated)
+	return multistep.ActionContinue
+}
+
+func (s *stepReplicateImage) Cleanup(state multistep.StateBag) {}
@@ -0,0 +1,123 @@
+package meda
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/cirunlabs/packer-plugin-meda/driver"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// rootFSSizeCommand prints the device, type and size in KiB of the root
+// filesystem
+const rootFSSizeCommand = `awk '$2 == "/" { dev = $1; fs = $3 } END { print dev, fs }' /proc/mounts; df -Pk / | awk 'NR == 2 { print $2 }'`
+
+// growRootFSCommand grows the partition of the root filesystem to the end
+// of its disk and the filesystem to the partition. growpart exits 1 when
+// there is nothing to grow.
+const growRootFSCommand = `set -e
+dev=$(awk '$2 == "/" { dev = $1 } END { print dev }' /proc/mounts)
+fs=$(awk '$2 == "/" { fs = $3 } END { print fs }' /proc/mounts)
+dev=$(readlink -f "$dev")
+name=$(basename "$dev")
+if [ -r "/sys/class/block/$name/partition" ]; then
+  part=$(cat "/sys/class/block/$name/partition")
+  disk=/dev/$(basename "$(readlink -f "/sys/class/block/$name/..")")
+  command -v growpart >/dev/null 2>&1 || { echo "growpart is not installed" >&2; exit 3; }
+  rc=0; %[1]sgrowpart "$disk" "$part" || rc=$?
+  [ "$rc" -le 1 ] || exit "$rc"
+fi
+case "$fs" in
+  ext2|ext3|ext4) %[1]sresize2fs "$dev" ;;
+  xfs) %[1]sxfs_growfs / ;;
+  btrfs) %[1]sbtrfs filesystem resize max / ;;
+  *) echo "can't grow a $fs root filesystem" >&2; exit 3 ;;
+esac`
+
+// rootFS is the root filesystem of the guest
+type rootFS struct {
+	Device string
+	Type   string
+	Size   int64
+}
+
+// parseRootFS parses the output of rootFSSizeCommand
+func parseRootFS(output string) (*rootFS, error) {
+	fields := strings.Fields(output)
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("unexpected output %q", strings.TrimSpace(output))
+	}
+	kib, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("unexpected size %q", fields[2])
+	}
+	return &rootFS{Device: fields[0], Type: fields[1], Size: kib * 1024}, nil
+}
+
+// minRootFSSize is the smallest root filesystem that counts as filling a
+// disk of diskSize. Partition tables, boot partitions and filesystem
+// metadata take up to a tenth of the disk, or 1 GiB on small disks.
+func minRootFSSize(diskSize int64) int64 {
+	return diskSize - max(diskSize/10, 1<<30)
+}
+
+// stepGrowRootFS makes sure the root filesystem fills disk_size before
+// provisioning. cloud-init usually grows it on boot, but not every base
+// image runs growpart, so it is grown over the communicator when it is
+// still small.
+type stepGrowRootFS struct{}
+
+func (s *stepGrowRootFS) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	config := state.Get("config").(*Config)
+	comm := state.Get("communicator").(packer.Communicator)
+	ui := state.Get("ui").(packer.Ui)
+
+	diskSize, err := parseSize(config.DiskSize)
+	if err != nil {
+		ui.Say(fmt.Sprintf("Warning: not checking the root filesystem size: disk_size: %s", err))
+		return multistep.ActionContinue
+	}
+	want := minRootFSSize(diskSize)
+
+	halt := func(err error) multistep.StepAction {
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+	check := func() (*rootFS, error) {
+		output, err := runRemote(ctx, comm, rootFSSizeCommand)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check the root filesystem size: %s", err)
+		}
+		return parseRootFS(output)
+	}
+
+	root, err := check()
+	if err != nil {
+		return halt(err)
+	}
+	if root.Size >= want {
+		return multistep.ActionContinue
+	}
+
+	ui.Say(fmt.Sprintf("Root filesystem %s is %s, growing it to fill the %s disk", root.Device, driver.FormatBytes(root.Size), config.DiskSize))
+	if _, err := runRemote(ctx, comm, fmt.Sprintf(growRootFSCommand, sudoPrefix(config.Comm.SSHUsername))); err != nil {
+		return halt(fmt.Errorf("failed to grow the root filesystem: %s", err))
+	}
+
+	root, err = check()
+	if err != nil {
+		return halt(err)
+	}
+	if root.Size < want {
+		return halt(fmt.Errorf("root filesystem is %s after growing it, expected at least %s for disk_size %s",
+			driver.FormatBytes(root.Size), driver.FormatBytes(want), config.DiskSize))
+	}
+	ui.Say(fmt.Sprintf("Root filesystem grown to %s", driver.FormatBytes(root.Size)))
+	return multistep.ActionContinue
+}
+
+func (s *stepGrowRootFS) Cleanup(state multistep.StateBag) {}
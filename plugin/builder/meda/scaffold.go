@@ -0,0 +1,154 @@
+package meda
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cirunlabs/packer-plugin-meda/version"
+)
+
+// scaffoldTemplate is the example template written by the scaffold
+// command. %[1]s is the source and image name, %[2]s the plugin version.
+const scaffoldTemplate = `packer {
+  required_plugins {
+    meda = {
+      version = ">= %[2]s"
+      source  = "github.com/cirunlabs/meda"
+    }
+  }
+}
+
+variable "image_tag" {
+  type        = string
+  default     = "latest"
+  description = "Tag for the output image"
+}
+
+variable "registry" {
+  type        = string
+  default     = "ghcr.io"
+  description = "Container registry to push to"
+}
+
+variable "organization" {
+  type        = string
+  default     = env("GITHUB_REPOSITORY_OWNER")
+  description = "Registry organization/namespace"
+}
+
+variable "push_enabled" {
+  type        = bool
+  default     = false
+  description = "Whether to push the image to the registry"
+}
+
+source "meda-vm" "%[1]s" {
+  # VM configuration, these are the defaults
+  vm_name        = "%[1]s-build"
+  base_image     = "ubuntu-base:latest"
+  memory         = "1G"
+  cpus           = 2
+  disk_size      = "10G"
+  user_data_file = "${path.root}/user-data.yaml"
+
+  # Output configuration
+  output_image_name = "%[1]s"
+  output_tag        = var.image_tag
+  registry          = var.registry
+  organization      = var.organization
+
+  # Push configuration, disabled until you set push_enabled
+  push_to_registry = var.push_enabled
+
+  # SSH configuration, matching user-data.yaml
+  ssh_username = "packer"
+  ssh_password = "packer"
+  ssh_timeout  = "5m"
+}
+
+build {
+  sources = ["source.meda-vm.%[1]s"]
+
+  provisioner "shell" {
+    inline = [
+      "sudo apt-get update",
+      "sudo apt-get install -y curl",
+      "echo 'Provisioned %[1]s'"
+    ]
+  }
+}
+`
+
+// scaffoldUserData is the example user-data matching the SSH settings of
+// scaffoldTemplate
+const scaffoldUserData = `#cloud-config
+users:
+  - name: packer
+    sudo: ALL=(ALL) NOPASSWD:ALL
+    shell: /bin/bash
+    lock_passwd: false
+    plain_text_passwd: packer
+ssh_pwauth: true
+`
+
+// runScaffold implements the scaffold command, writing an example template
+// and user-data file to get started with the builder
+func runScaffold(args []string, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet("scaffold", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: packer-plugin-meda scaffold [options]")
+		fmt.Fprintln(stderr, "\nWrites an example Packer template and user-data file for the meda-vm builder.")
+		fmt.Fprintln(stderr, "\nOptions:")
+		flags.PrintDefaults()
+	}
+	dir := flags.String("dir", ".", "directory to write the files to")
+	name := flags.String("name", "example", "name of the source and the output image")
+	force := flags.Bool("force", false, "overwrite existing files")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return fmt.Errorf("unexpected arguments: %s", strings.Join(flags.Args(), " "))
+	}
+	if !ociPathComponentPattern.MatchString(*name) {
+		return fmt.Errorf("name %q is not a valid image name: use lowercase letters, digits and '.', '_' or '-' separators", *name)
+	}
+
+	files := []struct {
+		name    string
+		content string
+	}{
+		{"template.pkr.hcl", fmt.Sprintf(scaffoldTemplate, *name, version.Version)},
+		{"user-data.yaml", scaffoldUserData},
+	}
+	if !*force {
+		for _, f := range files {
+			path := filepath.Join(*dir, f.name)
+			if _, err := os.Stat(path); err == nil {
+				return fmt.Errorf("%s already exists, use -force to overwrite it", path)
+			} else if !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+	}
+
+	if err := os.MkdirAll(*dir, 0755); err != nil {
+		return err
+	}
+	for _, f := range files {
+		path := filepath.Join(*dir, f.name)
+		if err := os.WriteFile(path, []byte(f.content), 0644); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "Wrote %s\n", path)
+	}
+	fmt.Fprintf(stdout, "\nRun it with:\n  packer init %[1]s\n  packer build %[1]s\n", *dir)
+	return nil
+}
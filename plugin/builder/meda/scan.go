@@ -0,0 +1,202 @@
+package meda
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// scanSeverities lists the vulnerability severities in ascending order
+var scanSeverities = []string{"LOW", "MEDIUM", "HIGH", "CRITICAL"}
+
+// Guest paths used while scanning; both are removed afterwards
+const (
+	scanToolDir    = "/tmp/meda-scan"
+	scanReportPath = "/tmp/meda-scan/report.json"
+)
+
+// ScanConfig configures the vulnerability scan that gates the push
+type ScanConfig struct {
+	// Enabled turns the scan on
+	Enabled bool `mapstructure:"enabled"`
+	// Scanner is the scanning tool. Only trivy is supported.
+	Scanner string `mapstructure:"scanner"`
+	// SeverityThreshold is the lowest severity that blocks the push:
+	// LOW, MEDIUM, HIGH or CRITICAL
+	SeverityThreshold string `mapstructure:"severity_threshold"`
+	// IgnoreUnfixed skips vulnerabilities without a fixed version
+	IgnoreUnfixed bool `mapstructure:"ignore_unfixed"`
+	// ReportFile is where the scan report is written. Defaults to
+	// <output_image_name>-<output_tag>-scan.json.
+	ReportFile string `mapstructure:"report_file"`
+}
+
+// prepare applies defaults and validates the scan configuration
+func (s *ScanConfig) prepare(c *Config) []error {
+	var errs []error
+
+	if s.Scanner == "" {
+		s.Scanner = "trivy"
+	}
+	if s.SeverityThreshold == "" {
+		s.SeverityThreshold = "HIGH"
+	}
+	s.SeverityThreshold = strings.ToUpper(s.SeverityThreshold)
+	if s.ReportFile == "" {
+		s.ReportFile = fmt.Sprintf("%s-%s-scan.json", c.OutputImageName, c.OutputTag)
+	}
+
+	if s.Scanner != "trivy" {
+		errs = append(errs, fmt.Errorf("scan.scanner must be trivy, got %q", s.Scanner))
+	}
+	if s.severities() == nil {
+		errs = append(errs, fmt.Errorf("scan.severity_threshold must be one of %s, got %q",
+			strings.Join(scanSeverities, ", "), s.SeverityThreshold))
+	}
+	if s.Enabled && c.Comm.Type != "ssh" {
+		errs = append(errs, fmt.Errorf("scan requires the ssh communicator"))
+	}
+	return errs
+}
+
+// severities returns the threshold and every severity above it
+func (s *ScanConfig) severities() []string {
+	for i, severity := range scanSeverities {
+		if severity == s.SeverityThreshold {
+			return scanSeverities[i:]
+		}
+	}
+	return nil
+}
+
+// command returns the guest command running the scanner against the root
+// filesystem. trivy is installed into scanToolDir if the guest lacks it.
+func (s *ScanConfig) command(sudo string) string {
+	args := []string{
+		"rootfs", "--quiet", "--scanners", "vuln",
+		"--severity", strings.Join(s.severities(), ","),
+		"--skip-dirs", "/proc,/sys,/dev,/run," + scanToolDir,
+		"--format", "json", "--output", scanReportPath,
+	}
+	if s.IgnoreUnfixed {
+		args = append(args, "--ignore-unfixed")
+	}
+	args = append(args, "/")
+
+	script := strings.Join([]string{
+		"set -e",
+		"mkdir -p " + scanToolDir,
+		"TRIVY=$(command -v trivy || true)",
+		"if [ -z \"$TRIVY\" ]; then curl -sfL https://raw.githubusercontent.com/aquasecurity/trivy/main/contrib/install.sh | sh -s -- -b " + scanToolDir + " >/dev/null; TRIVY=" + scanToolDir + "/trivy; fi",
+		sudo + "$TRIVY " + strings.Join(args, " "),
+		sudo + "chmod 644 " + scanReportPath,
+	}, "\n")
+	return "sh -c '" + script + "'"
+}
+
+// scanReport is the part of trivy's JSON report the gate looks at
+type scanReport struct {
+	Results []struct {
+		Target          string `json:"Target"`
+		Vulnerabilities []struct {
+			VulnerabilityID string `json:"VulnerabilityID"`
+			PkgName         string `json:"PkgName"`
+			Severity        string `json:"Severity"`
+		} `json:"Vulnerabilities"`
+	} `json:"Results"`
+}
+
+// counts returns the number of findings per severity
+func (r *scanReport) counts() map[string]int {
+	counts := map[string]int{}
+	for _, result := range r.Results {
+		for _, v := range result.Vulnerabilities {
+			counts[v.Severity]++
+		}
+	}
+	return counts
+}
+
+// stepScan scans the provisioned guest for vulnerabilities. Findings at or
+// above the threshold block the push; the image itself is still created so
+// it can be inspected.
+type stepScan struct{}
+
+func (s *stepScan) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	config := state.Get("config").(*Config)
+	comm := state.Get("communicator").(packer.Communicator)
+	ui := state.Get("ui").(packer.Ui)
+	scan := config.Scan
+
+	ui.Say(fmt.Sprintf("Scanning guest for %s vulnerabilities with %s", strings.Join(scan.severities(), "/"), scan.Scanner))
+
+	sudo := sudoPrefix(config.Comm.SSHUsername)
+	defer func() {
+		if _, err := runRemote(ctx, comm, sudo+"rm -rf "+scanToolDir); err != nil {
+			ui.Say(fmt.Sprintf("Warning: failed to remove scanner files from the guest: %s", err))
+		}
+	}()
+
+	if _, err := runRemote(ctx, comm, scan.command(sudo)); err != nil {
+		err := fmt.Errorf("vulnerability scan failed: %s", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	var data bytes.Buffer
+	if err := comm.Download(scanReportPath, &data); err != nil {
+		err := fmt.Errorf("failed to download scan report: %s", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	err := os.MkdirAll(filepath.Dir(scan.ReportFile), 0755)
+	if err == nil {
+		err = os.WriteFile(scan.ReportFile, data.Bytes(), 0644)
+	}
+	if err != nil {
+		ui.Say(fmt.Sprintf("Warning: failed to write scan report: %s", err))
+	}
+
+	var report scanReport
+	if err := json.Unmarshal(data.Bytes(), &report); err != nil {
+		err := fmt.Errorf("failed to parse scan report: %s", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	counts := report.counts()
+	var found []string
+	for _, severity := range scan.severities() {
+		if counts[severity] > 0 {
+			found = append(found, fmt.Sprintf("%d %s", counts[severity], severity))
+		}
+	}
+
+	summary := "no vulnerabilities at or above " + scan.SeverityThreshold
+	if len(found) > 0 {
+		summary = strings.Join(found, ", ")
+		state.Put("scan_blocked", fmt.Sprintf("scan found %s vulnerabilities, see %s", summary, scan.ReportFile))
+		ui.Say(fmt.Sprintf("Warning: scan found %s vulnerabilities, the image will not be pushed", summary))
+	} else {
+		ui.Say("Scan passed: " + summary)
+	}
+	ui.Say("Scan report written to " + scan.ReportFile)
+
+	if inGitHubActions() {
+		appendGitHubFile("GITHUB_STEP_SUMMARY", fmt.Sprintf("### Vulnerability scan\n\n%s (report: `%s`)\n\n", summary, scan.ReportFile))
+	}
+	return multistep.ActionContinue
+}
+
+func (s *stepScan) Cleanup(state multistep.StateBag) {}
@@ -0,0 +1,418 @@
+package meda
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// serialMarker prefixes the lines the serial communicator prints around
+// every command. The markers are printed from two printf arguments, so
+// the echo of the typed command never contains them.
+const serialMarker = "PACKER-SERIAL"
+
+const (
+	// serialPromptTimeout is how long a prompt may take to appear after
+	// a key press before the console is probed again
+	serialPromptTimeout = 3 * time.Second
+	// serialStartTimeout bounds the wait for a command to start
+	serialStartTimeout = 30 * time.Second
+	// serialWriteChunk and serialWriteDelay pace input, a guest tty drops
+	// what overflows its buffer
+	serialWriteChunk = 512
+	serialWriteDelay = 5 * time.Millisecond
+	// serialBufferLimit caps the console output kept while waiting for a
+	// prompt, boot messages can be long
+	serialBufferLimit = 64 * 1024
+)
+
+var errSerialTimeout = errors.New("timed out waiting for the serial console")
+
+// isLoopbackHost reports whether host is this machine, where the serial
+// console socket Meda creates can be reached
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// serialComm runs commands through a shell on the VM's serial console,
+// for guests without a usable network. Output of commands is found
+// between marker lines; stdout and stderr both arrive on the console and
+// are returned as stdout. Files are transferred base64 encoded.
+type serialComm struct {
+	mu    sync.Mutex
+	conn  net.Conn
+	buf   []byte
+	chunk [4096]byte
+	seq   int
+}
+
+// connectSerial connects to the console socket of the VM and logs in.
+// The socket is created by Meda when the VM starts, it is retried until
+// timeout.
+func connectSerial(ctx context.Context, path, user, password string, timeout time.Duration) (*serialComm, error) {
+	deadline := time.Now().Add(timeout)
+	var conn net.Conn
+	for {
+		var err error
+		conn, err = net.DialTimeout("unix", path, 5*time.Second)
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("failed to connect to serial console %s: %s", path, err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+
+	c := &serialComm{conn: conn}
+	if err := c.login(ctx, user, password, time.Until(deadline)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// login gets a shell on the console: it answers login and password
+// prompts, and otherwise probes for an already running shell
+func (c *serialComm) login(ctx context.Context, user, password string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	send := "\n"
+	probe := 0
+	failed := false
+	for {
+		if time.Now().After(deadline) {
+			if failed {
+				return fmt.Errorf("serial console login as %q failed", user)
+			}
+			return fmt.Errorf("no shell on the serial console after %s", timeout)
+		}
+		if err := c.write(send); err != nil {
+			return err
+		}
+
+		ready := fmt.Sprintf("%s-READY-%d", serialMarker, probe)
+		patterns := []string{"login:", "assword:", "Login incorrect", ready}
+		i, _, err := c.expect(ctx, serialPromptTimeout, patterns...)
+		if err == nil {
+			// getty prints a new prompt for every empty line, only the
+			// latest one is answered
+			if err = c.settle(ctx); err == nil {
+				i = max(i, lastMatch(c.buf, patterns))
+				c.buf = nil
+			}
+		}
+		switch {
+		case errors.Is(err, errSerialTimeout):
+			// No prompt: a shell that is already logged in, or a guest
+			// that is still booting
+			probe++
+			send = fmt.Sprintf("printf '%%s-%%d\\n' '%s-READY' %d\n", serialMarker, probe)
+			continue
+		case err != nil:
+			return err
+		}
+		switch i {
+		case 0:
+			send = user + "\n"
+		case 1:
+			send = password + "\n"
+		case 2:
+			// cloud-init may not have set the password yet
+			failed = true
+			send = ""
+		case 3:
+			return nil
+		}
+	}
+}
+
+// settle reads until the console has been quiet for a moment
+func (c *serialComm) settle(ctx context.Context) error {
+	for {
+		err := c.read(ctx, time.Now().Add(500*time.Millisecond))
+		if errors.Is(err, errSerialTimeout) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// lastMatch returns the index of the pattern occurring last in data, or
+// -1 if none does
+func lastMatch(data []byte, patterns []string) int {
+	last, lastAt := -1, -1
+	for i, p := range patterns {
+		if at := bytes.LastIndex(data, []byte(p)); at > lastAt {
+			last, lastAt = i, at
+		}
+	}
+	return last
+}
+
+// write sends s to the console in paced chunks
+func (c *serialComm) write(s string) error {
+	for len(s) > 0 {
+		n := min(len(s), serialWriteChunk)
+		if _, err := io.WriteString(c.conn, s[:n]); err != nil {
+			return fmt.Errorf("failed to write to serial console: %s", err)
+		}
+		s = s[n:]
+		if len(s) > 0 {
+			time.Sleep(serialWriteDelay)
+		}
+	}
+	return nil
+}
+
+// read appends console output to c.buf. A zero deadline waits until
+// output arrives or ctx is done.
+func (c *serialComm) read(ctx context.Context, deadline time.Time) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !deadline.IsZero() && !time.Now().Before(deadline) {
+			return errSerialTimeout
+		}
+		wait := time.Now().Add(time.Second)
+		if !deadline.IsZero() && wait.After(deadline) {
+			wait = deadline
+		}
+		c.conn.SetReadDeadline(wait)
+		n, err := c.conn.Read(c.chunk[:])
+		c.buf = append(c.buf, c.chunk[:n]...)
+		if n > 0 {
+			return nil
+		}
+		var netErr net.Error
+		if err != nil && !(errors.As(err, &netErr) && netErr.Timeout()) {
+			return fmt.Errorf("failed to read from serial console: %s", err)
+		}
+	}
+}
+
+// expect reads until one of patterns appears and returns its index with
+// the output before it. Everything up to the end of the match is consumed.
+func (c *serialComm) expect(ctx context.Context, timeout time.Duration, patterns ...string) (int, []byte, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		first, firstAt := -1, len(c.buf)
+		for i, p := range patterns {
+			if at := bytes.Index(c.buf, []byte(p)); at >= 0 && at < firstAt {
+				first, firstAt = i, at
+			}
+		}
+		if first >= 0 {
+			before := c.buf[:firstAt]
+			c.buf = c.buf[firstAt+len(patterns[first]):]
+			return first, before, nil
+		}
+		if len(c.buf) > serialBufferLimit {
+			c.buf = c.buf[len(c.buf)-serialBufferLimit/2:]
+		}
+		if err := c.read(ctx, deadline); err != nil {
+			return -1, nil, err
+		}
+	}
+}
+
+// run runs command in a subshell with stdin fed from a base64 heredoc,
+// streaming its output to out, and returns its exit status
+func (c *serialComm) run(ctx context.Context, command string, stdin []byte, out io.Writer) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.seq++
+	begin := fmt.Sprintf("%s-BEGIN-%d", serialMarker, c.seq)
+	end := fmt.Sprintf("%s-END-%d", serialMarker, c.seq)
+
+	script := fmt.Sprintf("(\n%s\n) </dev/null", command)
+	if stdin != nil {
+		eof := fmt.Sprintf("%s-EOF-%d", serialMarker, c.seq)
+		script = fmt.Sprintf("base64 -d <<'%s' | (\n%s\n%s\n%s\n)", eof, wrapBase64(stdin), eof, command)
+	}
+	line := fmt.Sprintf("printf '%%s-%%d\\n' '%[1]s-BEGIN' %[2]d; %[3]s; printf '\\n%%s-%%d %%d\\n' '%[1]s-END' %[2]d $?\n",
+		serialMarker, c.seq, script)
+	log.Printf("Serial console: running %q", command)
+	if err := c.write(line); err != nil {
+		return 0, err
+	}
+	if _, _, err := c.expect(ctx, serialStartTimeout, begin); err != nil {
+		return 0, fmt.Errorf("command did not start on the serial console: %s", err)
+	}
+	if _, _, err := c.expect(ctx, serialStartTimeout, "\n"); err != nil {
+		return 0, err
+	}
+
+	// Stream the output, holding back what could be the start of the end
+	// marker and the newline printed before it
+	keep := len(end) + 2
+	for {
+		if at := bytes.Index(c.buf, []byte(end)); at >= 0 {
+			data := bytes.TrimSuffix(bytes.TrimSuffix(c.buf[:at], []byte("\n")), []byte("\r"))
+			out.Write(bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n")))
+			c.buf = c.buf[at+len(end):]
+			break
+		}
+		if len(c.buf) > keep {
+			n := len(c.buf) - keep
+			out.Write(bytes.ReplaceAll(c.buf[:n], []byte("\r\n"), []byte("\n")))
+			c.buf = c.buf[n:]
+		}
+		if err := c.read(ctx, time.Time{}); err != nil {
+			if ctx.Err() != nil {
+				// Interrupt the command so the shell stays usable
+				c.write("\x03")
+			}
+			return 0, err
+		}
+	}
+
+	_, text, err := c.expect(ctx, serialStartTimeout, "\n")
+	if err != nil {
+		return 0, err
+	}
+	status, err := strconv.Atoi(strings.TrimSpace(string(text)))
+	if err != nil {
+		return 0, fmt.Errorf("unexpected exit status %q on the serial console", strings.TrimSpace(string(text)))
+	}
+	return status, nil
+}
+
+// wrapBase64 encodes data in 76 character lines, well below the line
+// length limit of a tty
+func wrapBase64(data []byte) string {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	var b strings.Builder
+	for len(encoded) > 76 {
+		b.WriteString(encoded[:76])
+		b.WriteByte('\n')
+		encoded = encoded[76:]
+	}
+	b.WriteString(encoded)
+	return b.String()
+}
+
+func (c *serialComm) Start(ctx context.Context, cmd *packer.RemoteCmd) error {
+	var stdin []byte
+	if cmd.Stdin != nil {
+		var err error
+		if stdin, err = io.ReadAll(cmd.Stdin); err != nil {
+			return err
+		}
+	}
+	out := cmd.Stdout
+	if out == nil {
+		out = io.Discard
+	}
+
+	go func() {
+		status, err := c.run(ctx, cmd.Command, stdin, out)
+		if err != nil {
+			log.Printf("Serial console command failed: %s", err)
+			if cmd.Stderr != nil {
+				fmt.Fprintln(cmd.Stderr, err.Error())
+			}
+			status = packer.CmdDisconnect
+		}
+		cmd.SetExited(status)
+	}()
+	return nil
+}
+
+// Uploads feed the file through stdin, the same way the exec file
+// transfer does over SSH
+func (c *serialComm) Upload(dst string, r io.Reader, fi *os.FileInfo) error {
+	return (&execTransferCommunicator{Communicator: c}).Upload(dst, r, fi)
+}
+
+func (c *serialComm) UploadDir(dst string, src string, exclude []string) error {
+	return (&execTransferCommunicator{Communicator: c}).UploadDir(dst, src, exclude)
+}
+
+// download runs command, which must print base64, and decodes its
+// output; the console is not binary safe
+func (c *serialComm) download(command string) ([]byte, error) {
+	var out bytes.Buffer
+	status, err := c.run(context.Background(), command, nil, &out)
+	if err != nil {
+		return nil, err
+	}
+	if status != 0 {
+		return nil, fmt.Errorf("%s exited with status %d: %s", strings.Fields(command)[0], status, strings.TrimSpace(out.String()))
+	}
+	return io.ReadAll(base64.NewDecoder(base64.StdEncoding, &out))
+}
+
+func (c *serialComm) Download(src string, w io.Writer) error {
+	data, err := c.download(fmt.Sprintf("base64 %s", shellQuote(src)))
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+func (c *serialComm) DownloadDir(src string, dst string, exclude []string) error {
+	data, err := c.download(fmt.Sprintf("cd %s && tar -cf - . | base64", shellQuote(src)))
+	if err != nil {
+		return err
+	}
+	return readTar(bytes.NewReader(data), dst, exclude)
+}
+
+// stepConnectSerial connects the serial communicator in place of
+// StepConnect
+type stepConnectSerial struct {
+	comm *serialComm
+}
+
+func (s *stepConnectSerial) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	config := state.Get("config").(*Config)
+	ui := state.Get("ui").(packer.Ui)
+
+	ui.Say("Connecting to the serial console...")
+	comm, err := connectSerial(ctx, state.Get("serial_socket").(string),
+		config.Comm.SSHUsername, config.Comm.SSHPassword, config.Comm.SSHTimeout)
+	if err != nil {
+		err := fmt.Errorf("failed to connect to the serial console: %s", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+	ui.Say(fmt.Sprintf("Logged in on the serial console as '%s'", config.Comm.SSHUsername))
+
+	s.comm = comm
+	state.Put("communicator", comm)
+	return multistep.ActionContinue
+}
+
+func (s *stepConnectSerial) Cleanup(state multistep.StateBag) {
+	if s.comm != nil {
+		s.comm.write("exit\n")
+		s.comm.conn.Close()
+	}
+}
@@ -0,0 +1,141 @@
+package meda
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/cirunlabs/packer-plugin-meda/driver"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// serviceNamePattern matches service names, which become host names
+var serviceNamePattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// ServiceVM is an auxiliary VM running next to the build VM for the
+// duration of the build, e.g. a registry or database the provisioners need
+type ServiceVM struct {
+	// Name identifies the service and is used as its host name
+	Name string `mapstructure:"name" required:"true"`
+	// Image is the Meda image the service VM boots
+	Image string `mapstructure:"image" required:"true"`
+	// Memory, CPUs and DiskSize size the service VM. Default to 1G, 1
+	// and 10G.
+	Memory   string `mapstructure:"memory"`
+	CPUs     int    `mapstructure:"cpus"`
+	DiskSize string `mapstructure:"disk_size"`
+	// UserDataFile is cloud-init user-data for the service VM
+	UserDataFile string `mapstructure:"user_data_file"`
+}
+
+// prepare applies defaults and validates the service
+func (s *ServiceVM) prepare() []error {
+	var errs []error
+
+	if s.Memory == "" {
+		s.Memory = "1G"
+	}
+	if s.CPUs == 0 {
+		s.CPUs = 1
+	}
+	if s.DiskSize == "" {
+		s.DiskSize = "10G"
+	}
+
+	if !serviceNamePattern.MatchString(s.Name) {
+		errs = append(errs, fmt.Errorf("service name %q must only contain lowercase letters, digits and '-'", s.Name))
+	}
+	if s.Image == "" {
+		errs = append(errs, fmt.Errorf("service %q: image must be specified", s.Name))
+	}
+	if s.CPUs < 0 {
+		errs = append(errs, fmt.Errorf("service %q: cpus must not be negative", s.Name))
+	}
+	return errs
+}
+
+// serviceVMName returns the Meda VM name of a service. It shares the build
+// VM's prefix, so orphan cleanup removes leftover service VMs as well.
+func serviceVMName(vmName, service string) string {
+	return vmName + "-svc-" + service
+}
+
+// stepStartServices boots the service VMs before the build VM and deletes
+// them again when the build ends. Their addresses are exposed to
+// provisioners as build.MedaServiceHosts in /etc/hosts format.
+type stepStartServices struct {
+	created []string
+}
+
+func (s *stepStartServices) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	config := state.Get("config").(*Config)
+	d := state.Get("driver").(driver.MedaDriver)
+	ui := state.Get("ui").(packer.Ui)
+	vmName := state.Get("vm_name").(string)
+
+	// mac_address belongs to the build VM, service IPs are looked up by
+	// the MAC meda reports
+	serviceConfig := *config
+	serviceConfig.MACAddress = ""
+
+	var hosts, ips []string
+	for _, svc := range config.Services {
+		name := serviceVMName(vmName, svc.Name)
+		ui.Say(fmt.Sprintf("Starting service '%s' from image '%s'", svc.Name, svc.Image))
+
+		image, _, _ := strings.Cut(svc.Image, ":")
+		exists, err := d.ImageExists(image)
+		if err == nil && !exists {
+			err = fmt.Errorf("image '%s' not found", svc.Image)
+		}
+		if err == nil {
+			err = d.CreateVM(driver.VMOptions{
+				Name:         name,
+				BaseImage:    svc.Image,
+				Memory:       svc.Memory,
+				CPUs:         svc.CPUs,
+				DiskSize:     svc.DiskSize,
+				UserDataFile: svc.UserDataFile,
+			})
+		}
+		if err == nil {
+			s.created = append(s.created, name)
+			err = d.StartVM(name)
+		}
+		var ip string
+		if err == nil {
+			ip, err = waitForVMIP(ctx, d, ui, &serviceConfig, name)
+		}
+		if err != nil {
+			err := fmt.Errorf("failed to start service '%s': %s", svc.Name, err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+
+		ui.Say(fmt.Sprintf("Service '%s' is up at %s", svc.Name, ip))
+		hosts = append(hosts, ip+" "+svc.Name)
+		ips = append(ips, ip)
+	}
+	state.Put("service_ips", ips)
+
+	generatedData := state.Get("generated_data").(map[string]interface{})
+	generatedData["MedaServiceHosts"] = strings.Join(hosts, "\n")
+	return multistep.ActionContinue
+}
+
+func (s *stepStartServices) Cleanup(state multistep.StateBag) {
+	d := state.Get("driver").(driver.MedaDriver)
+	ui := state.Get("ui").(packer.Ui)
+
+	for i := len(s.created) - 1; i >= 0; i-- {
+		name := s.created[i]
+		ui.Say("Cleaning up service VM '" + name + "'")
+		if err := d.DeleteVM(name); err != nil && !errors.Is(err, driver.ErrVMNotFound) {
+			ui.Error(fmt.Sprintf("Failed to delete service VM '%s': %s", name, err))
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package meda
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hclsimple"
+	"github.com/hashicorp/packer-plugin-sdk/template/config"
+)
+
+// settingsValues are the shared connection settings a settings file can
+// provide. Unset values are nil.
+type settingsValues struct {
+	MedaBinary       *string           `hcl:"meda_binary,optional"`
+	MedaHost         *string           `hcl:"meda_host,optional"`
+	MedaPort         *int              `hcl:"meda_port,optional"`
+	UseAPI           *bool             `hcl:"use_api,optional"`
+	MedaEnv          map[string]string `hcl:"meda_env,optional"`
+	Registry         *string           `hcl:"registry,optional"`
+	Organization     *string           `hcl:"organization,optional"`
+	RegistryInsecure *bool             `hcl:"registry_insecure,optional"`
+	RegistryCAFile   *string           `hcl:"registry_ca_file,optional"`
+}
+
+// settingsFile is the layout of the settings file: top-level values plus
+// named profile blocks overriding them
+type settingsFile struct {
+	Profiles []struct {
+		Name string   `hcl:"name,label"`
+		Body hcl.Body `hcl:",remain"`
+	} `hcl:"profile,block"`
+	Remain hcl.Body `hcl:",remain"`
+}
+
+// settingsPath returns the location of the settings file: PACKER_MEDA_CONFIG
+// or packer-meda/config.hcl in the user's config directory
+func settingsPath() string {
+	if path := os.Getenv("PACKER_MEDA_CONFIG"); path != "" {
+		return path
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "packer-meda", "config.hcl")
+}
+
+// loadSettings reads the settings file and returns its values with the
+// given profile applied. A missing file yields empty settings unless a
+// profile was requested.
+func loadSettings(path, profile string) (settingsValues, error) {
+	var values settingsValues
+	if path == "" {
+		return values, nil
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		if profile != "" {
+			return values, fmt.Errorf("meda_profile %q is set but %s does not exist", profile, path)
+		}
+		return values, nil
+	}
+
+	var file settingsFile
+	if err := hclsimple.DecodeFile(path, nil, &file); err != nil {
+		return values, fmt.Errorf("failed to read %s: %s", path, err)
+	}
+	if diags := gohcl.DecodeBody(file.Remain, nil, &values); diags.HasErrors() {
+		return values, fmt.Errorf("failed to read %s: %s", path, diags)
+	}
+	if profile == "" {
+		return values, nil
+	}
+
+	for _, p := range file.Profiles {
+		if p.Name != profile {
+			continue
+		}
+		var override settingsValues
+		if diags := gohcl.DecodeBody(p.Body, nil, &override); diags.HasErrors() {
+			return values, fmt.Errorf("failed to read profile %q in %s: %s", profile, path, diags)
+		}
+		values.merge(override)
+		return values, nil
+	}
+	return values, fmt.Errorf("profile %q not found in %s", profile, path)
+}
+
+// merge overrides v with the values set in o
+func (v *settingsValues) merge(o settingsValues) {
+	if o.MedaBinary != nil {
+		v.MedaBinary = o.MedaBinary
+	}
+	if o.MedaHost != nil {
+		v.MedaHost = o.MedaHost
+	}
+	if o.MedaPort != nil {
+		v.MedaPort = o.MedaPort
+	}
+	if o.UseAPI != nil {
+		v.UseAPI = o.UseAPI
+	}
+	if o.MedaEnv != nil {
+		if v.MedaEnv == nil {
+			v.MedaEnv = map[string]string{}
+		}
+		for k, val := range o.MedaEnv {
+			v.MedaEnv[k] = val
+		}
+	}
+	if o.Registry != nil {
+		v.Registry = o.Registry
+	}
+	if o.Organization != nil {
+		v.Organization = o.Organization
+	}
+	if o.RegistryInsecure != nil {
+		v.RegistryInsecure = o.RegistryInsecure
+	}
+	if o.RegistryCAFile != nil {
+		v.RegistryCAFile = o.RegistryCAFile
+	}
+}
+
+// applySettings fills the values the template left unset from the settings
+// file. It runs before defaults are applied, so template values always win
+// and the file wins over the built-in defaults.
+func (c *Config) applySettings() error {
+	profile := c.MedaProfile
+	if profile == "" {
+		profile = os.Getenv("PACKER_MEDA_PROFILE")
+	}
+	s, err := loadSettings(settingsPath(), profile)
+	if err != nil {
+		return err
+	}
+
+	if c.MedaBinary == "" && s.MedaBinary != nil {
+		c.MedaBinary = *s.MedaBinary
+	}
+	if c.MedaHost == "" && s.MedaHost != nil {
+		c.MedaHost = *s.MedaHost
+	}
+	if c.MedaPort == 0 && s.MedaPort != nil {
+		c.MedaPort = *s.MedaPort
+	}
+	if c.UseAPI == config.TriUnset && s.UseAPI != nil {
+		c.UseAPI = config.TrileanFromBool(*s.UseAPI)
+	}
+	for k, v := range s.MedaEnv {
+		if _, ok := c.MedaEnv[k]; ok {
+			continue
+		}
+		if c.MedaEnv == nil {
+			c.MedaEnv = map[string]string{}
+		}
+		c.MedaEnv[k] = v
+	}
+	if c.Registry == "" && s.Registry != nil {
+		c.Registry = *s.Registry
+	}
+	if c.Organization == "" && s.Organization != nil {
+		c.Organization = *s.Organization
+	}
+	if c.RegistryInsecure == config.TriUnset && s.RegistryInsecure != nil {
+		c.RegistryInsecure = config.TrileanFromBool(*s.RegistryInsecure)
+	}
+	if c.RegistryCAFile == "" && s.RegistryCAFile != nil {
+		c.RegistryCAFile = *s.RegistryCAFile
+	}
+	return nil
+}
+
+// applyEnvironment fills the values the template left unset from the
+// MEDA_* environment variables, so CI runners can configure every build
+// without touching templates. It runs before applySettings: the template
+// wins over the environment, which wins over the settings file.
+func (c *Config) applyEnvironment() error {
+	if v := os.Getenv("MEDA_BINARY"); c.MedaBinary == "" && v != "" {
+		c.MedaBinary = v
+	}
+	if v := os.Getenv("MEDA_HOST"); c.MedaHost == "" && v != "" {
+		c.MedaHost = v
+	}
+	if v := os.Getenv("MEDA_PORT"); c.MedaPort == 0 && v != "" {
+		port, err := strconv.Atoi(v)
+		if err != nil || port < 1 || port > 65535 {
+			return fmt.Errorf("MEDA_PORT must be a port number, got %q", v)
+		}
+		c.MedaPort = port
+	}
+	if v := os.Getenv("MEDA_REGISTRY"); c.Registry == "" && v != "" {
+		c.Registry = v
+	}
+	if v := os.Getenv("MEDA_ORG"); c.Organization == "" && v != "" {
+		c.Organization = v
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package meda
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// sizeUnits are the suffixes meda accepts for memory and disk sizes, as
+// powers of 1024
+var sizeUnits = map[string]int64{
+	"":  1 << 20,
+	"K": 1 << 10,
+	"M": 1 << 20,
+	"G": 1 << 30,
+	"T": 1 << 40,
+}
+
+// parseSize parses a size such as "512M" or "20G" and returns it in
+// bytes. A plain number is in MiB, a trailing "B" or "iB" is allowed.
+func parseSize(size string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(size))
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "B"), "I")
+	i := len(s)
+	for i > 0 && (s[i-1] < '0' || s[i-1] > '9') {
+		i--
+	}
+	unit, ok := sizeUnits[s[i:]]
+	n, err := strconv.ParseInt(s[:i], 10, 64)
+	if !ok || err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size %q, use a size such as 512M or 2G", size)
+	}
+	return n * unit, nil
+}
@@ -0,0 +1,91 @@
+package meda
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/cirunlabs/packer-plugin-meda/driver"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// sourceVMSnapshot is the snapshot a running source VM is cloned from
+const sourceVMSnapshot = "packer-clone"
+
+// stepCloneSourceVM clones source_vm into a temporary image that the build
+// VM boots from in place of base_image. Meda has no VM clone operation, so
+// the source disk is captured like a checkpoint: from a snapshot while the
+// VM runs, directly when it is stopped. The source VM is left as it was.
+type stepCloneSourceVM struct {
+	image string
+}
+
+func (s *stepCloneSourceVM) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	config := state.Get("config").(*Config)
+	d := state.Get("driver").(driver.MedaDriver)
+	ui := state.Get("ui").(packer.Ui)
+	vmName := state.Get("vm_name").(string)
+
+	halt := func(err error) multistep.StepAction {
+		err = fmt.Errorf("failed to clone source VM '%s': %s", config.SourceVM, err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	// Mock mode simulates no VMs, the source is taken as stopped
+	running := false
+	if !config.MockMode {
+		vms, err := d.ListVMs()
+		if err != nil {
+			return halt(err)
+		}
+		found := false
+		for _, vm := range vms {
+			if vm.Name == config.SourceVM {
+				found, running = true, vm.State == "running"
+			}
+		}
+		if !found {
+			return halt(fmt.Errorf("no such VM"))
+		}
+	}
+
+	name, tag := vmName+"-source", "latest"
+	image := name + ":" + tag
+	ui.Say(fmt.Sprintf("Cloning source VM '%s' into '%s'", config.SourceVM, image))
+
+	if running {
+		if err := d.SnapshotVM(config.SourceVM, sourceVMSnapshot); err != nil {
+			return halt(err)
+		}
+		err := d.CreateImageFromSnapshot(config.SourceVM, sourceVMSnapshot, name, tag, imageLabels(state))
+		if derr := d.DeleteSnapshot(config.SourceVM, sourceVMSnapshot); derr != nil {
+			ui.Say(fmt.Sprintf("Warning: failed to delete snapshot '%s' of '%s': %s", sourceVMSnapshot, config.SourceVM, derr))
+		}
+		if err != nil {
+			return halt(err)
+		}
+	} else if err := d.CreateImageFromVM(config.SourceVM, name, tag, imageLabels(state)); err != nil {
+		return halt(err)
+	}
+	s.image = image
+
+	config.BaseImage = image
+	state.Get("generated_data").(map[string]interface{})["MedaBaseImage"] = image
+	return multistep.ActionContinue
+}
+
+func (s *stepCloneSourceVM) Cleanup(state multistep.StateBag) {
+	if s.image == "" {
+		return
+	}
+	d := state.Get("driver").(driver.MedaDriver)
+	ui := state.Get("ui").(packer.Ui)
+
+	ui.Say("Deleting the clone of the source VM '" + s.image + "'")
+	if err := d.DeleteImage(s.image); err != nil {
+		log.Printf("Failed to delete clone image %s: %s", s.image, err)
+	}
+}
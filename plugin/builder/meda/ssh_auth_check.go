@@ -0,0 +1,269 @@
+package meda
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"golang.org/x/crypto/ssh"
+)
+
+// sshAuthCheckTimeout bounds the smoke test command and the diagnostic
+// connection attempt
+const sshAuthCheckTimeout = time.Minute
+
+// sshAuthCheckMarker is printed by the smoke test command
+const sshAuthCheckMarker = "packer-meda-auth-ok"
+
+// userDataSecretPattern matches user-data lines whose value is a password
+var userDataSecretPattern = regexp.MustCompile(`(?i)^(\s*-?\s*"?[a-z_]*(passwd|password)"?\s*:\s*).+$`)
+
+// maxUserDataReport is how much of the user-data a failure report shows
+const maxUserDataReport = 4096
+
+// sshAuthMethods describes how the builder authenticates, e.g. "key from
+// ssh_private_key_file id_ed25519"
+func sshAuthMethods(config *Config, state multistep.StateBag) []string {
+	var methods []string
+	_, temporaryUser := state.GetOk("temporary_ssh_user")
+	switch {
+	case config.Comm.SSHPrivateKeyFile != "":
+		methods = append(methods, "key from ssh_private_key_file "+config.Comm.SSHPrivateKeyFile)
+	case temporaryUser:
+		methods = append(methods, "key of the temporary user, added through user-data")
+	case config.SSHTemporaryKeyPath != "":
+		methods = append(methods, "cached key "+config.SSHTemporaryKeyPath+", added through user-data")
+	case config.VaultAuth != nil && config.VaultAuth.SSHPrivateKey != "":
+		methods = append(methods, "key from Vault")
+	case len(config.Comm.SSHPrivateKey) > 0:
+		methods = append(methods, "key generated for this build")
+	}
+	if config.Comm.SSHPassword != "" {
+		methods = append(methods, "password")
+	}
+	if config.Comm.SSHAgentAuth {
+		methods = append(methods, "ssh-agent")
+	}
+	if len(methods) == 0 {
+		methods = append(methods, "none")
+	}
+	return methods
+}
+
+// appliedUserData returns the path and content of the user-data the VM
+// was created with, with password values redacted. The path is empty when
+// no user-data was passed to meda.
+func appliedUserData(config *Config, state multistep.StateBag) (string, string, error) {
+	path := config.UserDataFile
+	if v, ok := state.GetOk("user_data_file"); ok {
+		path = v.(string)
+	}
+	if path == "" {
+		return "", "", nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return path, "", err
+	}
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = userDataSecretPattern.ReplaceAllString(line, "${1}<redacted>")
+	}
+	content := strings.Join(lines, "\n")
+	// chpasswd lists passwords as user:password
+	if config.Comm.SSHPassword != "" {
+		content = strings.ReplaceAll(content, config.Comm.SSHPassword, "<redacted>")
+	}
+	if len(content) > maxUserDataReport {
+		content = content[:maxUserDataReport] + "\n... (truncated)"
+	}
+	return path, content, nil
+}
+
+// probeSSH connects to the guest once with the build's SSH settings, to
+// tell an authentication failure from a network one. StepConnect only
+// reports a timeout after retrying either.
+func probeSSH(ctx context.Context, config *Config, state multistep.StateBag) error {
+	host, _ := state.Get("vm_ip").(string)
+	port := config.Comm.SSHPort
+	if config.SSHViaAPI {
+		host = "127.0.0.1"
+	}
+	if p, ok := state.GetOk("api_proxy_port"); ok {
+		port = p.(int)
+	}
+	if host == "" {
+		return fmt.Errorf("the VM has no IP address")
+	}
+
+	sshConfig, err := sshClientConfig(config, state)
+	if err != nil {
+		return err
+	}
+	sshConfig.Timeout = 15 * time.Second
+
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+	dialer := net.Dialer{Timeout: sshConfig.Timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	client, chans, reqs, err := ssh.NewClientConn(conn, addr, sshConfig)
+	if err != nil {
+		return err
+	}
+	ssh.NewClient(client, chans, reqs).Close()
+	return nil
+}
+
+// sshAuthHints lists the likely misconfigurations for a failure, given
+// the result of probeSSH and the output of the smoke test if it ran
+func sshAuthHints(config *Config, state multistep.StateBag, probeErr error, output string) []string {
+	var hints []string
+	user := config.Comm.SSHUsername
+	_, generated := state.GetOk("user_data_file")
+	userData := config.UserDataFile != "" || generated
+
+	switch {
+	case strings.Contains(output, "change your password") || strings.Contains(output, "password has expired"):
+		hints = append(hints, fmt.Sprintf("The password of '%s' has expired, cloud-init expires passwords it sets by default. Add `chpasswd: { expire: false }` to the user-data", user))
+	case strings.Contains(output, "not available") || strings.Contains(output, "nologin"):
+		hints = append(hints, fmt.Sprintf("'%s' has no login shell. Use another ssh_username or give the user a shell in the user-data", user))
+	case output != "":
+		hints = append(hints, "The login succeeded but commands don't run as expected. Check for a ForceCommand in sshd_config or a shell profile that exits or prints to stdout")
+	case probeErr == nil:
+		hints = append(hints, fmt.Sprintf("A new connection succeeds now, so the guest was probably still booting. Raise ssh_timeout (currently %s)", config.Comm.SSHTimeout))
+	case strings.Contains(probeErr.Error(), "unable to authenticate"):
+		hints = append(hints, fmt.Sprintf("The guest rejected the credentials for '%s'", user))
+		if config.Comm.SSHPassword != "" {
+			hints = append(hints, fmt.Sprintf("The credentials come from guest_os %q unless ssh_username and ssh_password are set. Make sure the base image has this user and password, and that the user-data doesn't set `ssh_pwauth: false` or `lock_passwd: true`", config.GuestOS))
+		}
+		if config.Comm.SSHPrivateKeyFile != "" {
+			hints = append(hints, fmt.Sprintf("The public key of %s must be in ~%s/.ssh/authorized_keys, from the base image or the user-data", config.Comm.SSHPrivateKeyFile, user))
+		} else if sshAuthMethods(config, state)[0] == "key generated for this build" {
+			hints = append(hints, "The key generated for this build is not added to the guest. Set ssh_password, ssh_private_key_file, temporary_ssh_user or ssh_temporary_key_path")
+		}
+		if userData {
+			hints = append(hints, "A `users` list in the user-data without `default` replaces the image's default user")
+		}
+	case strings.Contains(probeErr.Error(), "connection refused"):
+		hints = append(hints, fmt.Sprintf("Nothing listens on port %d. sshd may not be installed or enabled in the base image, or ssh_port is wrong", config.Comm.SSHPort))
+	case strings.Contains(probeErr.Error(), "bastion or proxy"):
+		hints = append(hints, fmt.Sprintf("Check the ssh_bastion_* and ssh_proxy_* settings and that the guest accepts the credentials for '%s'", user))
+	case strings.Contains(probeErr.Error(), "no IP address"):
+		hints = append(hints, "The VM never got an IP address. Check the network settings and the guest's DHCP client")
+	default:
+		hints = append(hints, "The guest can't be reached. Check that the VM's network is up and that no firewall blocks the SSH port")
+	}
+	return hints
+}
+
+// reportSSHFailure explains a failed SSH connection or smoke test: the
+// credentials tried, the likely cause and the user-data that was applied
+func reportSSHFailure(ctx context.Context, state multistep.StateBag, output string) {
+	config := state.Get("config").(*Config)
+	ui := state.Get("ui").(packer.Ui)
+
+	var probeErr error
+	if output == "" {
+		if config.Comm.SSHBastionHost != "" || config.Comm.SSHProxyHost != "" {
+			probeErr = fmt.Errorf("not checked through a bastion or proxy")
+		} else {
+			ctx, cancel := context.WithTimeout(ctx, sshAuthCheckTimeout)
+			probeErr = probeSSH(ctx, config, state)
+			cancel()
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "SSH diagnostics:\n")
+	fmt.Fprintf(&b, "  User: %s\n", config.Comm.SSHUsername)
+	fmt.Fprintf(&b, "  Authentication: %s\n", strings.Join(sshAuthMethods(config, state), ", "))
+	if output == "" {
+		result := "succeeded"
+		if probeErr != nil {
+			result = probeErr.Error()
+		}
+		fmt.Fprintf(&b, "  Connection attempt: %s\n", result)
+	}
+	fmt.Fprintf(&b, "Likely cause:\n")
+	for _, hint := range sshAuthHints(config, state, probeErr, output) {
+		fmt.Fprintf(&b, "  - %s\n", hint)
+	}
+
+	path, content, err := appliedUserData(config, state)
+	switch {
+	case path == "":
+		fmt.Fprintf(&b, "No user-data was passed to meda, the VM uses the image's defaults")
+	case err != nil:
+		fmt.Fprintf(&b, "User-data %s can't be shown: %s", path, err)
+	default:
+		fmt.Fprintf(&b, "User-data applied (%s):\n%s", path, content)
+	}
+	ui.Error(b.String())
+}
+
+// stepSSHAuthDiagnostics wraps the connect step and explains a failure to
+// connect, which StepConnect reports as a bare timeout
+type stepSSHAuthDiagnostics struct {
+	multistep.Step
+}
+
+func (s *stepSSHAuthDiagnostics) InnerStepName() string {
+	return stepName(s.Step)
+}
+
+func (s *stepSSHAuthDiagnostics) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	action := s.Step.Run(ctx, state)
+	config := state.Get("config").(*Config)
+	if config.Comm.Type != "ssh" {
+		return action
+	}
+	if _, failed := state.GetOk("error"); failed && action == multistep.ActionHalt && ctx.Err() == nil {
+		reportSSHFailure(ctx, state, "")
+	}
+	return action
+}
+
+// stepVerifySSHAuth runs a trivial command right after connecting, so
+// that a login that doesn't give a working shell fails here with an
+// explanation instead of in the first provisioner
+type stepVerifySSHAuth struct{}
+
+func (s *stepVerifySSHAuth) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	comm := state.Get("communicator").(packer.Communicator)
+	ui := state.Get("ui").(packer.Ui)
+
+	runCtx, cancel := context.WithTimeout(ctx, sshAuthCheckTimeout)
+	defer cancel()
+	output, err := runRemote(runCtx, comm, "echo "+sshAuthCheckMarker)
+	if err == nil && strings.Contains(output, sshAuthCheckMarker) {
+		return multistep.ActionContinue
+	}
+	if ctx.Err() != nil {
+		return multistep.ActionHalt
+	}
+
+	if err == nil {
+		err = fmt.Errorf("unexpected output %q", strings.TrimSpace(output))
+	}
+	err = fmt.Errorf("SSH login succeeded but running a command failed: %s", err)
+	state.Put("error", err)
+	ui.Error(err.Error())
+	detail := err.Error()
+	if output != "" {
+		detail = output + "\n" + detail
+	}
+	reportSSHFailure(ctx, state, detail)
+	return multistep.ActionHalt
+}
+
+func (s *stepVerifySSHAuth) Cleanup(state multistep.StateBag) {}
@@ -0,0 +1,93 @@
+package meda
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/packer-plugin-sdk/communicator/sshkey"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// sshKeyCachePath returns where the key of ssh_keypair_name is kept when
+// ssh_temporary_key_path isn't set
+func sshKeyCachePath(name string) (string, error) {
+	return packer.CachePath("meda-ssh-keys", name)
+}
+
+// authorizedKeyCloudConfig returns a cloud-config part that authorizes
+// publicKey for user next to the keys the user already has
+func authorizedKeyCloudConfig(user, publicKey string) string {
+	return cloudConfigMergeHeader + fmt.Sprintf(`users:
+  - default
+  - name: %s
+    ssh_authorized_keys:
+      - %s
+`, user, strings.TrimSpace(publicKey))
+}
+
+// loadOrCreateSSHKey reads the key pair at path, or creates an ED25519 pair
+// there when the path doesn't exist yet. The public key is kept next to
+// the private key with a .pub suffix.
+func loadOrCreateSSHKey(path string) (private, public []byte, created bool, err error) {
+	private, err = os.ReadFile(path)
+	if err == nil {
+		public, err = sshkey.PublicKeyFromPrivate(private)
+		if err != nil {
+			return nil, nil, false, fmt.Errorf("invalid SSH key %s: %s", path, err)
+		}
+		return private, public, false, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, nil, false, err
+	}
+
+	pair, err := sshkey.GeneratePair(sshkey.ED25519, nil, 0)
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("failed to create SSH key: %s", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, nil, false, err
+	}
+	if err := os.WriteFile(path, pair.Private, 0600); err != nil {
+		return nil, nil, false, err
+	}
+	if err := os.WriteFile(path+".pub", pair.Public, 0644); err != nil {
+		return nil, nil, false, err
+	}
+	return pair.Private, pair.Public, true, nil
+}
+
+// stepSSHKeyCache provides the build's SSH key from ssh_temporary_key_path,
+// creating it on the first build, so a kept VM can still be reached with
+// it afterwards. The key is authorized for the SSH user through user-data.
+type stepSSHKeyCache struct{}
+
+func (s *stepSSHKeyCache) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	config := state.Get("config").(*Config)
+	ui := state.Get("ui").(packer.Ui)
+
+	private, public, created, err := loadOrCreateSSHKey(config.SSHTemporaryKeyPath)
+	if err != nil {
+		err := fmt.Errorf("failed to load ssh_temporary_key_path: %s", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+	if created {
+		ui.Say(fmt.Sprintf("Created SSH key %s", config.SSHTemporaryKeyPath))
+	} else {
+		ui.Say(fmt.Sprintf("Using SSH key %s", config.SSHTemporaryKeyPath))
+	}
+
+	addUserDataPart(state, []byte(authorizedKeyCloudConfig(config.Comm.SSHUsername, string(public))))
+
+	config.Comm.SSHPrivateKey = private
+	config.Comm.SSHPublicKey = public
+	return multistep.ActionContinue
+}
+
+func (s *stepSSHKeyCache) Cleanup(state multistep.StateBag) {}
@@ -0,0 +1,93 @@
+package meda
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// ansibleInventory renders an INI inventory with the build VM as the only
+// host of the meda group
+func ansibleInventory(vmName, host string, port int, user, keyFile, password string) string {
+	vars := []string{
+		"ansible_host=" + host,
+		fmt.Sprintf("ansible_port=%d", port),
+		"ansible_user=" + user,
+	}
+	if keyFile != "" {
+		vars = append(vars, "ansible_ssh_private_key_file="+keyFile)
+	} else if password != "" {
+		vars = append(vars, "ansible_password="+password)
+	}
+	// Build VMs get a new host key every time
+	vars = append(vars, "ansible_ssh_common_args='-o StrictHostKeyChecking=no -o UserKnownHostsFile=/dev/null'")
+
+	return fmt.Sprintf("[meda]\n%s %s\n", vmName, strings.Join(vars, " "))
+}
+
+// stepAnsibleHandoff exposes the connection to the build VM in a form the
+// ansible provisioner can use directly, including with use_proxy = false:
+// the private key is written to the build directory and, when
+// ansible_inventory_file is set, an inventory is generated, which is
+// removed after the build.
+type stepAnsibleHandoff struct {
+	inventoryFile string
+}
+
+func (s *stepAnsibleHandoff) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	config := state.Get("config").(*Config)
+	ui := state.Get("ui").(packer.Ui)
+	vmName := state.Get("vm_name").(string)
+	generatedData := state.Get("generated_data").(map[string]interface{})
+
+	// Keys generated by the builder only exist in memory
+	keyFile := config.Comm.SSHPrivateKeyFile
+	if keyFile == "" && len(config.Comm.SSHPrivateKey) > 0 {
+		keyFile = filepath.Join(state.Get("build_dir").(string), "id_packer")
+		if err := os.WriteFile(keyFile, config.Comm.SSHPrivateKey, 0600); err != nil {
+			err := fmt.Errorf("failed to write SSH private key: %s", err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+		config.Comm.SSHPrivateKeyFile = keyFile
+	}
+	generatedData["MedaSSHPrivateKeyFile"] = keyFile
+
+	if config.AnsibleInventoryFile != "" {
+		inventory := ansibleInventory(vmName, config.Comm.Host(), config.Comm.Port(),
+			config.Comm.User(), keyFile, config.Comm.Password())
+
+		if err := os.MkdirAll(filepath.Dir(config.AnsibleInventoryFile), 0755); err != nil {
+			err := fmt.Errorf("failed to create ansible_inventory_file directory: %s", err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+		if err := os.WriteFile(config.AnsibleInventoryFile, []byte(inventory), 0600); err != nil {
+			err := fmt.Errorf("failed to write ansible_inventory_file: %s", err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+		s.inventoryFile = config.AnsibleInventoryFile
+		ui.Say("Wrote Ansible inventory to " + config.AnsibleInventoryFile)
+	}
+	generatedData["MedaInventoryFile"] = config.AnsibleInventoryFile
+
+	return multistep.ActionContinue
+}
+
+func (s *stepAnsibleHandoff) Cleanup(state multistep.StateBag) {
+	if s.inventoryFile != "" {
+		if err := os.Remove(s.inventoryFile); err != nil && !os.IsNotExist(err) {
+			log.Printf("Failed to remove Ansible inventory: %s", err)
+		}
+	}
+}
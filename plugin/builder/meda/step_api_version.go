@@ -0,0 +1,70 @@
+package meda
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/cirunlabs/packer-plugin-meda/driver"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// stepCheckAPIVersion asks the API server for its Meda release and fails
+// the build before any VM exists when it lacks endpoints the build needs
+type stepCheckAPIVersion struct{}
+
+func (s *stepCheckAPIVersion) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	config := state.Get("config").(*Config)
+	ui := state.Get("ui").(packer.Ui)
+
+	// stepCheckDriver may have fallen back to the CLI
+	if !config.UseAPI.True() {
+		return multistep.ActionContinue
+	}
+
+	server := fmt.Sprintf("%s:%d", config.MedaHost, config.MedaPort)
+	features := config.apiFeatures()
+	upgrade := fmt.Sprintf("upgrade Meda on %s to %s or later and restart `meda serve`, or set use_api = false to build through the meda CLI",
+		server, driver.MinAPIVersion(features))
+
+	// The driver in the state may be wrapped for auditing
+	version, err := driver.NewAPIDriver(config.DriverConfig(), nil).ServerVersion()
+	if errors.Is(err, driver.ErrNotFound) {
+		ui.Say(fmt.Sprintf("Warning: the Meda API on %s doesn't report its version, it predates %s. If the build fails with 404 errors, %s",
+			server, driver.APIFeatureSince(driver.APIFeaturePush), upgrade))
+		return multistep.ActionContinue
+	}
+	if err != nil {
+		ui.Say(fmt.Sprintf("Warning: couldn't determine the Meda API version on %s: %s", server, err))
+		return multistep.ActionContinue
+	}
+	log.Printf("Meda API on %s is version %s", server, version)
+
+	unsupported, newer, err := driver.UnsupportedAPIFeatures(version, features)
+	if err != nil {
+		ui.Say(fmt.Sprintf("Warning: couldn't determine the Meda API version on %s: %s", server, err))
+		return multistep.ActionContinue
+	}
+	if newer {
+		ui.Say(fmt.Sprintf("Warning: the Meda API on %s is version %s, newer than this plugin knows; endpoints may have moved. Update the plugin if the build fails",
+			server, version))
+	}
+	if len(unsupported) == 0 {
+		return multistep.ActionContinue
+	}
+
+	missing := make([]string, 0, len(unsupported))
+	for _, u := range unsupported {
+		missing = append(missing, fmt.Sprintf("%s (since %s)", u.Feature, u.Since))
+	}
+	err = fmt.Errorf("the Meda API on %s is version %s, which doesn't serve %s needed by this build; %s",
+		server, version, strings.Join(missing, ", "), upgrade)
+	state.Put("error", err)
+	ui.Error(err.Error())
+	return multistep.ActionHalt
+}
+
+func (s *stepCheckAPIVersion) Cleanup(state multistep.StateBag) {}
@@ -0,0 +1,187 @@
+package meda
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/cirunlabs/packer-plugin-meda/driver"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// Exit statuses of the cloud-init wait command besides cloud-init's own
+const (
+	cloudInitStatusRecoverable = 2
+	cloudInitStatusTimeout     = 124
+	cloudInitStatusMissing     = 200
+)
+
+// stepWaitForCloudInit blocks until cloud-init has finished in the guest,
+// so provisioners don't race package manager locks cloud-init still holds
+type stepWaitForCloudInit struct{}
+
+func (s *stepWaitForCloudInit) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	config := state.Get("config").(*Config)
+	comm := state.Get("communicator").(packer.Communicator)
+	ui := state.Get("ui").(packer.Ui)
+
+	ui.Say("Waiting for cloud-init to finish...")
+
+	// The timeout runs in the guest, the communicator can't interrupt a
+	// running command
+	var output bytes.Buffer
+	cmd := &packer.RemoteCmd{
+		Command: fmt.Sprintf("command -v cloud-init >/dev/null 2>&1 || exit %d; timeout %d cloud-init status --wait --long",
+			cloudInitStatusMissing, int(config.CloudInitTimeout.Seconds())),
+		Stdout: &output,
+		Stderr: &output,
+	}
+	if err := comm.Start(ctx, cmd); err != nil {
+		err := fmt.Errorf("failed to check cloud-init status: %s", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	switch status := cmd.Wait(); status {
+	case 0:
+		ui.Say("cloud-init finished")
+	case cloudInitStatusMissing:
+		ui.Say("cloud-init is not installed in the guest, not waiting")
+	case cloudInitStatusRecoverable:
+		ui.Say("Warning: cloud-init finished with recoverable errors:\n" + strings.TrimSpace(output.String()))
+	case cloudInitStatusTimeout:
+		err := fmt.Errorf("cloud-init did not finish within %s", config.CloudInitTimeout)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	default:
+		err := fmt.Errorf("cloud-init failed (status %d):\n%s", status, strings.TrimSpace(output.String()))
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+	return multistep.ActionContinue
+}
+
+func (s *stepWaitForCloudInit) Cleanup(state multistep.StateBag) {}
+
+// guestReadyCommand returns the shell command that succeeds once
+// guest_ready_file exists and guest_ready_command succeeds
+func (c *Config) guestReadyCommand() string {
+	var checks []string
+	if c.GuestReadyFile != "" {
+		checks = append(checks, "test -e "+shellQuote(c.GuestReadyFile))
+	}
+	if c.GuestReadyCommand != "" {
+		checks = append(checks, "( "+c.GuestReadyCommand+" )")
+	}
+	return strings.Join(checks, " && ")
+}
+
+// stepWaitForGuestReady polls the guest until guest_ready_file exists and
+// guest_ready_command succeeds, for base images that run long first-boot
+// jobs of their own
+type stepWaitForGuestReady struct{}
+
+func (s *stepWaitForGuestReady) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	config := state.Get("config").(*Config)
+	comm := state.Get("communicator").(packer.Communicator)
+	ui := state.Get("ui").(packer.Ui)
+
+	ui.Say("Waiting for the guest to become ready...")
+
+	command := config.guestReadyCommand()
+	timeout := time.After(config.GuestReadyTimeout)
+	ticker := time.NewTicker(config.GuestReadyInterval)
+	defer ticker.Stop()
+
+	var lastErr error
+	for {
+		if _, lastErr = runRemote(ctx, comm, command); lastErr == nil {
+			ui.Say("Guest is ready")
+			return multistep.ActionContinue
+		}
+
+		select {
+		case <-ctx.Done():
+			return multistep.ActionHalt
+		case <-timeout:
+			err := fmt.Errorf("guest was not ready within %s: %s", config.GuestReadyTimeout, lastErr)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *stepWaitForGuestReady) Cleanup(state multistep.StateBag) {}
+
+// cloudInitPowerOffCloudConfig makes cloud-init power the VM off once its
+// final stage is done
+const cloudInitPowerOffCloudConfig = cloudConfigMergeHeader + `power_state:
+  mode: poweroff
+  message: "cloud-init finished, powering off for capture"
+  timeout: 60
+  condition: true
+`
+
+// vmStopped reports whether a VM state reported by meda means the VM is
+// powered off
+func vmStopped(state string) bool {
+	switch strings.ToLower(state) {
+	case "stopped", "shutoff", "shut off", "poweroff", "powered off":
+		return true
+	}
+	return false
+}
+
+// stepWaitForPowerOff is the cloud-init wait of builds without a
+// communicator: the user-data powers the VM off once cloud-init is done,
+// and the build waits for meda to report it stopped
+type stepWaitForPowerOff struct{}
+
+func (s *stepWaitForPowerOff) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	config := state.Get("config").(*Config)
+	driver := state.Get("driver").(driver.MedaDriver)
+	ui := state.Get("ui").(packer.Ui)
+	vmName := state.Get("vm_name").(string)
+
+	ui.Say("Waiting for cloud-init to finish and power the VM off...")
+
+	timeout := time.After(config.CloudInitTimeout)
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return multistep.ActionHalt
+		case <-timeout:
+			err := fmt.Errorf("VM '%s' was not powered off within %s, cloud-init is still running or failed before its final stage", vmName, config.CloudInitTimeout)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		case <-ticker.C:
+		}
+
+		vms, err := driver.ListVMs()
+		if err != nil {
+			log.Printf("Failed to list VMs: %s", err)
+			continue
+		}
+		for _, vm := range vms {
+			if vm.Name == vmName && vmStopped(vm.State) {
+				ui.Say("cloud-init finished")
+				return multistep.ActionContinue
+			}
+		}
+	}
+}
+
+func (s *stepWaitForPowerOff) Cleanup(state multistep.StateBag) {}
@@ -0,0 +1,126 @@
+package meda
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"math/big"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+const passwordAlphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// randomPassword returns a password of n characters from crypto/rand
+func randomPassword(n int) (string, error) {
+	max := big.NewInt(int64(len(passwordAlphabet)))
+	b := make([]byte, n)
+	for i := range b {
+		idx, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b[i] = passwordAlphabet[idx.Int64()]
+	}
+	return string(b), nil
+}
+
+// sudoPrefix returns the prefix needed to run a privileged command as user
+func sudoPrefix(user string) string {
+	if user == "root" {
+		return ""
+	}
+	return "sudo -n "
+}
+
+// stepRotateCredentials replaces the default password of the SSH user with
+// a random one right after connecting, so the well-known password never
+// ends up in the captured image
+type stepRotateCredentials struct{}
+
+func (s *stepRotateCredentials) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	config := state.Get("config").(*Config)
+	comm := state.Get("communicator").(packer.Communicator)
+	ui := state.Get("ui").(packer.Ui)
+	user := config.Comm.SSHUsername
+
+	ui.Say(fmt.Sprintf("Rotating password for user '%s'", user))
+
+	password, err := randomPassword(24)
+	if err != nil {
+		err := fmt.Errorf("failed to generate password: %s", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+	packer.LogSecretFilter.Set(password)
+
+	command := fmt.Sprintf("echo '%s:%s' | %schpasswd", user, password, sudoPrefix(user))
+	if _, err := runRemote(ctx, comm, command); err != nil {
+		err := fmt.Errorf("failed to rotate password for %s: %s", user, err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	// Reconnects during provisioning have to use the new password
+	if config.Comm.SSHPassword != "" {
+		config.Comm.SSHPassword = password
+	}
+
+	return multistep.ActionContinue
+}
+
+func (s *stepRotateCredentials) Cleanup(state multistep.StateBag) {}
+
+// stepSealCredentials runs just before the VM is stopped for capture. It
+// removes the temporary SSH user, and with disable_password_auth it locks
+// the user's password and turns off SSH password authentication in the
+// image.
+type stepSealCredentials struct{}
+
+func (s *stepSealCredentials) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	config := state.Get("config").(*Config)
+	comm := state.Get("communicator").(packer.Communicator)
+	ui := state.Get("ui").(packer.Ui)
+	user := config.Comm.SSHUsername
+	sudo := sudoPrefix(user)
+
+	if tempUser, ok := state.GetOk("temporary_ssh_user"); ok {
+		ui.Say(fmt.Sprintf("Removing temporary SSH user '%s'", tempUser))
+
+		// The sudo rule and the user go in one privileged shell, since
+		// sudo stops working for the user once its rule is gone
+		command := fmt.Sprintf(`sudo -n sh -c 'sed -i "/^# User rules for %[1]s\$/d;/^%[1]s /d" /etc/sudoers.d/90-cloud-init-users; userdel -f -r %[1]s'`, tempUser)
+		if _, err := runRemote(ctx, comm, command); err != nil {
+			err := fmt.Errorf("failed to remove temporary SSH user: %s", err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+	}
+
+	if !config.DisablePasswordAuth {
+		return multistep.ActionContinue
+	}
+
+	ui.Say(fmt.Sprintf("Disabling password authentication for user '%s'", user))
+
+	commands := []string{
+		fmt.Sprintf("%spasswd -l %s", sudo, user),
+		fmt.Sprintf(`%ssed -i -E 's/^#?[[:space:]]*PasswordAuthentication.*/PasswordAuthentication no/' /etc/ssh/sshd_config`, sudo),
+	}
+	for _, command := range commands {
+		if _, err := runRemote(ctx, comm, command); err != nil {
+			err := fmt.Errorf("failed to disable password authentication: %s", err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+	}
+
+	return multistep.ActionContinue
+}
+
+func (s *stepSealCredentials) Cleanup(state multistep.StateBag) {}
@@ -0,0 +1,109 @@
+package meda
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"github.com/cirunlabs/packer-plugin-meda/driver"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// stepStartMedaServer starts `meda serve` when the API isn't already running
+// and stops it again once the build is over
+type stepStartMedaServer struct {
+	cmd    *exec.Cmd
+	exited chan error
+}
+
+func (s *stepStartMedaServer) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	config := state.Get("config").(*Config)
+	d := state.Get("driver").(driver.MedaDriver)
+	ui := state.Get("ui").(packer.Ui)
+
+	if err := d.Ping(); err == nil {
+		ui.Say(fmt.Sprintf("Meda API already running on %s:%d", config.MedaHost, config.MedaPort))
+		return multistep.ActionContinue
+	}
+
+	ui.Say(fmt.Sprintf("Starting meda API server on port %d", config.MedaPort))
+
+	cmd, err := driver.MedaCommand(config.DriverConfig(), "serve", "--port", strconv.Itoa(config.MedaPort))
+	if err != nil {
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+	cmd.Stdout = log.Writer()
+	cmd.Stderr = log.Writer()
+
+	finished := driver.LogCommand(cmd)
+	if err := cmd.Start(); err != nil {
+		finished(err)
+		err := fmt.Errorf("failed to start meda server: %s", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+	s.cmd = cmd
+	s.exited = make(chan error, 1)
+	go func() {
+		err := cmd.Wait()
+		finished(err)
+		s.exited <- err
+	}()
+
+	timeout := time.After(config.MedaServerStartTimeout)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return multistep.ActionHalt
+		case err := <-s.exited:
+			s.cmd = nil
+			err = fmt.Errorf("meda server exited before becoming ready: %v", err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		case <-timeout:
+			err := fmt.Errorf("timeout waiting for meda server to become ready")
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		case <-ticker.C:
+			if err := d.Ping(); err == nil {
+				ui.Say("Meda API server is ready")
+				return multistep.ActionContinue
+			}
+		}
+	}
+}
+
+func (s *stepStartMedaServer) Cleanup(state multistep.StateBag) {
+	if s.cmd == nil || s.cmd.Process == nil {
+		return
+	}
+
+	ui := state.Get("ui").(packer.Ui)
+	ui.Say("Stopping meda API server")
+
+	if err := s.cmd.Process.Signal(os.Interrupt); err != nil {
+		log.Printf("Failed to interrupt meda server, killing it: %s", err)
+		_ = s.cmd.Process.Kill()
+		return
+	}
+
+	select {
+	case <-s.exited:
+	case <-time.After(10 * time.Second):
+		log.Printf("Meda server did not exit after interrupt, killing it")
+		_ = s.cmd.Process.Kill()
+	}
+}
@@ -0,0 +1,66 @@
+package meda
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// packageNamePattern accepts package names with optional version pins,
+// e.g. git, docker.io=24.0.5-0ubuntu1 or python3-pip
+var packageNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9.+_:=~-]*$`)
+
+// installPackagesCommand returns a shell command that installs packages
+// with whichever of apt, dnf, yum, apk or zypper the guest has
+func installPackagesCommand(packages []string, sudo string) string {
+	list := strings.Join(packages, " ")
+	script := strings.Join([]string{
+		"set -e",
+		"if command -v apt-get >/dev/null 2>&1; then " +
+			sudo + "env DEBIAN_FRONTEND=noninteractive apt-get update -q; " +
+			sudo + "env DEBIAN_FRONTEND=noninteractive apt-get install -y -q " + list,
+		"elif command -v dnf >/dev/null 2>&1; then " + sudo + "dnf install -y " + list,
+		"elif command -v yum >/dev/null 2>&1; then " + sudo + "yum install -y " + list,
+		"elif command -v apk >/dev/null 2>&1; then " + sudo + "apk add --no-cache " + list,
+		"elif command -v zypper >/dev/null 2>&1; then " + sudo + "zypper --non-interactive install " + list,
+		"else echo 'no supported package manager (apt, dnf, yum, apk, zypper) found' >&2; exit 1",
+		"fi",
+	}, "\n")
+	return "sh -c '" + script + "'"
+}
+
+// stepInstallPackages installs the configured packages before the user
+// provisioners run
+type stepInstallPackages struct{}
+
+func (s *stepInstallPackages) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	config := state.Get("config").(*Config)
+	comm := state.Get("communicator").(packer.Communicator)
+	ui := state.Get("ui").(packer.Ui)
+
+	ui.Say(fmt.Sprintf("Installing packages: %s", strings.Join(config.Packages, ", ")))
+
+	cmd := &packer.RemoteCmd{
+		Command: installPackagesCommand(config.Packages, sudoPrefix(config.Comm.SSHUsername)),
+	}
+	if err := cmd.RunWithUi(ctx, comm, ui); err != nil {
+		err := fmt.Errorf("failed to install packages: %s", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+	if status := cmd.ExitStatus(); status != 0 {
+		err := fmt.Errorf("failed to install packages: exit status %d", status)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	return multistep.ActionContinue
+}
+
+func (s *stepInstallPackages) Cleanup(state multistep.StateBag) {}
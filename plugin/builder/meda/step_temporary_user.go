@@ -0,0 +1,67 @@
+package meda
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/packer-plugin-sdk/communicator/sshkey"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// temporaryUserCloudConfig returns a cloud-config part that creates user
+// with passwordless sudo, authorized for publicKey. The default user is kept.
+func temporaryUserCloudConfig(user, publicKey string) string {
+	return cloudConfigMergeHeader + fmt.Sprintf(`users:
+  - default
+  - name: %s
+    gecos: Packer temporary build user
+    shell: /bin/sh
+    sudo: ALL=(ALL) NOPASSWD:ALL
+    lock_passwd: true
+    ssh_authorized_keys:
+      - %s
+`, user, strings.TrimSpace(publicKey))
+}
+
+// stepTemporarySSHUser creates a one-off user with a random name and key
+// for provisioning. The user is added through user-data next to the
+// configured user-data and removed again by stepSealCredentials.
+type stepTemporarySSHUser struct{}
+
+func (s *stepTemporarySSHUser) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	config := state.Get("config").(*Config)
+	ui := state.Get("ui").(packer.Ui)
+
+	suffix, err := randomPassword(8)
+	if err != nil {
+		err := fmt.Errorf("failed to generate temporary user name: %s", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+	user := "packer-" + strings.ToLower(suffix)
+
+	ui.Say(fmt.Sprintf("Creating temporary SSH user '%s'", user))
+
+	pair, err := sshkey.GeneratePair(sshkey.ED25519, nil, 0)
+	if err != nil {
+		err := fmt.Errorf("failed to create temporary SSH key: %s", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	addUserDataPart(state, []byte(temporaryUserCloudConfig(user, string(pair.Public))))
+
+	config.Comm.SSHUsername = user
+	config.Comm.SSHPassword = ""
+	config.Comm.SSHPrivateKey = pair.Private
+	config.Comm.SSHPublicKey = pair.Public
+
+	state.Put("temporary_ssh_user", user)
+	return multistep.ActionContinue
+}
+
+func (s *stepTemporarySSHUser) Cleanup(state multistep.StateBag) {}
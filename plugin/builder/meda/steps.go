@@ -0,0 +1,720 @@
+package meda
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cirunlabs/packer-plugin-meda/driver"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	packerconfig "github.com/hashicorp/packer-plugin-sdk/template/config"
+)
+
+// stepCheckDriver verifies Meda is reachable, switching from the API to the
+// CLI when api_fallback_to_cli is set and the API server is down
+type stepCheckDriver struct{}
+
+func (s *stepCheckDriver) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	config := state.Get("config").(*Config)
+	d := state.Get("driver").(driver.MedaDriver)
+	ui := state.Get("ui").(packer.Ui)
+
+	err := d.Ping()
+	if err == nil {
+		return multistep.ActionContinue
+	}
+
+	if config.UseAPI.True() && config.APIFallbackToCLI {
+		ui.Say(fmt.Sprintf("%s, falling back to the meda CLI", err))
+
+		// Update the config too so the artifact uses the CLI for Destroy
+		config.UseAPI = packerconfig.TriFalse
+		if err = resetDriver(state).Ping(); err == nil {
+			return multistep.ActionContinue
+		}
+	}
+
+	state.Put("error", err)
+	ui.Error(err.Error())
+	return multistep.ActionHalt
+}
+
+func (s *stepCheckDriver) Cleanup(state multistep.StateBag) {}
+
+// stepCleanupOrphans deletes packer-<vm_name>-* VMs left behind by previous
+// builds that crashed before stepCleanupVM could run
+type stepCleanupOrphans struct{}
+
+func (s *stepCleanupOrphans) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	config := state.Get("config").(*Config)
+	driver := state.Get("driver").(driver.MedaDriver)
+	ui := state.Get("ui").(packer.Ui)
+
+	prefix := "packer-" + config.VMName + "-"
+	ui.Say("Looking for orphaned VMs matching '" + prefix + "*' older than " + config.OrphanMaxAge.String())
+
+	// Orphan cleanup is best effort, a failure here must not block the build
+	vms, err := driver.ListVMs()
+	if err != nil {
+		log.Printf("Warning: failed to list VMs: %s", err)
+		return multistep.ActionContinue
+	}
+
+	removed := 0
+	for _, vm := range vms {
+		if !strings.HasPrefix(vm.Name, prefix) {
+			continue
+		}
+
+		// VM names carry the Unix timestamp of the build that created them
+		createdAt, _, ok := parseBuildVMName(vm.Name, config.VMName)
+		if !ok {
+			continue
+		}
+		age := time.Since(createdAt)
+		if age < config.OrphanMaxAge {
+			continue
+		}
+
+		ui.Say(fmt.Sprintf("Deleting orphaned VM '%s' (age %s)", vm.Name, age.Round(time.Second)))
+		if err := driver.DeleteVM(vm.Name); err != nil {
+			log.Printf("Warning: failed to delete orphaned VM %s: %s", vm.Name, err)
+			continue
+		}
+		removed++
+	}
+
+	if removed > 0 {
+		ui.Say(fmt.Sprintf("Removed %d orphaned VM(s)", removed))
+	} else {
+		ui.Say("No orphaned VMs found")
+	}
+
+	return multistep.ActionContinue
+}
+
+func (s *stepCleanupOrphans) Cleanup(state multistep.StateBag) {}
+
+// stepCreateBaseImage ensures the base image is available locally by creating it
+type stepCreateBaseImage struct{}
+
+func (s *stepCreateBaseImage) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	config := state.Get("config").(*Config)
+	driver := state.Get("driver").(driver.MedaDriver)
+	ui := state.Get("ui").(packer.Ui)
+
+	// Extract base image name without tag (e.g., "ubuntu-base:latest" -> "ubuntu-base")
+	baseImageName := config.BaseImage
+	if strings.Contains(baseImageName, ":") {
+		baseImageName = strings.Split(baseImageName, ":")[0]
+	}
+
+	ui.Say("Ensuring base image '" + config.BaseImage + "' is available locally")
+
+	// First check if image exists locally
+	imageExists, err := driver.ImageExists(baseImageName)
+	if err != nil {
+		log.Printf("Failed to list images, assuming '%s' is missing: %s", baseImageName, err)
+	}
+
+	if imageExists {
+		ui.Say("Base image '" + baseImageName + "' already available locally")
+		return multistep.ActionContinue
+	}
+
+	// Concurrent builds would all find the image missing and race to
+	// create it. The first one creates it, the others wait and reuse it.
+	unlock, err := lockBaseImage(ctx, ui, config, baseImageName)
+	if err != nil {
+		err := fmt.Errorf("failed to lock base image creation: %s", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+	defer unlock()
+
+	if exists, err := driver.ImageExists(baseImageName); err == nil && exists {
+		ui.Say("Base image '" + baseImageName + "' was created by another build, reusing it")
+		return multistep.ActionContinue
+	}
+
+	if config.ImageCacheDir != "" {
+		// Hold the lock while the image is created so that concurrent builds
+		// wait for the cached copy instead of creating it again
+		cacheFile := imageCachePath(config.ImageCacheDir, baseImageRef(config.BaseImage))
+		unlock, err := lockCacheFile(ctx, ui, cacheFile)
+		if err != nil {
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+		defer unlock()
+
+		restored, err := restoreCachedImage(driver, ui, cacheFile, baseImageName)
+		if err != nil {
+			ui.Say(fmt.Sprintf("Warning: %s", err))
+		}
+		if restored {
+			ui.Say("Successfully imported base image '" + baseImageName + "' from cache")
+			return multistep.ActionContinue
+		}
+	}
+
+	if config.OfflineOutput != "" {
+		err := fmt.Errorf("base image '%s' not found locally and offline_output never pulls from a registry; "+
+			"import it first, e.g. with meda import", config.BaseImage)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+	if config.AutoCreateBaseImage.False() {
+		err := fmt.Errorf("base image '%s' not found locally and auto_create_base_image is disabled; "+
+			"pull or create it with meda before building", config.BaseImage)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	if err := s.createBaseImage(ctx, driver, ui, config.RegistryRetryBudget, baseImageName); err != nil {
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+	ui.Say("Successfully created base image '" + baseImageName + "'")
+
+	if config.ImageCacheDir != "" {
+		cacheFile := imageCachePath(config.ImageCacheDir, baseImageRef(config.BaseImage))
+		if err := storeCachedImage(driver, ui, cacheFile, baseImageRef(config.BaseImage)); err != nil {
+			ui.Say(fmt.Sprintf("Warning: failed to cache base image: %s", err))
+		}
+	}
+	return multistep.ActionContinue
+}
+
+// createBaseImage creates a missing base image
+func (s *stepCreateBaseImage) createBaseImage(ctx context.Context, driver driver.MedaDriver, ui packer.Ui, retryBudget time.Duration, baseImageName string) error {
+	// For ubuntu-base, create from ubuntu base. For ubuntu, create basic ubuntu image
+	if baseImageName == "ubuntu-base" {
+		ui.Say("Base image 'ubuntu-base' not found locally, creating from ubuntu...")
+		// First ensure ubuntu base image exists
+		if err := s.ensureUbuntuBaseImage(ctx, driver, ui, retryBudget); err != nil {
+			return err
+		}
+	} else {
+		ui.Say("Base image '" + baseImageName + "' not found locally, creating basic Ubuntu image...")
+	}
+
+	err := retryRegistry(ctx, ui, retryBudget, "creating base image '"+baseImageName+"'", func() error {
+		return driver.CreateImage(baseImageName)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create base image '%s': %s", baseImageName, err)
+	}
+	return nil
+}
+
+// baseImageRef returns base_image as name:tag, defaulting the tag to latest
+func baseImageRef(image string) string {
+	if strings.Contains(image, ":") {
+		return image
+	}
+	return image + ":latest"
+}
+
+// ensureUbuntuBaseImage creates the ubuntu base image if it doesn't exist
+func (s *stepCreateBaseImage) ensureUbuntuBaseImage(ctx context.Context, driver driver.MedaDriver, ui packer.Ui, retryBudget time.Duration) error {
+	ubuntuExists, err := driver.ImageExists("ubuntu")
+	if err == nil && ubuntuExists {
+		return nil
+	}
+
+	ui.Say("Creating basic Ubuntu image first...")
+	err = retryRegistry(ctx, ui, retryBudget, "creating ubuntu base image", func() error {
+		return driver.CreateImage("ubuntu")
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create ubuntu base image: %s", err)
+	}
+
+	ui.Say("Successfully created basic Ubuntu image")
+	return nil
+}
+
+func (s *stepCreateBaseImage) Cleanup(state multistep.StateBag) {
+	// No cleanup needed for image creation
+}
+
+// stepCreateVM creates a new VM using Meda
+type stepCreateVM struct{}
+
+func (s *stepCreateVM) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	config := state.Get("config").(*Config)
+	d := state.Get("driver").(driver.MedaDriver)
+	ui := state.Get("ui").(packer.Ui)
+	vmName := state.Get("vm_name").(string)
+
+	ui.Say("Creating VM '" + vmName + "' with base image '" + config.BaseImage + "'")
+
+	// Steps that extend the user-data hand over a generated file
+	userDataFile := config.UserDataFile
+	if path, ok := state.GetOk("user_data_file"); ok {
+		userDataFile = path.(string)
+	}
+	ignitionFile := ""
+	if path, ok := state.GetOk("ignition_file"); ok {
+		ignitionFile = path.(string)
+	}
+	var serviceIPs []string
+	if ips, ok := state.GetOk("service_ips"); ok {
+		serviceIPs = ips.([]string)
+	}
+
+	for _, volume := range config.AttachVolumes {
+		exists, err := d.ImageExists(volume)
+		if err != nil {
+			err := fmt.Errorf("failed to check volume image '%s': %s", volume, err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+		if !exists {
+			err := fmt.Errorf("volume image '%s' from attach_volumes not found", volume)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+		ui.Say("Attaching volume '" + volume + "' read-only")
+	}
+
+	vmOpts := driver.VMOptions{
+		Name:            vmName,
+		BaseImage:       config.BaseImage,
+		Memory:          config.provisionMemory(),
+		CPUs:            config.provisionCPUs(),
+		DiskSize:        config.DiskSize,
+		UserDataFile:    userDataFile,
+		Datasource:      config.CloudInitDatasource,
+		IgnitionFile:    ignitionFile,
+		MACAddress:      config.MACAddress,
+		Volumes:         config.AttachVolumes,
+		Network:         config.networkMode(),
+		NetworkAllow:    networkAllow(config, serviceIPs),
+		Hugepages:       config.Hugepages,
+		KSM:             config.KSM,
+		IOThreads:       config.IOThreads,
+		VirtioQueues:    config.VirtioQueues,
+		CPUAffinity:     config.CPUAffinity,
+		NUMANode:        config.NUMANode,
+		DiskIOLimitMBps: config.DiskIOLimitMBps,
+		CPUShares:       config.CPUShares,
+		MemoryBalloon:   config.MemoryBallooning,
+		MaxMemory:       config.MaxMemory,
+	}
+	if config.Comm.Type == "serial" {
+		vmOpts.SerialSocket = filepath.Join(state.Get("build_dir").(string), "serial.sock")
+		state.Put("serial_socket", vmOpts.SerialSocket)
+	}
+	attempt := 0
+	err := retryRegistry(ctx, ui, config.RegistryRetryBudget, "pulling base image '"+config.BaseImage+"'", func() error {
+		// A failed create can leave the VM behind, remove it so the next
+		// attempt doesn't fail on the name
+		if attempt++; attempt > 1 {
+			if err := d.DeleteVM(vmName); err != nil && !errors.Is(err, driver.ErrNotFound) {
+				return fmt.Errorf("failed to remove VM '%s' left by the previous attempt: %s", vmName, err)
+			}
+		}
+		return d.CreateVM(vmOpts)
+	})
+	if err != nil {
+		if errors.Is(err, driver.ErrNotFound) {
+			err = fmt.Errorf("base image '%s' %s", config.BaseImage, err)
+		}
+		err := fmt.Errorf("failed to create VM: %s", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	ui.Say("VM '" + vmName + "' created successfully")
+	return multistep.ActionContinue
+}
+
+func (s *stepCreateVM) Cleanup(state multistep.StateBag) {
+	// Cleanup will be handled by stepCleanupVM
+}
+
+// stepStartVM starts the VM
+type stepStartVM struct{}
+
+func (s *stepStartVM) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	driver := state.Get("driver").(driver.MedaDriver)
+	ui := state.Get("ui").(packer.Ui)
+	vmName := state.Get("vm_name").(string)
+
+	ui.Say("Starting VM '" + vmName + "'")
+
+	if err := driver.StartVM(vmName); err != nil {
+		err := fmt.Errorf("failed to start VM: %s", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	ui.Say("VM '" + vmName + "' started successfully")
+	return multistep.ActionContinue
+}
+
+func (s *stepStartVM) Cleanup(state multistep.StateBag) {}
+
+// stepWaitForVM waits for the VM to be ready and gets its IP
+type stepWaitForVM struct{}
+
+func (s *stepWaitForVM) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	config := state.Get("config").(*Config)
+	driver := state.Get("driver").(driver.MedaDriver)
+	ui := state.Get("ui").(packer.Ui)
+	vmName := state.Get("vm_name").(string)
+
+	ui.Say("Waiting for VM '" + vmName + "' to be ready...")
+
+	ip, err := waitForVMIP(ctx, driver, ui, config, vmName)
+	if err != nil {
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	state.Put("vm_ip", ip)
+	state.Put("instance_ip", ip)
+	// Set SSH host in the communicator config
+	config.Comm.SSHHost = ip
+
+	generatedData := state.Get("generated_data").(map[string]interface{})
+	generatedData["MedaVMIP"] = ip
+	generatedData["MedaSSHUsername"] = config.Comm.SSHUsername
+
+	ui.Say("VM is ready with IP: " + ip)
+	return multistep.ActionContinue
+}
+
+// waitForVMIP polls meda until the VM reports an IP address. Once meda has
+// been silent for ip_fallback_after, the host's neighbor table is searched
+// for the VM's MAC address as well, which covers slow DHCP and networks
+// without DHCP leases meda knows about.
+func waitForVMIP(ctx context.Context, driver driver.MedaDriver, ui packer.Ui, config *Config, vmName string) (string, error) {
+	// Wait for VM to be running and get IP
+	timeout := time.After(5 * time.Minute)
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+	fallbackAt := time.Now().Add(config.IPFallbackAfter)
+	mac := ""
+
+	for {
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-timeout:
+			return "", fmt.Errorf("timeout waiting for VM to be ready")
+		case <-ticker.C:
+			ip, err := vmIP(driver, config, vmName)
+			if err != nil {
+				log.Printf("Failed to get IP for VM %s: %s", vmName, err)
+			}
+
+			if ip != "" && ip != "null" {
+				return ip, nil
+			}
+
+			if time.Now().After(fallbackAt) {
+				if mac == "" {
+					mac = vmMAC(driver, config, vmName)
+				}
+				if mac != "" {
+					if ip := neighborIP(mac, config.NetworkBridge); ip != "" && config.acceptsVMIP(ip) {
+						ui.Say(fmt.Sprintf("Found VM IP %s for MAC %s in the host neighbor table", ip, mac))
+						return ip, nil
+					}
+				}
+			}
+			ui.Say("VM not ready yet, waiting...")
+		}
+	}
+}
+
+func (s *stepWaitForVM) Cleanup(state multistep.StateBag) {}
+
+// stepStopVM stops the VM
+type stepStopVM struct{}
+
+func (s *stepStopVM) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	driver := state.Get("driver").(driver.MedaDriver)
+	ui := state.Get("ui").(packer.Ui)
+	vmName := state.Get("vm_name").(string)
+
+	ui.Say("Stopping VM '" + vmName + "'")
+
+	if err := driver.StopVM(vmName); err != nil {
+		log.Printf("Warning: failed to stop VM: %s", err)
+		// Continue anyway - VM might already be stopped
+	} else {
+		ui.Say("VM '" + vmName + "' stopped successfully")
+	}
+
+	return multistep.ActionContinue
+}
+
+func (s *stepStopVM) Cleanup(state multistep.StateBag) {}
+
+// stepResizeVM shrinks the VM from the provisioning size back to memory
+// and cpus before capture, so the image's default profile matches the
+// production sizing
+type stepResizeVM struct{}
+
+func (s *stepResizeVM) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	config := state.Get("config").(*Config)
+	driver := state.Get("driver").(driver.MedaDriver)
+	ui := state.Get("ui").(packer.Ui)
+	vmName := state.Get("vm_name").(string)
+
+	ui.Say(fmt.Sprintf("Resizing VM '%s' to %s memory and %d CPUs for capture", vmName, config.Memory, config.CPUs))
+	if err := driver.ResizeVM(vmName, config.Memory, config.CPUs); err != nil {
+		err := fmt.Errorf("failed to resize VM: %s", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+	return multistep.ActionContinue
+}
+
+func (s *stepResizeVM) Cleanup(state multistep.StateBag) {}
+
+// stepCreateImage creates an image from the VM
+type stepCreateImage struct{}
+
+func (s *stepCreateImage) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	config := state.Get("config").(*Config)
+	d := state.Get("driver").(driver.MedaDriver)
+	ui := state.Get("ui").(packer.Ui)
+	vmName := state.Get("vm_name").(string)
+
+	imageName := fmt.Sprintf("%s:%s", config.OutputImageName, config.OutputTag)
+
+	// With -force an existing image of the same name and tag is replaced
+	if config.PackerForce {
+		if _, err := d.InspectImage(imageName); err == nil {
+			ui.Say("Deleting existing image '" + imageName + "' (-force)")
+			if err := d.DeleteImage(imageName); err != nil {
+				err := fmt.Errorf("failed to delete existing image: %s", err)
+				state.Put("error", err)
+				ui.Error(err.Error())
+				return multistep.ActionHalt
+			}
+		}
+	}
+
+	ui.Say("Creating image '" + imageName + "' from VM '" + vmName + "'")
+
+	comm, _ := state.Get("communicator").(packer.Communicator)
+	if err := captureImage(ctx, state, comm, config.OutputImageName, config.OutputTag); err != nil {
+		err := fmt.Errorf("failed to create image: %s", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	state.Put("image_name", imageName)
+	ui.Say("Image '" + imageName + "' created successfully")
+
+	// Image details are informational only, don't fail the build over them
+	info, err := d.InspectImage(imageName)
+	if err != nil {
+		log.Printf("Failed to inspect image %s: %s", imageName, err)
+		return multistep.ActionContinue
+	}
+	state.Put("image_info", info)
+	if info.SizeBytes > 0 {
+		ui.Say(fmt.Sprintf("Image size: %s (virtual %s)", driver.FormatBytes(info.SizeBytes), driver.FormatBytes(info.VirtualSize)))
+	}
+	return multistep.ActionContinue
+}
+
+func (s *stepCreateImage) Cleanup(state multistep.StateBag) {}
+
+// stepPushImage pushes the created image to a registry
+type stepPushImage struct{}
+
+func (s *stepPushImage) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	config := state.Get("config").(*Config)
+	driver := state.Get("driver").(driver.MedaDriver)
+	ui := state.Get("ui").(packer.Ui)
+	imageName := state.Get("image_name").(string)
+
+	// Skip push if not enabled
+	if !config.PushToRegistry {
+		ui.Say("Push to registry disabled, skipping push step")
+		return multistep.ActionContinue
+	}
+	if config.PushCondition != nil {
+		if ok, reason := config.PushCondition.Evaluate(); !ok {
+			ui.Say("Push condition not met, skipping push step: " + reason)
+			return multistep.ActionContinue
+		}
+	}
+	if reason, ok := state.GetOk("scan_blocked"); ok {
+		err := fmt.Errorf("push blocked: %s", reason)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	// Check for GITHUB_TOKEN when pushing to GHCR. Mock pushes need none.
+	if strings.Contains(config.Registry, "ghcr.io") && !config.MockMode {
+		if os.Getenv("GITHUB_TOKEN") == "" && config.MedaEnv["GITHUB_TOKEN"] == "" {
+			err := fmt.Errorf("GITHUB_TOKEN environment variable is required for pushing to GHCR. Please set it with: export GITHUB_TOKEN=your_token")
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+		ui.Say("GITHUB_TOKEN found for GHCR authentication")
+	}
+
+	// Build target image names, output_tag first
+	repo := config.registryRepository()
+	targets := []string{repo + ":" + config.OutputTag}
+	for _, tag := range config.PushTags {
+		targets = append(targets, repo+":"+tag)
+	}
+
+	if err := pushImages(ctx, driver, ui, config.pushOptions(imageName), targets, config.PushConcurrency, config.RegistryRetryBudget); err != nil {
+		err := fmt.Errorf("failed to push image: %s", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	state.Put("pushed_image", targets[0])
+	state.Put("pushed_images", targets)
+	return multistep.ActionContinue
+}
+
+// registryRepository returns <registry>[/<organization>]/<output_image_name>
+func (c *Config) registryRepository() string {
+	if c.Organization != "" {
+		return fmt.Sprintf("%s/%s/%s", c.Registry, c.Organization, c.OutputImageName)
+	}
+	return fmt.Sprintf("%s/%s", c.Registry, c.OutputImageName)
+}
+
+// pushOptions returns the options for pushing the local image imageName;
+// the target is filled in per push
+func (c *Config) pushOptions(imageName string) driver.PushOptions {
+	// Patterns were validated in Prepare
+	errorPatterns, _ := driver.CompilePatterns(c.PushErrorPatterns)
+	warningPatterns, _ := driver.CompilePatterns(c.PushWarningPatterns)
+
+	return driver.PushOptions{
+		ImageName:       imageName,
+		Name:            c.OutputImageName,
+		Registry:        c.Registry,
+		DryRun:          c.DryRun,
+		Insecure:        c.RegistryInsecure.True(),
+		CAFile:          c.RegistryCAFile,
+		ErrorPatterns:   errorPatterns,
+		WarningPatterns: warningPatterns,
+	}
+}
+
+// pushImages pushes the local image to every target, running up to
+// concurrency pushes at once. All targets are attempted; the failures are
+// reported together.
+func pushImages(ctx context.Context, driver driver.MedaDriver, ui packer.Ui, opts driver.PushOptions, targets []string, concurrency int, retryBudget time.Duration) error {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	errs := make([]error, len(targets))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, target string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			ui.Say("Pushing image '" + opts.ImageName + "' to '" + target + "'")
+			opts := opts
+			opts.TargetImage = target
+			err := retryRegistry(ctx, ui, retryBudget, "pushing to '"+target+"'", func() error {
+				return driver.PushImage(opts)
+			})
+			if err != nil {
+				errs[i] = fmt.Errorf("%s: %s", target, err)
+				ui.Error(fmt.Sprintf("Push to '%s' failed: %s", target, err))
+				return
+			}
+			ui.Say("Image '" + opts.ImageName + "' pushed successfully to '" + target + "'")
+		}(i, target)
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+func (s *stepPushImage) Cleanup(state multistep.StateBag) {}
+
+// How often and how far apart deleting the build VM is attempted
+const (
+	vmDeleteAttempts   = 3
+	vmDeleteRetryDelay = 5 * time.Second
+)
+
+// stepCleanupVM cleans up the VM
+type stepCleanupVM struct{}
+
+func (s *stepCleanupVM) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	d := state.Get("driver").(driver.MedaDriver)
+	ui := state.Get("ui").(packer.Ui)
+	vmName := state.Get("vm_name").(string)
+
+	ui.Say("Cleaning up VM '" + vmName + "'")
+
+	// Retry transient failures; a VM that is already gone only warrants a
+	// warning, anything else would leak the VM and fails the build
+	var err error
+	for attempt := 1; attempt <= vmDeleteAttempts; attempt++ {
+		err = d.DeleteVM(vmName)
+		if err == nil || errors.Is(err, driver.ErrVMNotFound) {
+			break
+		}
+		log.Printf("Deleting VM failed (attempt %d/%d): %s", attempt, vmDeleteAttempts, err)
+		if attempt < vmDeleteAttempts {
+			time.Sleep(vmDeleteRetryDelay)
+		}
+	}
+
+	switch {
+	case err == nil:
+		ui.Say("VM '" + vmName + "' cleaned up successfully")
+	case errors.Is(err, driver.ErrVMNotFound):
+		ui.Say("Warning: VM '" + vmName + "' no longer exists, nothing to clean up")
+	default:
+		err := fmt.Errorf("failed to delete VM '%s': %s", vmName, err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	return multistep.ActionContinue
+}
+
+func (s *stepCleanupVM) Cleanup(state multistep.StateBag) {
+	// This is the cleanup step itself
+}
@@ -0,0 +1,11 @@
+package meda
+
+import "io"
+
+// Subcommands are the subcommands of the plugin binary besides those
+// Packer runs it with, by name
+var Subcommands = map[string]func(args []string, stdout, stderr io.Writer) error{
+	"scaffold":        runScaffold,
+	"describe-config": runDescribeConfig,
+	"prune":           runPrune,
+}
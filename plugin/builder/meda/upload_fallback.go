@@ -0,0 +1,225 @@
+package meda
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// fileTransferProbe checks the guest for the helper the configured SSH
+// file transfer method needs: the scp binary, or an sftp-server
+var fileTransferProbe = map[string]string{
+	"scp": "command -v scp >/dev/null 2>&1",
+	"sftp": "for p in /usr/lib/openssh/sftp-server /usr/libexec/openssh/sftp-server /usr/lib/ssh/sftp-server /usr/libexec/sftp-server; " +
+		"do [ -x \"$p\" ] && exit 0; done; exit 1",
+}
+
+// execTransferCommunicator moves files through plain exec channels
+// instead of SCP or SFTP, for minimal guests such as busybox or Alpine
+// images that have neither. Files are streamed to cat, directories to
+// tar.
+type execTransferCommunicator struct {
+	packer.Communicator
+}
+
+// run runs command with stdin and stdout attached
+func (c *execTransferCommunicator) run(command string, stdin io.Reader, stdout io.Writer) error {
+	var stderr bytes.Buffer
+	cmd := &packer.RemoteCmd{Command: command, Stdin: stdin, Stdout: stdout, Stderr: &stderr}
+	if err := c.Communicator.Start(context.Background(), cmd); err != nil {
+		return err
+	}
+	if status := cmd.Wait(); status != 0 {
+		return fmt.Errorf("%s exited with status %d: %s", strings.Fields(command)[0], status, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+func (c *execTransferCommunicator) Upload(dst string, r io.Reader, fi *os.FileInfo) error {
+	command := fmt.Sprintf("cat > %s", shellQuote(dst))
+	if fi != nil {
+		command += fmt.Sprintf(" && chmod %o %s", (*fi).Mode().Perm(), shellQuote(dst))
+	}
+	return c.run(command, r, io.Discard)
+}
+
+// UploadDir follows the SCP semantics: with a trailing slash the contents
+// of src go into dst, without it src itself is created inside dst
+func (c *execTransferCommunicator) UploadDir(dst string, src string, exclude []string) error {
+	prefix := ""
+	if !strings.HasSuffix(src, "/") {
+		prefix = filepath.Base(src)
+	}
+
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		err := writeTar(pw, src, prefix, exclude)
+		pw.CloseWithError(err)
+		done <- err
+	}()
+	err := c.run(fmt.Sprintf("mkdir -p %[1]s && tar -xf - -C %[1]s", shellQuote(dst)), pr, io.Discard)
+	pr.Close()
+	// A failure to read src explains a failed extraction best
+	if tarErr := <-done; tarErr != nil && tarErr != io.ErrClosedPipe {
+		return tarErr
+	}
+	return err
+}
+
+func (c *execTransferCommunicator) Download(src string, w io.Writer) error {
+	return c.run(fmt.Sprintf("cat %s", shellQuote(src)), nil, w)
+}
+
+func (c *execTransferCommunicator) DownloadDir(src string, dst string, exclude []string) error {
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		err := readTar(pr, dst, exclude)
+		pr.CloseWithError(err)
+		done <- err
+	}()
+	err := c.run(fmt.Sprintf("tar -cf - -C %s .", shellQuote(src)), nil, pw)
+	pw.CloseWithError(err)
+	if tarErr := <-done; err == nil {
+		err = tarErr
+	}
+	return err
+}
+
+// excluded reports whether the relative path name matches one of the
+// exclude patterns
+func excluded(name string, exclude []string) bool {
+	for _, pattern := range exclude {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// writeTar writes the regular files and directories below src to w, with
+// names under prefix
+func writeTar(w io.Writer, src, prefix string, exclude []string) error {
+	tw := tar.NewWriter(w)
+	err := filepath.Walk(src, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		if rel != "." && excluded(rel, exclude) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		name := path.Join(prefix, filepath.ToSlash(rel))
+		if name == "." || (!info.IsDir() && !info.Mode().IsRegular()) {
+			return nil
+		}
+
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = name
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// readTar extracts the regular files and directories of the tar stream r
+// into dst
+func readTar(r io.Reader, dst string, exclude []string) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		name := path.Clean(hdr.Name)
+		if name == "." || excluded(name, exclude) {
+			continue
+		}
+		if strings.HasPrefix(name, "../") || path.IsAbs(name) {
+			return fmt.Errorf("refusing to extract %s outside of %s", hdr.Name, dst)
+		}
+		target := filepath.Join(dst, filepath.FromSlash(name))
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			f, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, os.FileMode(hdr.Mode).Perm())
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(f, tr)
+			f.Close()
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// stepExecTransferFallback switches file transfers to exec channels when
+// the guest lacks what the configured SSH file transfer method needs
+type stepExecTransferFallback struct{}
+
+func (s *stepExecTransferFallback) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	config := state.Get("config").(*Config)
+	comm := state.Get("communicator").(packer.Communicator)
+	ui := state.Get("ui").(packer.Ui)
+
+	method := config.Comm.SSHFileTransferMethod
+	if config.FileTransferFallback == "auto" {
+		if _, err := runRemote(ctx, comm, fileTransferProbe[method]); err == nil {
+			return multistep.ActionContinue
+		}
+		ui.Say(fmt.Sprintf("The guest has no %s support, transferring files through SSH exec channels instead", method))
+	} else {
+		ui.Say("Transferring files through SSH exec channels")
+	}
+
+	state.Put("communicator", &execTransferCommunicator{Communicator: comm})
+	return multistep.ActionContinue
+}
+
+func (s *stepExecTransferFallback) Cleanup(state multistep.StateBag) {}
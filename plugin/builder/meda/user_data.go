@@ -0,0 +1,265 @@
+package meda
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+const userDataBoundary = "MEDA-PACKER-BOUNDARY"
+
+// cloudConfigMergeHeader makes cloud-init merge a generated part into the
+// configured user-data instead of replacing its keys
+const cloudConfigMergeHeader = `#cloud-config
+merge_how:
+  - name: list
+    settings: [append]
+  - name: dict
+    settings: [no_replace, recurse_list]
+`
+
+// guestTimeCloudConfig returns a cloud-config part setting the guest
+// timezone and NTP servers, or nil when neither is configured
+func guestTimeCloudConfig(timezone string, ntpServers []string) []byte {
+	if timezone == "" && len(ntpServers) == 0 {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(cloudConfigMergeHeader)
+	if timezone != "" {
+		fmt.Fprintf(&buf, "timezone: %s\n", strconv.Quote(timezone))
+	}
+	if len(ntpServers) > 0 {
+		buf.WriteString("ntp:\n  enabled: true\n  servers:\n")
+		for _, server := range ntpServers {
+			fmt.Fprintf(&buf, "    - %s\n", strconv.Quote(server))
+		}
+	}
+	return buf.Bytes()
+}
+
+// guestHostnameCloudConfig returns a cloud-config part setting the guest
+// hostname, and the FQDN when hostname has a domain part
+func guestHostnameCloudConfig(hostname string) []byte {
+	if hostname == "" {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(cloudConfigMergeHeader)
+	buf.WriteString("preserve_hostname: false\n")
+	short, _, hasDomain := strings.Cut(hostname, ".")
+	fmt.Fprintf(&buf, "hostname: %s\n", strconv.Quote(short))
+	if hasDomain {
+		fmt.Fprintf(&buf, "fqdn: %s\n", strconv.Quote(hostname))
+	}
+	return buf.Bytes()
+}
+
+// guestUserCloudConfig returns a cloud-config part creating the SSH user
+// with a password and passwordless sudo, and enabling password logins,
+// which cloud images turn off
+func guestUserCloudConfig(username, password string) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(cloudConfigMergeHeader)
+	buf.WriteString("ssh_pwauth: true\nusers:\n")
+	fmt.Fprintf(&buf, "  - name: %s\n", strconv.Quote(username))
+	fmt.Fprintf(&buf, "    plain_text_passwd: %s\n", strconv.Quote(password))
+	buf.WriteString("    lock_passwd: false\n")
+	buf.WriteString("    shell: /bin/sh\n")
+	buf.WriteString("    sudo: \"ALL=(ALL) NOPASSWD:ALL\"\n")
+	return buf.Bytes()
+}
+
+// guestLocaleCloudConfig returns a cloud-config part setting the system
+// locale and console keyboard layout, or nil when neither is configured
+func guestLocaleCloudConfig(locale, keyboardLayout string) []byte {
+	if locale == "" && keyboardLayout == "" {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(cloudConfigMergeHeader)
+	if locale != "" {
+		fmt.Fprintf(&buf, "locale: %s\n", strconv.Quote(locale))
+	}
+	if keyboardLayout != "" {
+		fmt.Fprintf(&buf, "keyboard:\n  layout: %s\n", strconv.Quote(keyboardLayout))
+	}
+	return buf.Bytes()
+}
+
+// guestResolverCloudConfig returns a cloud-config part pointing the
+// guest's resolver at dnsServers and dnsSearch and adding hostEntries,
+// hostname to IP address, to /etc/hosts, or nil when nothing is
+// configured. It runs as a bootcmd, before sshd starts, so the first
+// provisioner can already resolve the names.
+func guestResolverCloudConfig(dnsServers, dnsSearch []string, hostEntries map[string]string) []byte {
+	if len(dnsServers) == 0 && len(dnsSearch) == 0 && len(hostEntries) == 0 {
+		return nil
+	}
+
+	var script strings.Builder
+	if len(dnsServers) > 0 || len(dnsSearch) > 0 {
+		// systemd-resolved owns resolv.conf where it runs, elsewhere the
+		// entries go to the top of resolv.conf
+		resolved := "[Resolve]\\n"
+		if len(dnsServers) > 0 {
+			resolved += "DNS=" + strings.Join(dnsServers, " ") + "\\n"
+		}
+		if len(dnsSearch) > 0 {
+			resolved += "Domains=" + strings.Join(dnsSearch, " ") + "\\n"
+		}
+		fmt.Fprintf(&script, "if [ -d /run/systemd/resolve ]; then "+
+			"mkdir -p /etc/systemd/resolved.conf.d && "+
+			"printf '%s' > /etc/systemd/resolved.conf.d/90-meda-packer.conf && "+
+			"systemctl try-restart systemd-resolved; else { ", resolved)
+		// bootcmd runs on every boot, lines from earlier boots are
+		// replaced rather than repeated
+		filter := "cat /etc/resolv.conf"
+		if len(dnsSearch) > 0 {
+			fmt.Fprintf(&script, "echo 'search %s'; ", strings.Join(dnsSearch, " "))
+			filter = "grep -v '^search\\|^domain' /etc/resolv.conf"
+		}
+		if len(dnsServers) > 0 {
+			filter += " | grep -vxF"
+		}
+		for _, server := range dnsServers {
+			fmt.Fprintf(&script, "echo 'nameserver %s'; ", server)
+			filter += " -e 'nameserver " + server + "'"
+		}
+		script.WriteString(filter + "; true; } > /etc/resolv.conf.meda && " +
+			"cat /etc/resolv.conf.meda > /etc/resolv.conf && rm -f /etc/resolv.conf.meda; fi\n")
+	}
+	hostnames := make([]string, 0, len(hostEntries))
+	for hostname := range hostEntries {
+		hostnames = append(hostnames, hostname)
+	}
+	sort.Strings(hostnames)
+	for _, hostname := range hostnames {
+		line := hostEntries[hostname] + " " + hostname
+		fmt.Fprintf(&script, "grep -qxF '%s' /etc/hosts || echo '%s' >> /etc/hosts\n", line, line)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(cloudConfigMergeHeader)
+	if len(hostEntries) > 0 {
+		// Keep cloud-init from rewriting /etc/hosts after bootcmd
+		buf.WriteString("manage_etc_hosts: false\n")
+	}
+	fmt.Fprintf(&buf, "bootcmd:\n  - [sh, -c, %s]\n", strconv.Quote(script.String()))
+	return buf.Bytes()
+}
+
+// userDataContentType guesses the MIME type of a user-data document from
+// its first line
+func userDataContentType(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte("#!")):
+		return "text/x-shellscript"
+	case bytes.HasPrefix(data, []byte("#include")):
+		return "text/x-include-url"
+	case bytes.HasPrefix(data, []byte("#cloud-boothook")):
+		return "text/cloud-boothook"
+	default:
+		return "text/cloud-config"
+	}
+}
+
+// multipartUserData combines user-data documents into one MIME multipart
+// message that cloud-init processes part by part
+func multipartUserData(parts ...[]byte) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "Content-Type: multipart/mixed; boundary=\"%s\"\nMIME-Version: 1.0\n", userDataBoundary)
+	for _, part := range parts {
+		fmt.Fprintf(&buf, "\n--%s\nContent-Type: %s; charset=\"utf-8\"\n\n", userDataBoundary, userDataContentType(part))
+		buf.Write(part)
+		if !bytes.HasSuffix(part, []byte("\n")) {
+			buf.WriteString("\n")
+		}
+	}
+	fmt.Fprintf(&buf, "\n--%s--\n", userDataBoundary)
+	return buf.Bytes()
+}
+
+// addUserDataPart queues a generated cloud-init part for stepUserData
+func addUserDataPart(state multistep.StateBag, part []byte) {
+	var parts [][]byte
+	if v, ok := state.GetOk("user_data_parts"); ok {
+		parts = v.([][]byte)
+	}
+	state.Put("user_data_parts", append(parts, part))
+}
+
+// stepUserData combines the configured user_data_file with the parts
+// generated by the builder into one multipart user-data file. Without
+// generated parts the configured file is used as is.
+type stepUserData struct{}
+
+func (s *stepUserData) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	config := state.Get("config").(*Config)
+	ui := state.Get("ui").(packer.Ui)
+
+	if config.createSSHUser {
+		addUserDataPart(state, guestUserCloudConfig(config.Comm.SSHUsername, config.Comm.SSHPassword))
+	}
+	if part := guestTimeCloudConfig(config.GuestTimezone, config.NTPServers); part != nil {
+		addUserDataPart(state, part)
+	}
+
+	if part := guestLocaleCloudConfig(config.Locale, config.KeyboardLayout); part != nil {
+		addUserDataPart(state, part)
+	}
+	if part := guestHostnameCloudConfig(config.GuestHostname); part != nil {
+		addUserDataPart(state, part)
+	}
+	if part := guestResolverCloudConfig(config.DNSServers, config.DNSSearch, config.HostEntries); part != nil {
+		addUserDataPart(state, part)
+	}
+	// Must stay last: the power off is the build's only sign that
+	// cloud-init is done
+	if config.waitsForPowerOff() {
+		addUserDataPart(state, []byte(cloudInitPowerOffCloudConfig))
+	}
+
+	v, ok := state.GetOk("user_data_parts")
+	if !ok {
+		return multistep.ActionContinue
+	}
+
+	parts := [][]byte{}
+	if config.UserDataFile != "" {
+		data, err := os.ReadFile(config.UserDataFile)
+		if err != nil {
+			err := fmt.Errorf("failed to read user_data_file: %s", err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+		parts = append(parts, data)
+	}
+	parts = append(parts, v.([][]byte)...)
+
+	// Kept with the build directory when the build fails
+	path := filepath.Join(state.Get("build_dir").(string), "user-data.txt")
+	if err := os.WriteFile(path, multipartUserData(parts...), 0600); err != nil {
+		err := fmt.Errorf("failed to write user-data file: %s", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	state.Put("user_data_file", path)
+	return multistep.ActionContinue
+}
+
+func (s *stepUserData) Cleanup(state multistep.StateBag) {}
@@ -0,0 +1,333 @@
+package meda
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/packer-plugin-sdk/communicator/sshkey"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// VaultAuth configures fetching build secrets from HashiCorp Vault
+type VaultAuth struct {
+	// Address of the Vault server. Defaults to VAULT_ADDR.
+	Address string `mapstructure:"address"`
+	// Namespace for Vault Enterprise. Defaults to VAULT_NAMESPACE.
+	Namespace string `mapstructure:"namespace"`
+	// Path is the mount of the JWT auth method, e.g. auth/jwt. Without it
+	// the token from VAULT_TOKEN is used.
+	Path string `mapstructure:"path"`
+	// Role is the JWT auth role to log in with
+	Role string `mapstructure:"role"`
+	// Env maps environment variables passed to meda, such as
+	// GITHUB_TOKEN, to secrets given as <path>#<field>
+	Env map[string]string `mapstructure:"env"`
+	// SSHPrivateKey is the <path>#<field> of the key the communicator
+	// connects with
+	SSHPrivateKey string `mapstructure:"ssh_private_key"`
+}
+
+// prepare applies defaults and validates the Vault configuration
+func (v *VaultAuth) prepare() []error {
+	var errs []error
+
+	if v.Address == "" {
+		v.Address = os.Getenv("VAULT_ADDR")
+	}
+	v.Address = strings.TrimSuffix(v.Address, "/")
+	if v.Namespace == "" {
+		v.Namespace = os.Getenv("VAULT_NAMESPACE")
+	}
+	v.Path = strings.Trim(v.Path, "/")
+
+	if v.Address == "" {
+		errs = append(errs, fmt.Errorf("vault_auth.address is required when VAULT_ADDR is not set"))
+	}
+	if v.Path != "" && v.Role == "" {
+		errs = append(errs, fmt.Errorf("vault_auth.role is required with vault_auth.path"))
+	}
+	if v.Path == "" && os.Getenv("VAULT_TOKEN") == "" {
+		errs = append(errs, fmt.Errorf("vault_auth needs a path and role to log in, or a token in VAULT_TOKEN"))
+	}
+	for name, ref := range v.Env {
+		if _, _, err := parseVaultRef(ref); err != nil {
+			errs = append(errs, fmt.Errorf("vault_auth.env %s: %s", name, err))
+		}
+	}
+	if v.SSHPrivateKey != "" {
+		if _, _, err := parseVaultRef(v.SSHPrivateKey); err != nil {
+			errs = append(errs, fmt.Errorf("vault_auth.ssh_private_key: %s", err))
+		}
+	}
+	return errs
+}
+
+// parseVaultRef splits a secret reference <path>#<field>
+func parseVaultRef(ref string) (path, field string, err error) {
+	path, field, ok := strings.Cut(ref, "#")
+	if !ok || path == "" || field == "" {
+		return "", "", fmt.Errorf("secret reference %q must have the form <path>#<field>", ref)
+	}
+	return strings.Trim(path, "/"), field, nil
+}
+
+// vaultClient talks to the Vault HTTP API
+type vaultClient struct {
+	address   string
+	namespace string
+	token     string
+	client    *http.Client
+}
+
+// vaultAuthResponse is the auth part of login and renew responses
+type vaultAuthResponse struct {
+	Auth struct {
+		ClientToken   string `json:"client_token"`
+		LeaseDuration int    `json:"lease_duration"`
+		Renewable     bool   `json:"renewable"`
+	} `json:"auth"`
+}
+
+// do performs a Vault API request, decoding the response into out if set
+func (c *vaultClient) do(method, path string, body interface{}, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, c.address+"/v1/"+path, reader)
+	if err != nil {
+		return err
+	}
+	if c.token != "" {
+		req.Header.Set("X-Vault-Token", c.token)
+	}
+	if c.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", c.namespace)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read Vault response for %s: %s", path, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("vault %s %s: %s - %s", method, path, resp.Status, strings.TrimSpace(string(data)))
+	}
+	if out == nil || len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
+
+// vaultJWT returns the JWT to log in with: VAULT_JWT if set, otherwise the
+// GitHub Actions OIDC token when the job may request one
+func vaultJWT(client *http.Client) (string, error) {
+	if jwt := os.Getenv("VAULT_JWT"); jwt != "" {
+		return jwt, nil
+	}
+
+	requestURL := os.Getenv("ACTIONS_ID_TOKEN_REQUEST_URL")
+	requestToken := os.Getenv("ACTIONS_ID_TOKEN_REQUEST_TOKEN")
+	if requestURL == "" || requestToken == "" {
+		return "", fmt.Errorf("no JWT for Vault login: set VAULT_JWT, or grant the GitHub Actions job `id-token: write`")
+	}
+
+	req, err := http.NewRequest("GET", requestURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+requestToken)
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to request GitHub OIDC token: %s", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to request GitHub OIDC token: %s", resp.Status)
+	}
+
+	var token struct {
+		Value string `json:"value"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("failed to parse GitHub OIDC token: %s", err)
+	}
+	return token.Value, nil
+}
+
+// read returns one field of a secret. KV version 2 responses nest the
+// fields in data.data, version 1 and other engines in data.
+func (c *vaultClient) read(ref string) (string, error) {
+	path, field, err := parseVaultRef(ref)
+	if err != nil {
+		return "", err
+	}
+
+	var secret struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := c.do("GET", path, nil, &secret); err != nil {
+		return "", err
+	}
+
+	fields := secret.Data
+	if nested, ok := fields["data"].(map[string]interface{}); ok {
+		if _, isKV1Field := fields[field]; !isKV1Field {
+			fields = nested
+		}
+	}
+	value, ok := fields[field].(string)
+	if !ok {
+		return "", fmt.Errorf("secret %s has no string field %q", path, field)
+	}
+	return value, nil
+}
+
+// stepVaultSecrets logs in to Vault and fetches the configured secrets.
+// The login token is renewed while the build runs and revoked afterwards.
+type stepVaultSecrets struct {
+	client    *vaultClient
+	loggedIn  bool
+	stopRenew context.CancelFunc
+}
+
+func (s *stepVaultSecrets) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	config := state.Get("config").(*Config)
+	ui := state.Get("ui").(packer.Ui)
+	vault := config.VaultAuth
+
+	s.client = &vaultClient{
+		address:   vault.Address,
+		namespace: vault.Namespace,
+		token:     os.Getenv("VAULT_TOKEN"),
+		client:    &http.Client{Timeout: 30 * time.Second},
+	}
+
+	if vault.Path != "" {
+		ui.Say(fmt.Sprintf("Logging in to Vault at %s with role '%s'", vault.Address, vault.Role))
+		if err := s.login(ctx, vault); err != nil {
+			err := fmt.Errorf("vault login failed: %s", err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+	}
+	packer.LogSecretFilter.Set(s.client.token)
+
+	for _, name := range sortedKeys(vault.Env) {
+		value, err := s.client.read(vault.Env[name])
+		if err != nil {
+			err := fmt.Errorf("failed to read %s from Vault: %s", name, err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+		packer.LogSecretFilter.Set(value)
+		if config.MedaEnv == nil {
+			config.MedaEnv = map[string]string{}
+		}
+		config.MedaEnv[name] = value
+		ui.Say(fmt.Sprintf("Read %s from Vault", name))
+	}
+	if len(vault.Env) > 0 {
+		// The driver copied meda_env when it was built
+		resetDriver(state)
+	}
+
+	if vault.SSHPrivateKey != "" {
+		key, err := s.client.read(vault.SSHPrivateKey)
+		if err == nil {
+			packer.LogSecretFilter.Set(key)
+			config.Comm.SSHPrivateKey = []byte(key)
+			config.Comm.SSHPublicKey, err = sshkey.PublicKeyFromPrivate(config.Comm.SSHPrivateKey)
+		}
+		if err != nil {
+			err := fmt.Errorf("failed to read SSH private key from Vault: %s", err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+		ui.Say("Read SSH private key from Vault")
+	}
+
+	return multistep.ActionContinue
+}
+
+// login exchanges a JWT for a Vault token and keeps renewing the token
+// in the background
+func (s *stepVaultSecrets) login(ctx context.Context, vault *VaultAuth) error {
+	jwt, err := vaultJWT(s.client.client)
+	if err != nil {
+		return err
+	}
+
+	var resp vaultAuthResponse
+	err = s.client.do("POST", vault.Path+"/login", map[string]string{
+		"role": vault.Role,
+		"jwt":  jwt,
+	}, &resp)
+	if err != nil {
+		return err
+	}
+	if resp.Auth.ClientToken == "" {
+		return fmt.Errorf("no token in login response")
+	}
+	s.client.token = resp.Auth.ClientToken
+	s.loggedIn = true
+
+	if resp.Auth.Renewable && resp.Auth.LeaseDuration > 0 {
+		renewCtx, cancel := context.WithCancel(context.Background())
+		s.stopRenew = cancel
+		go s.renew(renewCtx, time.Duration(resp.Auth.LeaseDuration)*time.Second)
+	}
+	return nil
+}
+
+// renew renews the login token at half its lease until ctx is done
+func (s *stepVaultSecrets) renew(ctx context.Context, lease time.Duration) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(lease / 2):
+		}
+
+		var resp vaultAuthResponse
+		if err := s.client.do("POST", "auth/token/renew-self", nil, &resp); err != nil {
+			log.Printf("Failed to renew Vault token: %s", err)
+			continue
+		}
+		if resp.Auth.LeaseDuration > 0 {
+			lease = time.Duration(resp.Auth.LeaseDuration) * time.Second
+		}
+	}
+}
+
+func (s *stepVaultSecrets) Cleanup(state multistep.StateBag) {
+	if s.stopRenew != nil {
+		s.stopRenew()
+	}
+	if s.loggedIn {
+		if err := s.client.do("POST", "auth/token/revoke-self", nil, nil); err != nil {
+			log.Printf("Failed to revoke Vault token: %s", err)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package meda
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cirunlabs/packer-plugin-meda/driver"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+func TestStepVaultSecrets_envReachesDriver(t *testing.T) {
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/secret/data/github" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"data":{"data":{"token":"vault-token"}}}`))
+	}))
+	defer vault.Close()
+	t.Setenv("VAULT_TOKEN", "root")
+	t.Setenv("GITHUB_TOKEN", "")
+
+	// A meda that lists one VM named after the GITHUB_TOKEN it was given
+	meda := filepath.Join(t.TempDir(), "meda")
+	script := "#!/bin/sh\nprintf '[{\"name\":\"%s\"}]' \"$GITHUB_TOKEN\"\n"
+	if err := os.WriteFile(meda, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// No meda_env in the template
+	config := &Config{
+		MedaBinary: meda,
+		VaultAuth: &VaultAuth{
+			Address: vault.URL,
+			Env:     map[string]string{"GITHUB_TOKEN": "secret/data/github#token"},
+		},
+	}
+	state := new(multistep.BasicStateBag)
+	state.Put("config", config)
+	state.Put("ui", packer.TestUi(t))
+	state.Put("driver", driver.NewDriver(config.DriverConfig(), nil))
+
+	step := &stepVaultSecrets{}
+	defer step.Cleanup(state)
+	if action := step.Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("step halted: %v", state.Get("error"))
+	}
+
+	vms, err := state.Get("driver").(driver.MedaDriver).ListVMs()
+	if err != nil {
+		t.Fatalf("ListVMs: %s", err)
+	}
+	if len(vms) != 1 || vms[0].Name != "vault-token" {
+		t.Errorf("meda got GITHUB_TOKEN %v, want the secret from Vault", vms)
+	}
+}
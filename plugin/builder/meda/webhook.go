@@ -0,0 +1,157 @@
+package meda
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/cirunlabs/packer-plugin-meda/driver"
+	"github.com/cirunlabs/packer-plugin-meda/version"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// webhookEvents are the events a webhook can subscribe to
+var webhookEvents = []string{"build.started", "image.created", "image.pushed", "build.finished", "build.failed"}
+
+// webhookTimeout bounds a single webhook delivery
+const webhookTimeout = 10 * time.Second
+
+// Webhook is a URL that build events are POSTed to
+type Webhook struct {
+	// URL receiving the JSON payloads
+	URL string `mapstructure:"url" required:"true"`
+	// Events to send, all of webhookEvents when empty
+	Events []string `mapstructure:"events"`
+	// Headers added to every request, e.g. Authorization
+	Headers map[string]string `mapstructure:"headers"`
+}
+
+// prepare validates the webhook
+func (w *Webhook) prepare() []error {
+	var errs []error
+	if u, err := url.Parse(w.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs = append(errs, fmt.Errorf("webhook.url must be an http or https URL, got %q", w.URL))
+	}
+	for _, event := range w.Events {
+		if !slices.Contains(webhookEvents, event) {
+			errs = append(errs, fmt.Errorf("webhook.events: unknown event %q, must be one of %s", event, strings.Join(webhookEvents, ", ")))
+		}
+	}
+	return errs
+}
+
+// wants reports whether the webhook subscribed to event
+func (w *Webhook) wants(event string) bool {
+	return len(w.Events) == 0 || slices.Contains(w.Events, event)
+}
+
+// WebhookPayload is the JSON body POSTed for every event
+type WebhookPayload struct {
+	Event     string `json:"event"`
+	Build     string `json:"build"`
+	VMName    string `json:"vm_name"`
+	RunUUID   string `json:"run_uuid"`
+	Timestamp string `json:"timestamp"`
+	// DurationSeconds is the time since the build started
+	DurationSeconds float64  `json:"duration_seconds"`
+	Image           string   `json:"image,omitempty"`
+	Digest          string   `json:"digest,omitempty"`
+	PushedImages    []string `json:"pushed_images,omitempty"`
+	Error           string   `json:"error,omitempty"`
+}
+
+// sendWebhooks POSTs event to every webhook subscribed to it. Delivery
+// failures are only reported, a webhook never fails the build.
+func sendWebhooks(ctx context.Context, state multistep.StateBag, event string, buildErr error) {
+	config := state.Get("config").(*Config)
+	ui := state.Get("ui").(packer.Ui)
+	if config.MockMode {
+		return
+	}
+
+	payload := WebhookPayload{
+		Event:     event,
+		Build:     config.PackerBuildName,
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+	}
+	payload.VMName, _ = state.Get("vm_name").(string)
+	payload.RunUUID, _ = state.Get("run_uuid").(string)
+	if started, ok := state.Get("build_started").(time.Time); ok {
+		payload.DurationSeconds = time.Since(started).Round(time.Second).Seconds()
+	}
+	payload.Image, _ = state.Get("image_name").(string)
+	if info, ok := state.Get("image_info").(*driver.ImageInfo); ok && info != nil {
+		payload.Digest = info.Digest
+	}
+	payload.PushedImages, _ = state.Get("pushed_images").([]string)
+	if buildErr != nil {
+		payload.Error = buildErr.Error()
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("Failed to encode webhook payload: %s", err)
+		return
+	}
+	for _, hook := range config.Webhooks {
+		if !hook.wants(event) {
+			continue
+		}
+		if err := postWebhook(ctx, hook, body); err != nil {
+			ui.Say(fmt.Sprintf("Warning: failed to send %s webhook: %s", event, err))
+		}
+	}
+}
+
+// postWebhook delivers one payload
+func postWebhook(ctx context.Context, hook Webhook, body []byte) error {
+	// A cancelled build still reports build.failed
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), webhookTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "packer-plugin-meda/"+version.Version)
+	for _, k := range sortedKeys(hook.Headers) {
+		req.Header.Set(k, hook.Headers[k])
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s - %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+	return nil
+}
+
+// stepWebhook sends event at its place in the pipeline, if the state has
+// the key the event is about
+type stepWebhook struct {
+	event string
+	key   string
+}
+
+func (s *stepWebhook) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	if _, ok := state.GetOk(s.key); ok {
+		sendWebhooks(ctx, state, s.event, nil)
+	}
+	return multistep.ActionContinue
+}
+
+func (s *stepWebhook) Cleanup(state multistep.StateBag) {}
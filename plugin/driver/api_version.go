@@ -0,0 +1,106 @@
+package driver
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// APIFeature is a group of Meda API endpoints a build may depend on
+type APIFeature string
+
+const (
+	// APIFeatureVMs is creating, starting, stopping and deleting VMs and
+	// capturing images from them, which every build needs
+	APIFeatureVMs APIFeature = "VMs"
+	// APIFeaturePush is POST images/push
+	APIFeaturePush APIFeature = "image push"
+	// APIFeatureSnapshots is POST vms/<name>/snapshots and creating images
+	// from a snapshot
+	APIFeatureSnapshots APIFeature = "VM snapshots"
+	// APIFeatureResize is PATCH vms/<name>
+	APIFeatureResize APIFeature = "VM resize"
+	// APIFeatureExport is POST images/<ref>/export and GET
+	// images/<ref>/export
+	APIFeatureExport APIFeature = "image export"
+	// APIFeatureImport is POST images/import
+	APIFeatureImport APIFeature = "image import"
+)
+
+// apiFeatureSince is the first Meda release whose API server serves each
+// feature. Keep it in step with the endpoints APIDriver calls.
+var apiFeatureSince = map[APIFeature]medaVersion{
+	APIFeatureVMs:       {0, 1, 0},
+	APIFeaturePush:      {0, 2, 0},
+	APIFeatureExport:    {0, 2, 0},
+	APIFeatureImport:    {0, 2, 0},
+	APIFeatureSnapshots: {0, 3, 0},
+	APIFeatureResize:    {0, 3, 0},
+}
+
+// newestKnownAPIMajor is the newest major release the plugin knows the
+// API of; a newer one may have moved endpoints
+const newestKnownAPIMajor = 0
+
+// UnsupportedAPIFeature is a feature an API server is too old for
+type UnsupportedAPIFeature struct {
+	Feature APIFeature
+	// Since is the first Meda release serving the feature
+	Since string
+}
+
+// ServerVersion returns the Meda release of the API server, from
+// GET version. Servers older than the endpoint answer with an error
+// wrapping ErrNotFound.
+func (d *APIDriver) ServerVersion() (string, error) {
+	output, err := d.Do("GET", "version", "")
+	if err != nil {
+		return "", err
+	}
+
+	// {"version": "0.3.1"} or the bare version
+	var body struct {
+		Version string `json:"version"`
+	}
+	if err := json.Unmarshal([]byte(output), &body); err == nil && body.Version != "" {
+		output = body.Version
+	}
+	v, ok := parseMedaVersion(output)
+	if !ok {
+		return "", fmt.Errorf("unrecognized version %q", strings.TrimSpace(output))
+	}
+	return v.String(), nil
+}
+
+// UnsupportedAPIFeatures returns the features of needed that the API
+// server of Meda release version doesn't serve yet. newer reports a major
+// release the plugin doesn't know the API of.
+func UnsupportedAPIFeatures(version string, needed []APIFeature) (unsupported []UnsupportedAPIFeature, newer bool, err error) {
+	v, ok := parseMedaVersion(version)
+	if !ok {
+		return nil, false, fmt.Errorf("unrecognized version %q", version)
+	}
+	for _, f := range needed {
+		since, known := apiFeatureSince[f]
+		if known && !v.atLeast(since) {
+			unsupported = append(unsupported, UnsupportedAPIFeature{Feature: f, Since: since.String()})
+		}
+	}
+	return unsupported, v[0] > newestKnownAPIMajor, nil
+}
+
+// APIFeatureSince returns the first Meda release serving f
+func APIFeatureSince(f APIFeature) string {
+	return apiFeatureSince[f].String()
+}
+
+// MinAPIVersion returns the first Meda release serving all of features
+func MinAPIVersion(features []APIFeature) string {
+	var min medaVersion
+	for _, f := range features {
+		if since := apiFeatureSince[f]; !min.atLeast(since) {
+			min = since
+		}
+	}
+	return min.String()
+}
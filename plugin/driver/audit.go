@@ -0,0 +1,251 @@
+package driver
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"os/user"
+	"sync"
+	"time"
+)
+
+// auditEntry is one line of the audit log
+type auditEntry struct {
+	Time    string                 `json:"time"`
+	Action  string                 `json:"action"`
+	Target  string                 `json:"target"`
+	Params  map[string]interface{} `json:"params,omitempty"`
+	Outcome string                 `json:"outcome"`
+	Error   string                 `json:"error,omitempty"`
+	Backend string                 `json:"backend"`
+	User    string                 `json:"user,omitempty"`
+	Host    string                 `json:"host,omitempty"`
+}
+
+// auditLog appends JSON lines to the audit_log_file. Builds running in
+// parallel share the file, each line is written with a single append.
+type auditLog struct {
+	path    string
+	backend string
+
+	mu sync.Mutex
+}
+
+// record appends an entry for action on target with the outcome err
+func (a *auditLog) record(action, target string, params map[string]interface{}, err error) {
+	entry := auditEntry{
+		Time:    time.Now().UTC().Format(time.RFC3339Nano),
+		Action:  action,
+		Target:  target,
+		Params:  params,
+		Outcome: "success",
+		Backend: a.backend,
+	}
+	if err != nil {
+		entry.Outcome = "failure"
+		entry.Error = err.Error()
+	}
+	if u, err := user.Current(); err == nil {
+		entry.User = u.Username
+	}
+	entry.Host, _ = os.Hostname()
+
+	line, jerr := json.Marshal(entry)
+	if jerr != nil {
+		log.Printf("Failed to encode audit log entry: %s", jerr)
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	f, ferr := os.OpenFile(a.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if ferr != nil {
+		log.Printf("Failed to open audit log %s: %s", a.path, ferr)
+		return
+	}
+	defer f.Close()
+	if _, ferr := f.Write(append(line, '\n')); ferr != nil {
+		log.Printf("Failed to write audit log %s: %s", a.path, ferr)
+	}
+}
+
+// auditDriver records every call of the wrapped driver that changes
+// images or VMs. Read-only calls pass through unrecorded.
+type auditDriver struct {
+	MedaDriver
+	log *auditLog
+}
+
+func (d *auditDriver) CreateImage(name string) error {
+	err := d.MedaDriver.CreateImage(name)
+	d.log.record("create_image", name, nil, err)
+	return err
+}
+
+func (d *auditDriver) CreateImageFromVM(vmName, name, tag string, labels map[string]string) error {
+	err := d.MedaDriver.CreateImageFromVM(vmName, name, tag, labels)
+	d.log.record("create_image", name+":"+tag, map[string]interface{}{
+		"vm":     vmName,
+		"labels": labels,
+	}, err)
+	return err
+}
+
+func (d *auditDriver) CreateImageFromSnapshot(vmName, snapshot, name, tag string, labels map[string]string) error {
+	err := d.MedaDriver.CreateImageFromSnapshot(vmName, snapshot, name, tag, labels)
+	d.log.record("create_image", name+":"+tag, map[string]interface{}{
+		"vm":       vmName,
+		"snapshot": snapshot,
+		"labels":   labels,
+	}, err)
+	return err
+}
+
+func (d *auditDriver) DeleteImage(name string) error {
+	err := d.MedaDriver.DeleteImage(name)
+	d.log.record("delete_image", name, nil, err)
+	return err
+}
+
+func (d *auditDriver) PushImage(opts PushOptions) error {
+	err := d.MedaDriver.PushImage(opts)
+	d.log.record("push_image", opts.TargetImage, map[string]interface{}{
+		"image":    opts.ImageName,
+		"registry": opts.Registry,
+		"dry_run":  opts.DryRun,
+		"insecure": opts.Insecure,
+	}, err)
+	return err
+}
+
+func (d *auditDriver) ExportImage(ref, path, format string) error {
+	err := d.MedaDriver.ExportImage(ref, path, format)
+	d.log.record("export_image", ref, map[string]interface{}{
+		"path":   path,
+		"format": format,
+	}, err)
+	return err
+}
+
+func (d *auditDriver) ExportImageStream(ref, format string) (io.ReadCloser, error) {
+	r, err := d.MedaDriver.ExportImageStream(ref, format)
+	d.log.record("export_image", ref, map[string]interface{}{
+		"path":   "-",
+		"format": format,
+	}, err)
+	return r, err
+}
+
+func (d *auditDriver) ImportImage(path, name string) error {
+	err := d.MedaDriver.ImportImage(path, name)
+	d.log.record("import_image", name, map[string]interface{}{
+		"path": path,
+	}, err)
+	return err
+}
+
+func (d *auditDriver) ImportImageStream(r io.Reader, name string) error {
+	err := d.MedaDriver.ImportImageStream(r, name)
+	d.log.record("import_image", name, map[string]interface{}{
+		"path": "-",
+	}, err)
+	return err
+}
+
+func (d *auditDriver) CreateVM(opts VMOptions) error {
+	err := d.MedaDriver.CreateVM(opts)
+	params := map[string]interface{}{
+		"base_image": opts.BaseImage,
+		"memory":     opts.Memory,
+		"cpus":       opts.CPUs,
+		"disk":       opts.DiskSize,
+	}
+	if opts.MACAddress != "" {
+		params["mac_address"] = opts.MACAddress
+	}
+	if len(opts.Volumes) > 0 {
+		params["volumes"] = opts.Volumes
+	}
+	if opts.Network != "" {
+		params["network"] = opts.Network
+	}
+	if len(opts.NetworkAllow) > 0 {
+		params["network_allow"] = opts.NetworkAllow
+	}
+	if opts.Hugepages {
+		params["hugepages"] = true
+	}
+	if opts.KSM {
+		params["ksm"] = true
+	}
+	if opts.IOThreads > 0 {
+		params["io_threads"] = opts.IOThreads
+	}
+	if opts.VirtioQueues > 0 {
+		params["virtio_queues"] = opts.VirtioQueues
+	}
+	if opts.CPUAffinity != "" {
+		params["cpu_affinity"] = opts.CPUAffinity
+	}
+	if opts.NUMANode != nil {
+		params["numa_node"] = *opts.NUMANode
+	}
+	if opts.DiskIOLimitMBps > 0 {
+		params["disk_io_limit_mbps"] = opts.DiskIOLimitMBps
+	}
+	if opts.CPUShares > 0 {
+		params["cpu_shares"] = opts.CPUShares
+	}
+	if opts.MemoryBalloon {
+		params["memory_balloon"] = true
+	}
+	if opts.MaxMemory != "" {
+		params["max_memory"] = opts.MaxMemory
+	}
+	d.log.record("create_vm", opts.Name, params, err)
+	return err
+}
+
+func (d *auditDriver) StartVM(name string) error {
+	err := d.MedaDriver.StartVM(name)
+	d.log.record("start_vm", name, nil, err)
+	return err
+}
+
+func (d *auditDriver) StopVM(name string) error {
+	err := d.MedaDriver.StopVM(name)
+	d.log.record("stop_vm", name, nil, err)
+	return err
+}
+
+func (d *auditDriver) ResizeVM(name, memory string, cpus int) error {
+	err := d.MedaDriver.ResizeVM(name, memory, cpus)
+	d.log.record("resize_vm", name, map[string]interface{}{
+		"memory": memory,
+		"cpus":   cpus,
+	}, err)
+	return err
+}
+
+func (d *auditDriver) SnapshotVM(name, snapshot string) error {
+	err := d.MedaDriver.SnapshotVM(name, snapshot)
+	d.log.record("snapshot_vm", name, map[string]interface{}{
+		"snapshot": snapshot,
+	}, err)
+	return err
+}
+
+func (d *auditDriver) DeleteSnapshot(name, snapshot string) error {
+	err := d.MedaDriver.DeleteSnapshot(name, snapshot)
+	d.log.record("delete_snapshot", name, map[string]interface{}{
+		"snapshot": snapshot,
+	}, err)
+	return err
+}
+
+func (d *auditDriver) DeleteVM(name string) error {
+	err := d.MedaDriver.DeleteVM(name)
+	d.log.record("delete_vm", name, nil, err)
+	return err
+}
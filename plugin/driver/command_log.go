@@ -0,0 +1,89 @@
+package driver
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// sensitiveEnvPattern matches environment variable names whose values are
+// never written to the log
+var sensitiveEnvPattern = regexp.MustCompile(`(?i)(token|secret|passw|key|credential|auth|connection_string)`)
+
+// commandLogEnabled reports whether Packer logging is on. The dumps are
+// only useful there and building them for every command isn't free.
+func commandLogEnabled() bool {
+	v := os.Getenv("PACKER_LOG")
+	return v != "" && v != "0"
+}
+
+// envDelta returns the entries of env that differ from the plugin's own
+// environment, with sensitive values redacted
+func envDelta(env []string) []string {
+	if env == nil {
+		return nil
+	}
+	inherited := make(map[string]bool, len(os.Environ()))
+	for _, kv := range os.Environ() {
+		inherited[kv] = true
+	}
+
+	var delta []string
+	for _, kv := range env {
+		if inherited[kv] {
+			continue
+		}
+		if k, _, ok := strings.Cut(kv, "="); ok && sensitiveEnvPattern.MatchString(k) {
+			kv = k + "=<redacted>"
+		}
+		delta = append(delta, kv)
+	}
+	return delta
+}
+
+// LogCommand writes the command line, working directory and environment
+// changes of cmd to the Packer log. The returned function logs the exit
+// status and duration and must be called once the command has finished.
+// Secrets registered with Packer are filtered from everything logged.
+func LogCommand(cmd *exec.Cmd) (finished func(err error)) {
+	if !commandLogEnabled() {
+		return func(error) {}
+	}
+
+	dir := cmd.Dir
+	if dir == "" {
+		dir = "."
+	}
+	var b strings.Builder
+	b.WriteString("Running command: " + strings.Join(cmd.Args, " "))
+	b.WriteString("\n  dir: " + dir)
+	for _, kv := range envDelta(cmd.Env) {
+		b.WriteString("\n  env: " + kv)
+	}
+	log.Print(packer.LogSecretFilter.FilterString(b.String()))
+
+	started := time.Now()
+	return func(err error) {
+		status := 0
+		var exitErr *exec.ExitError
+		switch {
+		case errors.As(err, &exitErr):
+			status = exitErr.ExitCode()
+		case err != nil:
+			status = -1
+		}
+		msg := strings.Join(cmd.Args, " ")
+		if len(msg) > 80 {
+			msg = msg[:80] + "..."
+		}
+		log.Print(packer.LogSecretFilter.FilterString(fmt.Sprintf("Command finished: %s (exit status %d, %s)",
+			msg, status, time.Since(started).Round(time.Millisecond))))
+	}
+}
@@ -0,0 +1,52 @@
+package driver
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
+)
+
+// CommandData is what the arguments of a command override can refer to
+type CommandData struct {
+	// Name is the VM the command is about
+	Name         string
+	BaseImage    string
+	Memory       string
+	CPUs         int
+	DiskSize     string
+	UserDataFile string
+	// Image and Tag are the image being captured, or for push the local
+	// image and Target the registry reference
+	Image    string
+	Tag      string
+	Snapshot string
+	Target   string
+	Registry string
+}
+
+// RenderCommandArgs renders the argument templates of an override.
+// Arguments that render empty are left out.
+func RenderCommandArgs(args []string, data CommandData) ([]string, error) {
+	ctx := &interpolate.Context{Data: data}
+	var rendered []string
+	for _, arg := range args {
+		s, err := interpolate.Render(arg, ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to render %q: %s", arg, err)
+		}
+		if s != "" {
+			rendered = append(rendered, s)
+		}
+	}
+	return rendered, nil
+}
+
+// commandArgs returns the arguments for operation key: the override
+// rendered with data if one is configured, defaults otherwise
+func (d *CLIDriver) commandArgs(key string, data CommandData, defaults []string) ([]string, error) {
+	args := d.config.Commands[key]
+	if len(args) == 0 {
+		return defaults, nil
+	}
+	return RenderCommandArgs(args, data)
+}
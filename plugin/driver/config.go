@@ -0,0 +1,36 @@
+package driver
+
+import (
+	"time"
+
+	"github.com/hashicorp/packer-plugin-sdk/template/config"
+)
+
+// Config is how a driver reaches Meda. The builder and the other
+// components of the plugin fill it from their own configuration, which
+// has already applied the defaults.
+type Config struct {
+	// MedaBinary is the meda CLI, or "cargo" to run it from the source
+	// checkout in MedaWorkingDir
+	MedaBinary string
+	// MedaHost and MedaPort address the Meda API server
+	MedaHost string
+	MedaPort int
+	// UseAPI selects the API driver instead of the CLI driver
+	UseAPI bool
+	// MedaEnv is added to the environment of meda commands
+	MedaEnv        map[string]string
+	MedaWorkingDir string
+	// NonInteractive fails meda commands that wait for input
+	NonInteractive config.Trilean
+	// Commands replaces the CLI arguments of single operations, by
+	// operation: create, start, stop, ip, create_image and push. Every
+	// argument is a template rendered with CommandData.
+	Commands map[string][]string
+	// MockMode simulates Meda, see NewMockDriver
+	MockMode bool
+	// VMStartTimeout bounds how long StartVM waits for the VM to run
+	VMStartTimeout time.Duration
+	// AuditLogFile, if set, records every change to images and VMs
+	AuditLogFile string
+}
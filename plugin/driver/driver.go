@@ -0,0 +1,405 @@
+// Package driver runs Meda operations through the meda CLI or the Meda
+// REST API, behind the MedaDriver interface.
+package driver
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// ErrVMNotFound is wrapped by DeleteVM errors for VMs that don't exist
+var ErrVMNotFound = fmt.Errorf("VM %w", ErrNotFound)
+
+// MedaDriver abstracts every interaction the builder has with Meda so that
+// steps don't need to know whether the CLI or the REST API is in use
+type MedaDriver interface {
+	// Ping verifies that Meda can be reached
+	Ping() error
+
+	// ImageExists reports whether an image with the given name is available locally
+	ImageExists(name string) (bool, error)
+
+	// ListImages returns the name:tag references of all local images
+	ListImages() ([]string, error)
+
+	// CreateImage creates a fresh image with the given name
+	CreateImage(name string) error
+
+	// CreateImageFromVM captures the disk of a stopped VM as name:tag,
+	// attaching labels to the image
+	CreateImageFromVM(vmName, name, tag string, labels map[string]string) error
+
+	// CreateImageFromSnapshot creates name:tag from a snapshot taken with
+	// SnapshotVM, attaching labels to the image
+	CreateImageFromSnapshot(vmName, snapshot, name, tag string, labels map[string]string) error
+
+	// DeleteImage removes a local image
+	DeleteImage(name string) error
+
+	// InspectImage returns size and layer details of a local name:tag image
+	InspectImage(ref string) (*ImageInfo, error)
+
+	// PushImage pushes a local image to a registry
+	PushImage(opts PushOptions) error
+
+	// ExportImage writes the disk of a local name:tag image to path in the
+	// given format ("raw", "qcow2" or "oci" for an OCI layout tarball)
+	ExportImage(ref, path, format string) error
+
+	// ExportImageStream is ExportImage to a stream instead of a file. A
+	// failed export surfaces as a read error rather than a short stream.
+	ExportImageStream(ref, format string) (io.ReadCloser, error)
+
+	// ImportImage creates the local image name from a disk file written
+	// by ExportImage
+	ImportImage(path, name string) error
+
+	// ImportImageStream creates the image name from a stream written by
+	// ExportImageStream in the "oci" format
+	ImportImageStream(r io.Reader, name string) error
+
+	// ListVMs returns every VM known to Meda
+	ListVMs() ([]VMInfo, error)
+
+	// CreateVM defines a new VM without starting it
+	CreateVM(opts VMOptions) error
+
+	// StartVM boots a previously created VM
+	StartVM(name string) error
+
+	// StopVM shuts a running VM down
+	StopVM(name string) error
+
+	// ResizeVM changes memory and CPU count of a stopped VM
+	ResizeVM(name, memory string, cpus int) error
+
+	// SnapshotVM snapshots the disk of a VM without stopping it
+	SnapshotVM(name, snapshot string) error
+
+	// DeleteSnapshot removes a snapshot taken with SnapshotVM
+	DeleteSnapshot(name, snapshot string) error
+
+	// DeleteVM removes a VM and its disk. It returns an error wrapping
+	// ErrVMNotFound when the VM does not exist.
+	DeleteVM(name string) error
+
+	// GetVMIP returns the VM's IP address, or "" if it has none yet
+	GetVMIP(name string) (string, error)
+
+	// GetVMAddresses returns every IPv4 address meda reports for the VM,
+	// with the interface it belongs to where meda names one
+	GetVMAddresses(name string) ([]VMAddress, error)
+}
+
+// ImageInfo describes a local image as reported by `meda inspect`
+type ImageInfo struct {
+	Digest      string       `json:"digest"`
+	SizeBytes   int64        `json:"size_bytes"`
+	VirtualSize int64        `json:"virtual_size"`
+	CreatedAt   string       `json:"created_at"`
+	Layers      []ImageLayer `json:"layers"`
+	// Labels attached when the image was created
+	Labels map[string]string `json:"labels"`
+}
+
+// ImageLayer is a single layer of an image
+type ImageLayer struct {
+	Digest    string `json:"digest"`
+	SizeBytes int64  `json:"size_bytes"`
+}
+
+// LayerDigests returns the digests of all layers in order
+func (i *ImageInfo) LayerDigests() []string {
+	digests := make([]string, 0, len(i.Layers))
+	for _, l := range i.Layers {
+		digests = append(digests, l.Digest)
+	}
+	return digests
+}
+
+// VMInfo describes a VM as reported by Meda
+type VMInfo struct {
+	Name  string `json:"name"`
+	State string `json:"state"`
+	IP    string `json:"ip"`
+	MAC   string `json:"mac"`
+	Image string `json:"image"`
+}
+
+// VMAddress is one IP address of a VM
+type VMAddress struct {
+	// Interface is the guest interface, e.g. eth1, empty if unknown
+	Interface string
+	IP        string
+}
+
+// VMOptions holds the parameters used to create the build VM
+type VMOptions struct {
+	Name         string
+	BaseImage    string
+	Memory       string
+	CPUs         int
+	DiskSize     string
+	UserDataFile string
+	// Datasource is the cloud-init datasource used to deliver user-data:
+	// "nocloud", "configdrive" or "meda". Empty leaves the choice to meda.
+	Datasource string
+	// IgnitionFile is an Ignition config delivered instead of user-data,
+	// for guests such as Fedora CoreOS and Flatcar
+	IgnitionFile string
+	// MACAddress of the VM's network interface. Empty lets meda pick one.
+	MACAddress string
+	// Volumes are Meda images attached read-only as additional disks
+	Volumes []string
+	// Network is the network mode, "nat" or "isolated". Empty leaves the
+	// choice to meda. NetworkAllow lists what an isolated VM may reach.
+	Network      string
+	NetworkAllow []string
+	// Performance hints; zero values leave the choice to meda
+	Hugepages    bool
+	KSM          bool
+	IOThreads    int
+	VirtioQueues int
+	// CPUAffinity pins the vCPUs to these host CPUs, a cpuset list such
+	// as "0-3,8-11". NUMANode, if set, is the host node memory is
+	// allocated on.
+	CPUAffinity string
+	NUMANode    *int
+	// DiskIOLimitMBps caps the VM's disk throughput in MB/s and CPUShares
+	// is its relative CPU weight on the host; zero leaves them unlimited
+	// and at meda's default
+	DiskIOLimitMBps int
+	CPUShares       int
+	// MemoryBalloon adds a balloon device; MaxMemory, if set, is how far
+	// the VM's memory may grow beyond Memory
+	MemoryBalloon bool
+	MaxMemory     string
+	// SerialSocket, if set, is the unix socket the VM's serial console is
+	// attached to
+	SerialSocket string
+}
+
+// PushOptions holds the parameters used to push an image to a registry
+type PushOptions struct {
+	// ImageName is the local image reference, name:tag
+	ImageName string
+	// Name is the local image name without tag
+	Name        string
+	TargetImage string
+	Registry    string
+	DryRun      bool
+	// Insecure allows plain-HTTP registries and skips TLS verification
+	Insecure bool
+	// CAFile is a PEM bundle used to verify the registry certificate
+	CAFile string
+	// ErrorPatterns and WarningPatterns classify stderr lines of a push
+	// that exited successfully, see pushResultError
+	ErrorPatterns   []*regexp.Regexp
+	WarningPatterns []*regexp.Regexp
+}
+
+// NewDriver returns the driver matching the configured access mode, or a
+// simulated one in mock_mode. Output of long running commands is relayed
+// to ui, which may be nil. With audit_log_file set, changes to images and
+// VMs are recorded there.
+func NewDriver(config *Config, ui packer.Ui) MedaDriver {
+	if config.MockMode {
+		return NewMockDriver()
+	}
+
+	var driver MedaDriver = &CLIDriver{config: config, ui: ui}
+	backend := "cli"
+	if config.UseAPI {
+		driver = &APIDriver{config: config, ui: ui}
+		backend = "api"
+	}
+
+	if config.AuditLogFile != "" {
+		driver = &auditDriver{
+			MedaDriver: driver,
+			log:        &auditLog{path: config.AuditLogFile, backend: backend},
+		}
+	}
+	return driver
+}
+
+// RunStreaming runs cmd while relaying its stdout and stderr line by line to
+// ui. The captured stderr is returned so callers can inspect it.
+func RunStreaming(cmd *exec.Cmd, ui packer.Ui) (string, error) {
+	return runLines(cmd, func(line string) {
+		sayOrLog(ui, line)
+	})
+}
+
+// runLines runs cmd and hands every line of stdout and stderr to handle.
+// Calls to handle are serialized. The captured stderr is returned.
+func runLines(cmd *exec.Cmd, handle func(line string)) (string, error) {
+	return runLinesTee(cmd, handle, nil)
+}
+
+// runLinesTee is runLines with the raw output also copied to tee, if set
+func runLinesTee(cmd *exec.Cmd, handle func(line string), tee io.Writer) (string, error) {
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return "", err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return "", err
+	}
+
+	finished := LogCommand(cmd)
+	if err := cmd.Start(); err != nil {
+		finished(err)
+		return "", fmt.Errorf("failed to start command: %s", err)
+	}
+
+	var mu sync.Mutex
+	var stderrOutput strings.Builder
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	relay := func(r io.Reader, capture *strings.Builder) {
+		defer wg.Done()
+		if tee != nil {
+			r = io.TeeReader(r, tee)
+		}
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			line := scanner.Text()
+			mu.Lock()
+			if capture != nil {
+				capture.WriteString(line + "\n")
+			}
+			handle(line)
+			mu.Unlock()
+		}
+	}
+	go relay(stdout, nil)
+	go relay(stderr, &stderrOutput)
+
+	// Pipes must be fully read before Wait closes them
+	wg.Wait()
+	err = cmd.Wait()
+	finished(err)
+
+	return stderrOutput.String(), err
+}
+
+// sayOrLog shows a line in the UI, or in the Packer log when there is no UI
+func sayOrLog(ui packer.Ui, line string) {
+	if ui != nil {
+		ui.Say(line)
+	} else {
+		log.Print(line)
+	}
+}
+
+// parseIP extracts the first IPv4 address from meda output, which may be
+// interleaved with cargo build information
+func parseIP(output string) string {
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.Count(line, ".") != 3 || strings.Contains(line, " ") {
+			continue
+		}
+		valid := true
+		for _, part := range strings.Split(line, ".") {
+			if _, err := strconv.Atoi(part); err != nil {
+				valid = false
+				break
+			}
+		}
+		if valid {
+			return line
+		}
+	}
+	return ""
+}
+
+// vmAddressPattern matches an IPv4 address in meda output, optionally
+// preceded by the interface it belongs to, as in "eth1: 10.0.0.5",
+// "eth1 10.0.0.5" or "\"eth1\": \"10.0.0.5\""
+var vmAddressPattern = regexp.MustCompile(`(?:([A-Za-z][\w.@-]*)"?\s*[:=]?\s*"?)?\b(\d{1,3}(?:\.\d{1,3}){3})\b`)
+
+// parseVMAddresses extracts every IPv4 address from `meda ip` output or
+// the API response, in the order they appear
+func parseVMAddresses(output string) []VMAddress {
+	var addrs []VMAddress
+	for _, m := range vmAddressPattern.FindAllStringSubmatch(output, -1) {
+		if net.ParseIP(m[2]) == nil {
+			continue
+		}
+		addrs = append(addrs, VMAddress{Interface: m[1], IP: m[2]})
+	}
+	return addrs
+}
+
+// DefaultPushErrorPatterns match stderr lines that mean a push failed even
+// though the command exited successfully
+var DefaultPushErrorPatterns = []string{
+	"unauthorized",
+	"denied",
+	"authentication required",
+}
+
+// CompilePatterns compiles a list of regular expressions
+func CompilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %s", p, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// matchesAny reports whether line matches one of patterns
+func matchesAny(patterns []*regexp.Regexp, line string) bool {
+	for _, re := range patterns {
+		if re.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
+
+// pushResultError inspects the outcome of a push command. The exit status
+// is evaluated first: a failed command is always an error. Registries
+// sometimes report authentication failures on stderr with a zero exit
+// status, so stderr lines are then checked. Lines matching a warning
+// pattern are shown as warnings and never fail the push; otherwise a line
+// matching an error pattern does.
+func pushResultError(ui packer.Ui, opts PushOptions, stderr string, err error) error {
+	if err != nil {
+		return cliError(err, stderr)
+	}
+
+	var errLines []string
+	for _, line := range strings.Split(stderr, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "":
+		case matchesAny(opts.WarningPatterns, line):
+			sayOrLog(ui, "Warning: "+line)
+		case matchesAny(opts.ErrorPatterns, line):
+			errLines = append(errLines, line)
+		}
+	}
+	if len(errLines) > 0 {
+		return fmt.Errorf("push failed - %s", strings.Join(errLines, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,457 @@
+package driver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// APIDriver talks to a Meda REST API server started with `meda serve`
+type APIDriver struct {
+	config *Config
+	ui     packer.Ui
+}
+
+// NewAPIDriver returns a driver for the API server config points at. Output
+// of long running requests is relayed to ui, which may be nil.
+func NewAPIDriver(config *Config, ui packer.Ui) *APIDriver {
+	return &APIDriver{config: config, ui: ui}
+}
+
+// url returns the absolute URL of an API endpoint
+func (d *APIDriver) url(path string) string {
+	return fmt.Sprintf("http://%s:%d/api/v1/%s", d.config.MedaHost, d.config.MedaPort, path)
+}
+
+// APIError is returned for responses with a non-2xx status
+type APIError struct {
+	Method     string
+	Path       string
+	StatusCode int
+	Body       string
+	// RetryAfter is the Retry-After header of the response, if any
+	RetryAfter string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s %s: %d %s - %s", e.Method, e.Path, e.StatusCode,
+		http.StatusText(e.StatusCode), strings.TrimSpace(e.Body))
+}
+
+// Do performs an API request and returns the response body. Responses
+// with a non-2xx status are returned as *APIError, wrapped in a medaError
+// when the status is one of apiErrorKinds.
+func (d *APIDriver) Do(method, path, body string) (string, error) {
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	req, err := http.NewRequest(method, d.url(path), reader)
+	if err != nil {
+		return "", err
+	}
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	started := time.Now()
+	if commandLogEnabled() {
+		log.Print(packer.LogSecretFilter.FilterString(fmt.Sprintf("API request: %s %s %s", method, req.URL, body)))
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if commandLogEnabled() {
+		log.Printf("API response: %s %s: %s (%s)", method, path, resp.Status, time.Since(started).Round(time.Millisecond))
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read response of %s %s: %s", method, path, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return string(data), classifyAPIError(&APIError{Method: method, Path: path, StatusCode: resp.StatusCode, Body: string(data),
+			RetryAfter: resp.Header.Get("Retry-After")})
+	}
+	return string(data), nil
+}
+
+// doJSON performs an API request with body encoded as JSON
+func (d *APIDriver) doJSON(method, path string, body interface{}) (string, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode request for %s %s: %s", method, path, err)
+	}
+	return d.Do(method, path, string(data))
+}
+
+// imageRequest is the body of POST images
+type imageRequest struct {
+	Name         string            `json:"name"`
+	Tag          string            `json:"tag"`
+	FromVM       string            `json:"from_vm,omitempty"`
+	FromSnapshot string            `json:"from_snapshot,omitempty"`
+	Labels       map[string]string `json:"labels,omitempty"`
+}
+
+func (d *APIDriver) Ping() error {
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get(d.url("vms"))
+	if err != nil {
+		return fmt.Errorf("Meda API at %s:%d is unreachable (%s); start it with `meda serve --port %d`",
+			d.config.MedaHost, d.config.MedaPort, err, d.config.MedaPort)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// ImageExists compares name with the name and tag of every listed image
+// like the CLI driver does; matching the raw response would take
+// "ubuntu" for present when only "ubuntu-minimal" is
+func (d *APIDriver) ImageExists(name string) (bool, error) {
+	refs, err := d.ListImages()
+	if err != nil {
+		return false, err
+	}
+	return imageListed(refs, name), nil
+}
+
+func (d *APIDriver) ListImages() ([]string, error) {
+	output, err := d.Do("GET", "images", "")
+	if err != nil {
+		return nil, err
+	}
+	refs, ok := parseImagesJSON(output)
+	if !ok {
+		return nil, fmt.Errorf("unrecognized image list: %s", lastLine(output))
+	}
+	return refs, nil
+}
+
+func (d *APIDriver) CreateImage(name string) error {
+	_, err := d.doJSON("POST", "images", imageRequest{Name: name, Tag: "latest"})
+	return err
+}
+
+func (d *APIDriver) CreateImageFromVM(vmName, name, tag string, labels map[string]string) error {
+	_, err := d.doJSON("POST", "images", imageRequest{Name: name, Tag: tag, FromVM: vmName, Labels: labels})
+	return err
+}
+
+func (d *APIDriver) CreateImageFromSnapshot(vmName, snapshot, name, tag string, labels map[string]string) error {
+	_, err := d.doJSON("POST", "images", imageRequest{Name: name, Tag: tag, FromVM: vmName, FromSnapshot: snapshot, Labels: labels})
+	return err
+}
+
+func (d *APIDriver) DeleteImage(name string) error {
+	_, err := d.Do("DELETE", "images/"+name, "")
+	return err
+}
+
+func (d *APIDriver) InspectImage(ref string) (*ImageInfo, error) {
+	output, err := d.Do("GET", "images/"+url.PathEscape(ref), "")
+	if err != nil {
+		return nil, err
+	}
+
+	var info ImageInfo
+	if err := json.Unmarshal([]byte(output), &info); err != nil {
+		return nil, fmt.Errorf("failed to parse image details: %s", err)
+	}
+	return &info, nil
+}
+
+func (d *APIDriver) PushImage(opts PushOptions) error {
+	// The HTTP status is evaluated first, a failure comes back as *APIError
+	output, err := d.doJSON("POST", "images/push", struct {
+		Name     string `json:"name"`
+		Image    string `json:"image"`
+		Registry string `json:"registry"`
+		DryRun   bool   `json:"dry_run"`
+		Insecure bool   `json:"insecure"`
+		CAFile   string `json:"ca_file"`
+	}{opts.ImageName, opts.TargetImage, opts.Registry, opts.DryRun, opts.Insecure, opts.CAFile})
+	if err != nil {
+		return err
+	}
+	// A successful response can still report a failed push in its body
+	return pushResultError(d.ui, opts, output, nil)
+}
+
+// ExportImage asks the server to write the image to path, which therefore
+// has to be on the host running `meda serve`
+func (d *APIDriver) ExportImage(ref, path, format string) error {
+	_, err := d.doJSON("POST", "images/"+url.PathEscape(ref)+"/export", struct {
+		Path   string `json:"path"`
+		Format string `json:"format"`
+	}{path, format})
+	return err
+}
+
+// ExportImageStream downloads the exported image from the server
+func (d *APIDriver) ExportImageStream(ref, format string) (io.ReadCloser, error) {
+	path := "images/" + url.PathEscape(ref) + "/export?format=" + url.QueryEscape(format)
+	if commandLogEnabled() {
+		log.Printf("API request: GET %s", d.url(path))
+	}
+	resp, err := http.Get(d.url(path))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		return nil, classifyAPIError(&APIError{Method: "GET", Path: path, StatusCode: resp.StatusCode, Body: string(data),
+			RetryAfter: resp.Header.Get("Retry-After")})
+	}
+	return resp.Body, nil
+}
+
+// ImportImageStream uploads an image written by ExportImageStream in the
+// "oci" format and creates the image name from it. Unlike ImportImage, it
+// works against a server on another host.
+func (d *APIDriver) ImportImageStream(r io.Reader, name string) error {
+	path := "images/import?name=" + url.QueryEscape(name)
+	req, err := http.NewRequest("POST", d.url(path), r)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-tar")
+
+	started := time.Now()
+	if commandLogEnabled() {
+		log.Printf("API request: POST %s <image stream>", req.URL)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if commandLogEnabled() {
+		log.Printf("API response: POST %s: %s (%s)", path, resp.Status, time.Since(started).Round(time.Millisecond))
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		data, _ := io.ReadAll(resp.Body)
+		return classifyAPIError(&APIError{Method: "POST", Path: path, StatusCode: resp.StatusCode, Body: string(data),
+			RetryAfter: resp.Header.Get("Retry-After")})
+	}
+	return nil
+}
+
+// ImportImage asks the server to read the disk at path, which therefore
+// has to be on the host running `meda serve`
+func (d *APIDriver) ImportImage(path, name string) error {
+	_, err := d.doJSON("POST", "images/import", struct {
+		Path string `json:"path"`
+		Name string `json:"name"`
+	}{path, name})
+	return err
+}
+
+func (d *APIDriver) ListVMs() ([]VMInfo, error) {
+	output, err := d.Do("GET", "vms", "")
+	if err != nil {
+		return nil, err
+	}
+
+	var vms []VMInfo
+	if err := json.Unmarshal([]byte(output), &vms); err != nil {
+		return nil, fmt.Errorf("failed to parse VM list: %s", err)
+	}
+	return vms, nil
+}
+
+// vmRequest is the body of POST vms
+type vmRequest struct {
+	Name                string          `json:"name"`
+	BaseImage           string          `json:"base_image"`
+	Memory              string          `json:"memory"`
+	CPUs                int             `json:"cpus"`
+	Disk                string          `json:"disk"`
+	CloudInitDatasource string          `json:"cloud_init_datasource"`
+	MACAddress          string          `json:"mac_address"`
+	Volumes             []vmVolume      `json:"volumes"`
+	Network             string          `json:"network"`
+	NetworkAllow        []string        `json:"network_allow"`
+	Ignition            json.RawMessage `json:"ignition"`
+	Hugepages           bool            `json:"hugepages"`
+	KSM                 bool            `json:"ksm"`
+	IOThreads           int             `json:"io_threads"`
+	VirtioQueues        int             `json:"virtio_queues"`
+	CPUAffinity         string          `json:"cpu_affinity"`
+	NUMANode            *int            `json:"numa_node"`
+	DiskIOLimitMBps     int             `json:"disk_io_limit_mbps"`
+	CPUShares           int             `json:"cpu_shares"`
+	MemoryBalloon       bool            `json:"memory_balloon"`
+	MaxMemory           string          `json:"max_memory"`
+	SerialSocket        string          `json:"serial_socket"`
+	Force               bool            `json:"force"`
+}
+
+// vmVolume is an image attached to a VM
+type vmVolume struct {
+	Image    string `json:"image"`
+	ReadOnly bool   `json:"readonly"`
+}
+
+func (d *APIDriver) CreateVM(opts VMOptions) error {
+	volumes := make([]vmVolume, 0, len(opts.Volumes))
+	for _, v := range opts.Volumes {
+		volumes = append(volumes, vmVolume{Image: v, ReadOnly: true})
+	}
+
+	// The Ignition config is generated on this host, so it is sent inline
+	ignition := json.RawMessage("null")
+	if opts.IgnitionFile != "" {
+		data, err := os.ReadFile(opts.IgnitionFile)
+		if err != nil {
+			return fmt.Errorf("failed to read ignition config: %s", err)
+		}
+		if !json.Valid(data) {
+			return fmt.Errorf("ignition config %s is not valid JSON", opts.IgnitionFile)
+		}
+		ignition = data
+	}
+
+	_, err := d.doJSON("POST", "vms", vmRequest{
+		Name:                opts.Name,
+		BaseImage:           opts.BaseImage,
+		Memory:              opts.Memory,
+		CPUs:                opts.CPUs,
+		Disk:                opts.DiskSize,
+		CloudInitDatasource: opts.Datasource,
+		MACAddress:          opts.MACAddress,
+		Volumes:             volumes,
+		Network:             opts.Network,
+		NetworkAllow:        append([]string{}, opts.NetworkAllow...),
+		Ignition:            ignition,
+		Hugepages:           opts.Hugepages,
+		KSM:                 opts.KSM,
+		IOThreads:           opts.IOThreads,
+		VirtioQueues:        opts.VirtioQueues,
+		CPUAffinity:         opts.CPUAffinity,
+		NUMANode:            opts.NUMANode,
+		DiskIOLimitMBps:     opts.DiskIOLimitMBps,
+		CPUShares:           opts.CPUShares,
+		MemoryBalloon:       opts.MemoryBalloon,
+		MaxMemory:           opts.MaxMemory,
+		SerialSocket:        opts.SerialSocket,
+	})
+	return err
+}
+
+// vmStatus is the VM state reported by GET vms/<name>
+type vmStatus struct {
+	Status string `json:"status"`
+	State  string `json:"state"`
+	Error  string `json:"error"`
+	Reason string `json:"reason"`
+}
+
+// vmStatusPollInterval is how often StartVM checks whether the VM runs
+const vmStatusPollInterval = 2 * time.Second
+
+// StartVM starts the VM and waits until the API reports it running. A
+// successful start request only means Meda accepted it, the VM can still
+// fail to boot, e.g. for lack of memory.
+func (d *APIDriver) StartVM(name string) error {
+	if _, err := d.Do("POST", "vms/"+name+"/start", ""); err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(d.config.VMStartTimeout)
+	last := ""
+	for {
+		output, err := d.Do("GET", "vms/"+name, "")
+		if err != nil {
+			return fmt.Errorf("failed to get VM status: %s", err)
+		}
+		var status vmStatus
+		if err := json.Unmarshal([]byte(output), &status); err != nil {
+			return fmt.Errorf("failed to parse VM status: %s", err)
+		}
+		state := strings.ToLower(status.Status)
+		if state == "" {
+			state = strings.ToLower(status.State)
+		}
+
+		switch state {
+		case "running":
+			return nil
+		case "failed", "error", "stopped", "crashed":
+			reason := status.Error
+			if reason == "" {
+				reason = status.Reason
+			}
+			if reason == "" {
+				reason = "no reason given"
+			}
+			return fmt.Errorf("VM '%s' is %s instead of running: %s", name, state, reason)
+		}
+
+		if state != last {
+			log.Printf("VM %s is %s, waiting for it to run", name, state)
+			last = state
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("VM '%s' did not reach running state within %s (last state: %s)", name, d.config.VMStartTimeout, state)
+		}
+		time.Sleep(vmStatusPollInterval)
+	}
+}
+
+func (d *APIDriver) StopVM(name string) error {
+	_, err := d.Do("POST", "vms/"+name+"/stop", "")
+	return err
+}
+
+func (d *APIDriver) ResizeVM(name, memory string, cpus int) error {
+	_, err := d.doJSON("PATCH", "vms/"+name, struct {
+		Memory string `json:"memory"`
+		CPUs   int    `json:"cpus"`
+	}{memory, cpus})
+	return err
+}
+
+func (d *APIDriver) SnapshotVM(name, snapshot string) error {
+	_, err := d.doJSON("POST", "vms/"+name+"/snapshots", struct {
+		Name string `json:"name"`
+	}{snapshot})
+	return err
+}
+
+func (d *APIDriver) DeleteSnapshot(name, snapshot string) error {
+	_, err := d.Do("DELETE", "vms/"+name+"/snapshots/"+snapshot, "")
+	return err
+}
+
+func (d *APIDriver) DeleteVM(name string) error {
+	_, err := d.Do("DELETE", "vms/"+name, "")
+	return refineKind(err, ErrVMNotFound)
+}
+
+func (d *APIDriver) GetVMIP(name string) (string, error) {
+	output, err := d.Do("GET", "vms/"+name+"/ip", "")
+	if err != nil {
+		return "", err
+	}
+	return parseIP(output), nil
+}
+
+func (d *APIDriver) GetVMAddresses(name string) ([]VMAddress, error) {
+	output, err := d.Do("GET", "vms/"+name+"/ip", "")
+	if err != nil {
+		return nil, err
+	}
+	return parseVMAddresses(output), nil
+}
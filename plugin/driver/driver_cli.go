@@ -0,0 +1,591 @@
+package driver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// CLIDriver talks to Meda by invoking the meda binary, or `cargo run` from
+// the meda source directory during development
+type CLIDriver struct {
+	config *Config
+	ui     packer.Ui
+
+	// formatMu guards the detected output formats below
+	formatMu sync.Mutex
+	version  string
+	formats  []medaOutputFormat
+}
+
+// outputFormats returns the meda version and the output formats to try
+// for it, running `meda --version` on first use
+func (d *CLIDriver) outputFormats() (string, []medaOutputFormat) {
+	d.formatMu.Lock()
+	defer d.formatMu.Unlock()
+	if d.formats == nil {
+		d.version = "unknown"
+		output, err := d.run("--version")
+		v, known := parseMedaVersion(output)
+		if err == nil && known {
+			d.version = v.String()
+		} else {
+			log.Printf("[WARN] Could not detect meda version, trying all output formats: %s", lastLine(output))
+		}
+		d.formats = medaOutputFormatsFor(v, err == nil && known)
+	}
+	return d.version, d.formats
+}
+
+// preferFormat moves f to the front of the formats to try, once it has
+// been found to match this meda's output
+func (d *CLIDriver) preferFormat(f medaOutputFormat) {
+	d.formatMu.Lock()
+	defer d.formatMu.Unlock()
+	formats := []medaOutputFormat{f}
+	for _, other := range d.formats {
+		if other.since != f.since {
+			formats = append(formats, other)
+		}
+	}
+	d.formats = formats
+}
+
+// MedaCommand builds the exec.Cmd for a meda subcommand, applying the
+// configured working directory and environment
+func MedaCommand(config *Config, args ...string) (*exec.Cmd, error) {
+	var cmd *exec.Cmd
+	if config.MedaBinary == "cargo" {
+		medaDir := config.MedaWorkingDir
+		if medaDir == "" {
+			var err error
+			if medaDir, err = getMedaDir(); err != nil {
+				return nil, fmt.Errorf("failed to get meda directory: %s", err)
+			}
+		}
+		cmd = exec.Command("cargo", append([]string{"run", "--"}, args...)...)
+		cmd.Dir = medaDir
+	} else {
+		cmd = exec.Command(config.MedaBinary, args...)
+		cmd.Dir = config.MedaWorkingDir
+	}
+
+	if len(config.MedaEnv) > 0 || config.NonInteractive.True() {
+		cmd.Env = os.Environ()
+		for k, v := range config.MedaEnv {
+			cmd.Env = append(cmd.Env, k+"="+v)
+		}
+	}
+	if config.NonInteractive.True() {
+		// Nothing can answer a prompt, make that explicit to meda
+		cmd.Stdin = nil
+		cmd.Env = append(cmd.Env, "MEDA_NON_INTERACTIVE=1", "TERM=dumb")
+	}
+	return cmd, nil
+}
+
+func (d *CLIDriver) command(args ...string) (*exec.Cmd, error) {
+	return MedaCommand(d.config, args...)
+}
+
+// run executes a meda subcommand and returns its combined output
+func (d *CLIDriver) run(args ...string) (string, error) {
+	cmd, err := d.command(args...)
+	if err != nil {
+		return "", err
+	}
+
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	var watcher *promptWatcher
+	if d.config.NonInteractive.True() {
+		watcher = newPromptWatcher(cmd)
+		cmd.Stdout = io.MultiWriter(&output, watcher)
+	}
+	cmd.Stderr = cmd.Stdout
+
+	finished := LogCommand(cmd)
+	err = cmd.Run()
+	finished(err)
+	if watcher != nil {
+		watcher.Stop()
+		if perr := watcher.Err(); perr != nil {
+			err = perr
+		}
+	}
+	if err != nil {
+		return output.String(), cliError(err, output.String())
+	}
+	return output.String(), nil
+}
+
+// runLines runs a meda command line by line, see runLines. In
+// non-interactive mode the command is killed when it waits at a prompt.
+func (d *CLIDriver) runLines(cmd *exec.Cmd, handle func(line string)) (string, error) {
+	if !d.config.NonInteractive.True() {
+		return runLines(cmd, handle)
+	}
+
+	watcher := newPromptWatcher(cmd)
+	stderr, err := runLinesTee(cmd, handle, watcher)
+	watcher.Stop()
+	if perr := watcher.Err(); perr != nil {
+		return stderr, perr
+	}
+	return stderr, err
+}
+
+// runStreaming runs a meda command relaying its output to the UI
+func (d *CLIDriver) runStreaming(cmd *exec.Cmd) (string, error) {
+	return d.runLines(cmd, func(line string) {
+		sayOrLog(d.ui, line)
+	})
+}
+
+func (d *CLIDriver) Ping() error {
+	if d.config.MedaBinary == "cargo" {
+		if _, err := getMedaDir(); err != nil {
+			return err
+		}
+	}
+	if _, err := exec.LookPath(d.config.MedaBinary); err != nil {
+		return fmt.Errorf("meda binary not found: %s", d.config.MedaBinary)
+	}
+	return nil
+}
+
+func (d *CLIDriver) ImageExists(name string) (bool, error) {
+	refs, err := d.ListImages()
+	if err != nil {
+		return false, err
+	}
+	return imageListed(refs, name), nil
+}
+
+func (d *CLIDriver) ListImages() ([]string, error) {
+	version, formats := d.outputFormats()
+	var lastErr error
+	for i, f := range formats {
+		output, err := d.run(f.imagesArgs...)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if refs, ok := f.images(output); ok {
+			if i > 0 {
+				d.preferFormat(f)
+			}
+			return refs, nil
+		}
+		lastErr = fmt.Errorf("unrecognized output of `meda %s` from meda %s: %s",
+			strings.Join(f.imagesArgs, " "), version, lastLine(output))
+	}
+	return nil, lastErr
+}
+
+func (d *CLIDriver) CreateImage(name string) error {
+	cmd, err := d.command("create-image", name)
+	if err != nil {
+		return err
+	}
+
+	// Creating a fresh image downloads the distribution cloud image
+	progress := newProgressReporter(d.ui, "Creating image '"+name+"'")
+	stderr, err := d.runLines(cmd, progress.Line)
+	if err != nil {
+		return cliError(err, stderr)
+	}
+	progress.Done()
+	return nil
+}
+
+func (d *CLIDriver) CreateImageFromVM(vmName, name, tag string, labels map[string]string) error {
+	return d.createImage(CommandData{Name: vmName, Image: name, Tag: tag}, labels,
+		"create-image", name, "--tag", tag, "--from-vm", vmName)
+}
+
+func (d *CLIDriver) CreateImageFromSnapshot(vmName, snapshot, name, tag string, labels map[string]string) error {
+	return d.createImage(CommandData{Name: vmName, Image: name, Tag: tag, Snapshot: snapshot}, labels,
+		"create-image", name, "--tag", tag, "--from-vm", vmName, "--snapshot", snapshot)
+}
+
+// createImage runs a create-image command with labels, reporting progress
+func (d *CLIDriver) createImage(data CommandData, labels map[string]string, args ...string) error {
+	for _, k := range slices.Sorted(maps.Keys(labels)) {
+		args = append(args, "--label", k+"="+labels[k])
+	}
+	args, err := d.commandArgs("create_image", data, args)
+	if err != nil {
+		return err
+	}
+
+	cmd, err := d.command(args...)
+	if err != nil {
+		return err
+	}
+
+	progress := newProgressReporter(d.ui, "Creating image")
+	stderr, err := d.runLines(cmd, progress.Line)
+	if err != nil {
+		return cliError(err, stderr)
+	}
+	progress.Done()
+	return nil
+}
+
+func (d *CLIDriver) DeleteImage(name string) error {
+	_, err := d.run("images", "rm", name)
+	return err
+}
+
+func (d *CLIDriver) InspectImage(ref string) (*ImageInfo, error) {
+	cmd, err := d.command("inspect", ref, "--json")
+	if err != nil {
+		return nil, err
+	}
+	finished := LogCommand(cmd)
+	output, err := cmd.Output()
+	finished(err)
+	if err != nil {
+		return nil, err
+	}
+
+	var info ImageInfo
+	if err := json.Unmarshal(output, &info); err != nil {
+		return nil, fmt.Errorf("failed to parse image details: %s", err)
+	}
+	return &info, nil
+}
+
+func (d *CLIDriver) PushImage(opts PushOptions) error {
+	// Meda expects just the image name without tag
+	args := []string{"push", opts.Name, opts.TargetImage}
+	if opts.Registry != "" && opts.Registry != "ghcr.io" {
+		args = append(args, "--registry", opts.Registry)
+	}
+	if opts.DryRun {
+		args = append(args, "--dry-run")
+	}
+	if opts.Insecure {
+		args = append(args, "--insecure")
+	}
+	if opts.CAFile != "" {
+		args = append(args, "--ca-file", opts.CAFile)
+	}
+	args, err := d.commandArgs("push", CommandData{Image: opts.Name, Target: opts.TargetImage, Registry: opts.Registry}, args)
+	if err != nil {
+		return err
+	}
+
+	cmd, err := d.command(args...)
+	if err != nil {
+		return err
+	}
+	stderr, err := d.runStreaming(cmd)
+	return pushResultError(d.ui, opts, stderr, err)
+}
+
+func (d *CLIDriver) ExportImage(ref, path, format string) error {
+	cmd, err := d.command("export", ref, "--output", path, "--format", format)
+	if err != nil {
+		return err
+	}
+
+	progress := newProgressReporter(d.ui, "Exporting image")
+	stderr, err := d.runLines(cmd, progress.Line)
+	if err != nil {
+		return cliError(err, stderr)
+	}
+	return nil
+}
+
+func (d *CLIDriver) ExportImageStream(ref, format string) (io.ReadCloser, error) {
+	cmd, err := d.command("export", ref, "--output", "-", "--format", format)
+	if err != nil {
+		return nil, err
+	}
+
+	stream := &commandStream{cmd: cmd}
+	cmd.Stderr = &stream.stderr
+	stream.stdout, err = cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stream.finished = LogCommand(cmd)
+	if err := cmd.Start(); err != nil {
+		stream.finished(err)
+		return nil, err
+	}
+	return stream, nil
+}
+
+// commandStream is the stdout of a running meda command. The end of the
+// stream reports the exit status of the command.
+type commandStream struct {
+	cmd      *exec.Cmd
+	stdout   io.ReadCloser
+	stderr   bytes.Buffer
+	finished func(err error)
+	waited   bool
+	err      error
+}
+
+// wait waits for the command once and keeps its error
+func (s *commandStream) wait() error {
+	if !s.waited {
+		s.waited = true
+		s.err = s.cmd.Wait()
+		s.finished(s.err)
+		if s.err != nil {
+			s.err = cliError(s.err, s.stderr.String())
+		}
+	}
+	return s.err
+}
+
+func (s *commandStream) Read(p []byte) (int, error) {
+	n, err := s.stdout.Read(p)
+	if err == io.EOF {
+		if werr := s.wait(); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+// Close stops reading, which ends a command that is still writing
+func (s *commandStream) Close() error {
+	s.stdout.Close()
+	return s.wait()
+}
+
+func (d *CLIDriver) ImportImage(path, name string) error {
+	cmd, err := d.command("import", path, "--name", name)
+	if err != nil {
+		return err
+	}
+
+	progress := newProgressReporter(d.ui, "Importing image")
+	stderr, err := d.runLines(cmd, progress.Line)
+	if err != nil {
+		return cliError(err, stderr)
+	}
+	return nil
+}
+
+func (d *CLIDriver) ImportImageStream(r io.Reader, name string) error {
+	cmd, err := d.command("import", "-", "--name", name)
+	if err != nil {
+		return err
+	}
+	cmd.Stdin = r
+
+	progress := newProgressReporter(d.ui, "Importing image")
+	stderr, err := d.runLines(cmd, progress.Line)
+	if err != nil {
+		return cliError(err, stderr)
+	}
+	return nil
+}
+
+func (d *CLIDriver) ListVMs() ([]VMInfo, error) {
+	cmd, err := d.command("list", "--json")
+	if err != nil {
+		return nil, err
+	}
+	finished := LogCommand(cmd)
+	output, err := cmd.Output()
+	finished(err)
+	if err != nil {
+		return nil, err
+	}
+
+	var vms []VMInfo
+	if err := json.Unmarshal(output, &vms); err != nil {
+		return nil, fmt.Errorf("failed to parse VM list: %s", err)
+	}
+	return vms, nil
+}
+
+func (d *CLIDriver) CreateVM(opts VMOptions) error {
+	args := []string{"run", opts.BaseImage, "--name", opts.Name,
+		"--memory", opts.Memory,
+		"--cpus", fmt.Sprintf("%d", opts.CPUs),
+		"--disk", opts.DiskSize,
+		"--no-start"}
+
+	if opts.UserDataFile != "" {
+		args = append(args, "--user-data", opts.UserDataFile)
+	}
+	if opts.Datasource != "" {
+		args = append(args, "--cloud-init-datasource", opts.Datasource)
+	}
+	if opts.IgnitionFile != "" {
+		args = append(args, "--ignition", opts.IgnitionFile)
+	}
+	if opts.MACAddress != "" {
+		args = append(args, "--mac", opts.MACAddress)
+	}
+	for _, volume := range opts.Volumes {
+		args = append(args, "--volume", volume+",ro")
+	}
+	if opts.Network != "" {
+		args = append(args, "--network", opts.Network)
+	}
+	for _, allow := range opts.NetworkAllow {
+		args = append(args, "--allow", allow)
+	}
+	if opts.Hugepages {
+		args = append(args, "--hugepages")
+	}
+	if opts.KSM {
+		args = append(args, "--ksm")
+	}
+	if opts.IOThreads > 0 {
+		args = append(args, "--io-threads", fmt.Sprintf("%d", opts.IOThreads))
+	}
+	if opts.VirtioQueues > 0 {
+		args = append(args, "--virtio-queues", fmt.Sprintf("%d", opts.VirtioQueues))
+	}
+	if opts.CPUAffinity != "" {
+		args = append(args, "--cpu-affinity", opts.CPUAffinity)
+	}
+	if opts.NUMANode != nil {
+		args = append(args, "--numa-node", fmt.Sprintf("%d", *opts.NUMANode))
+	}
+	if opts.DiskIOLimitMBps > 0 {
+		args = append(args, "--disk-io-limit", fmt.Sprintf("%dM", opts.DiskIOLimitMBps))
+	}
+	if opts.CPUShares > 0 {
+		args = append(args, "--cpu-shares", fmt.Sprintf("%d", opts.CPUShares))
+	}
+	if opts.MemoryBalloon {
+		args = append(args, "--balloon")
+	}
+	if opts.MaxMemory != "" {
+		args = append(args, "--max-memory", opts.MaxMemory)
+	}
+	if opts.SerialSocket != "" {
+		args = append(args, "--serial-socket", opts.SerialSocket)
+	}
+	args, err := d.commandArgs("create", CommandData{
+		Name:         opts.Name,
+		BaseImage:    opts.BaseImage,
+		Memory:       opts.Memory,
+		CPUs:         opts.CPUs,
+		DiskSize:     opts.DiskSize,
+		UserDataFile: opts.UserDataFile,
+	}, args)
+	if err != nil {
+		return err
+	}
+
+	cmd, err := d.command(args...)
+	if err != nil {
+		return err
+	}
+
+	// meda pulls a missing base image first. Its progress goes to the UI,
+	// the output is kept to tell failures apart.
+	var output bytes.Buffer
+	_, err = d.runLines(cmd, func(line string) {
+		output.WriteString(line + "\n")
+		sayOrLog(d.ui, line)
+	})
+	return cliError(err, output.String())
+}
+
+func (d *CLIDriver) StartVM(name string) error {
+	args, err := d.commandArgs("start", CommandData{Name: name}, []string{"start", name})
+	if err != nil {
+		return err
+	}
+	_, err = d.run(args...)
+	return err
+}
+
+func (d *CLIDriver) StopVM(name string) error {
+	args, err := d.commandArgs("stop", CommandData{Name: name}, []string{"stop", name})
+	if err != nil {
+		return err
+	}
+	_, err = d.run(args...)
+	return err
+}
+
+func (d *CLIDriver) ResizeVM(name, memory string, cpus int) error {
+	_, err := d.run("resize", name, "--memory", memory, "--cpus", fmt.Sprintf("%d", cpus))
+	return err
+}
+
+func (d *CLIDriver) SnapshotVM(name, snapshot string) error {
+	_, err := d.run("snapshot", "create", name, snapshot)
+	return err
+}
+
+func (d *CLIDriver) DeleteSnapshot(name, snapshot string) error {
+	_, err := d.run("snapshot", "rm", name, snapshot)
+	return err
+}
+
+func (d *CLIDriver) DeleteVM(name string) error {
+	args := []string{"delete", name}
+	if d.config.NonInteractive.True() {
+		args = append(args, "--force")
+	}
+	_, err := d.run(args...)
+	return refineKind(err, ErrVMNotFound)
+}
+
+// runIP runs `meda ip` for the VM
+func (d *CLIDriver) runIP(name string) (string, error) {
+	args, err := d.commandArgs("ip", CommandData{Name: name}, []string{"ip", name})
+	if err != nil {
+		return "", err
+	}
+	return d.run(args...)
+}
+
+func (d *CLIDriver) GetVMIP(name string) (string, error) {
+	output, err := d.runIP(name)
+	if err != nil {
+		return "", err
+	}
+	version, formats := d.outputFormats()
+	for _, f := range formats {
+		if ip, ok := f.ip(output); ok {
+			return ip, nil
+		}
+	}
+	log.Printf("[WARN] Unrecognized output of `meda ip` from meda %s: %s", version, lastLine(output))
+	return "", nil
+}
+
+func (d *CLIDriver) GetVMAddresses(name string) ([]VMAddress, error) {
+	output, err := d.runIP(name)
+	if err != nil {
+		return nil, err
+	}
+	return parseVMAddresses(output), nil
+}
+
+// getMedaDir returns the dynamic path to the meda directory
+func getMedaDir() (string, error) {
+	currentUser, err := user.Current()
+	if err != nil {
+		return "", fmt.Errorf("failed to get current user: %v", err)
+	}
+	return filepath.Join(currentUser.HomeDir, "meda"), nil
+}
@@ -0,0 +1,58 @@
+package driver
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fakeMeda writes a meda executable running script and returns a CLI
+// driver using it
+func fakeMeda(t *testing.T, script string) *CLIDriver {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "meda")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return &CLIDriver{config: &Config{MedaBinary: path}}
+}
+
+func TestCLIDriverCreateVM_errorKinds(t *testing.T) {
+	tests := map[string]struct {
+		script string
+		kind   error
+	}{
+		"missing base image": {
+			"echo 'Pulling ubuntu:99.04'; echo 'Error: manifest unknown' >&2; exit 1",
+			ErrNotFound,
+		},
+		"rejected credentials": {
+			"echo 'Error: 401 Unauthorized' >&2; exit 1",
+			ErrAuth,
+		},
+		"rate limited on stdout": {
+			"echo 'Error: 429 Too Many Requests'; exit 1",
+			ErrRateLimited,
+		},
+		"registry unavailable": {
+			"echo 'Error: 503 Service Unavailable' >&2; exit 1",
+			ErrUnavailable,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			d := fakeMeda(t, tt.script)
+			err := d.CreateVM(VMOptions{Name: "packer-test", BaseImage: "ubuntu:99.04", Memory: "1G", CPUs: 1, DiskSize: "10G"})
+			if !errors.Is(err, tt.kind) {
+				t.Errorf("CreateVM error %v is not %v", err, tt.kind)
+			}
+		})
+	}
+
+	d := fakeMeda(t, "echo 'Created VM packer-test'")
+	if err := d.CreateVM(VMOptions{Name: "packer-test", BaseImage: "ubuntu:24.04"}); err != nil {
+		t.Errorf("CreateVM: %s", err)
+	}
+}
@@ -0,0 +1,298 @@
+package driver
+
+import (
+	"io"
+	"strings"
+	"time"
+)
+
+// MockVMIP is the address of the simulated build VM, from TEST-NET-1 so
+// it can't reach a real host by accident
+const MockVMIP = "192.0.2.10"
+
+// NewMockDriver returns the driver of mock_mode. Every call succeeds, the
+// base image exists, the VM gets MockVMIP and captured images have a
+// placeholder digest.
+func NewMockDriver() *MockDriver {
+	return &MockDriver{
+		ImageExistsResult:    true,
+		GetVMIPResult:        MockVMIP,
+		GetVMAddressesResult: []VMAddress{{Interface: "eth0", IP: MockVMIP}},
+		InspectImageResult: &ImageInfo{
+			Digest:    "sha256:" + strings.Repeat("0", 64),
+			CreatedAt: time.Now().UTC().Format(time.RFC3339),
+		},
+	}
+}
+
+// MockDriver is a MedaDriver that records calls instead of talking to Meda,
+// for exercising step logic without a hypervisor
+type MockDriver struct {
+	PingCalled bool
+	PingErr    error
+
+	ImageExistsCalled bool
+	ImageExistsName   string
+	ImageExistsResult bool
+	ImageExistsErr    error
+
+	ListImagesCalled bool
+	ListImagesResult []string
+	ListImagesErr    error
+
+	CreateImageCalled bool
+	CreateImageNames  []string
+	CreateImageErr    error
+
+	CreateImageFromVMCalled bool
+	CreateImageFromVMVM     string
+	CreateImageFromVMName   string
+	CreateImageFromVMTag    string
+	CreateImageFromVMLabels map[string]string
+	CreateImageFromVMErr    error
+
+	CreateImageFromSnapshotCalled   bool
+	CreateImageFromSnapshotVM       string
+	CreateImageFromSnapshotSnapshot string
+	CreateImageFromSnapshotName     string
+	CreateImageFromSnapshotTag      string
+	CreateImageFromSnapshotErr      error
+
+	DeleteImageCalled bool
+	DeleteImageName   string
+	DeleteImageErr    error
+
+	InspectImageCalled bool
+	InspectImageRef    string
+	InspectImageResult *ImageInfo
+	InspectImageErr    error
+
+	ExportImageCalled bool
+	ExportImageRef    string
+	ExportImagePath   string
+	ExportImageFormat string
+	ExportImageErr    error
+
+	ExportImageStreamCalled bool
+	ExportImageStreamRef    string
+	ExportImageStreamFormat string
+	ExportImageStreamData   string
+	ExportImageStreamErr    error
+
+	ImportImageCalled bool
+	ImportImagePath   string
+	ImportImageName   string
+	ImportImageErr    error
+
+	ImportImageStreamCalled bool
+	ImportImageStreamName   string
+	ImportImageStreamData   string
+	ImportImageStreamErr    error
+
+	PushImageCalled bool
+	PushImageOpts   PushOptions
+	PushImageErr    error
+
+	ListVMsCalled bool
+	ListVMsResult []VMInfo
+	ListVMsErr    error
+
+	CreateVMCalled bool
+	CreateVMOpts   VMOptions
+	CreateVMErr    error
+
+	StartVMCalled bool
+	StartVMName   string
+	StartVMErr    error
+
+	StopVMCalled bool
+	StopVMName   string
+	StopVMErr    error
+
+	ResizeVMCalled bool
+	ResizeVMName   string
+	ResizeVMMemory string
+	ResizeVMCPUs   int
+	ResizeVMErr    error
+
+	SnapshotVMCalled   bool
+	SnapshotVMName     string
+	SnapshotVMSnapshot string
+	SnapshotVMErr      error
+
+	DeleteSnapshotCalled   bool
+	DeleteSnapshotName     string
+	DeleteSnapshotSnapshot string
+	DeleteSnapshotErr      error
+
+	DeleteVMCalled bool
+	DeleteVMNames  []string
+	DeleteVMErr    error
+
+	GetVMIPCalled bool
+	GetVMIPName   string
+	GetVMIPResult string
+	GetVMIPErr    error
+
+	GetVMAddressesCalled bool
+	GetVMAddressesName   string
+	GetVMAddressesResult []VMAddress
+	GetVMAddressesErr    error
+}
+
+func (d *MockDriver) Ping() error {
+	d.PingCalled = true
+	return d.PingErr
+}
+
+func (d *MockDriver) ImageExists(name string) (bool, error) {
+	d.ImageExistsCalled = true
+	d.ImageExistsName = name
+	return d.ImageExistsResult, d.ImageExistsErr
+}
+
+func (d *MockDriver) ListImages() ([]string, error) {
+	d.ListImagesCalled = true
+	return d.ListImagesResult, d.ListImagesErr
+}
+
+func (d *MockDriver) CreateImage(name string) error {
+	d.CreateImageCalled = true
+	d.CreateImageNames = append(d.CreateImageNames, name)
+	return d.CreateImageErr
+}
+
+func (d *MockDriver) CreateImageFromVM(vmName, name, tag string, labels map[string]string) error {
+	d.CreateImageFromVMCalled = true
+	d.CreateImageFromVMVM = vmName
+	d.CreateImageFromVMName = name
+	d.CreateImageFromVMTag = tag
+	d.CreateImageFromVMLabels = labels
+	return d.CreateImageFromVMErr
+}
+
+func (d *MockDriver) CreateImageFromSnapshot(vmName, snapshot, name, tag string, labels map[string]string) error {
+	d.CreateImageFromSnapshotCalled = true
+	d.CreateImageFromSnapshotVM = vmName
+	d.CreateImageFromSnapshotSnapshot = snapshot
+	d.CreateImageFromSnapshotName = name
+	d.CreateImageFromSnapshotTag = tag
+	return d.CreateImageFromSnapshotErr
+}
+
+func (d *MockDriver) DeleteImage(name string) error {
+	d.DeleteImageCalled = true
+	d.DeleteImageName = name
+	return d.DeleteImageErr
+}
+
+func (d *MockDriver) InspectImage(ref string) (*ImageInfo, error) {
+	d.InspectImageCalled = true
+	d.InspectImageRef = ref
+	return d.InspectImageResult, d.InspectImageErr
+}
+
+func (d *MockDriver) ExportImage(ref, path, format string) error {
+	d.ExportImageCalled = true
+	d.ExportImageRef = ref
+	d.ExportImagePath = path
+	d.ExportImageFormat = format
+	return d.ExportImageErr
+}
+
+func (d *MockDriver) ExportImageStream(ref, format string) (io.ReadCloser, error) {
+	d.ExportImageStreamCalled = true
+	d.ExportImageStreamRef = ref
+	d.ExportImageStreamFormat = format
+	if d.ExportImageStreamErr != nil {
+		return nil, d.ExportImageStreamErr
+	}
+	return io.NopCloser(strings.NewReader(d.ExportImageStreamData)), nil
+}
+
+func (d *MockDriver) ImportImage(path, name string) error {
+	d.ImportImageCalled = true
+	d.ImportImagePath = path
+	d.ImportImageName = name
+	return d.ImportImageErr
+}
+
+func (d *MockDriver) ImportImageStream(r io.Reader, name string) error {
+	d.ImportImageStreamCalled = true
+	d.ImportImageStreamName = name
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	d.ImportImageStreamData = string(data)
+	return d.ImportImageStreamErr
+}
+
+func (d *MockDriver) PushImage(opts PushOptions) error {
+	d.PushImageCalled = true
+	d.PushImageOpts = opts
+	return d.PushImageErr
+}
+
+func (d *MockDriver) ListVMs() ([]VMInfo, error) {
+	d.ListVMsCalled = true
+	return d.ListVMsResult, d.ListVMsErr
+}
+
+func (d *MockDriver) CreateVM(opts VMOptions) error {
+	d.CreateVMCalled = true
+	d.CreateVMOpts = opts
+	return d.CreateVMErr
+}
+
+func (d *MockDriver) StartVM(name string) error {
+	d.StartVMCalled = true
+	d.StartVMName = name
+	return d.StartVMErr
+}
+
+func (d *MockDriver) StopVM(name string) error {
+	d.StopVMCalled = true
+	d.StopVMName = name
+	return d.StopVMErr
+}
+
+func (d *MockDriver) ResizeVM(name, memory string, cpus int) error {
+	d.ResizeVMCalled = true
+	d.ResizeVMName = name
+	d.ResizeVMMemory = memory
+	d.ResizeVMCPUs = cpus
+	return d.ResizeVMErr
+}
+
+func (d *MockDriver) SnapshotVM(name, snapshot string) error {
+	d.SnapshotVMCalled = true
+	d.SnapshotVMName = name
+	d.SnapshotVMSnapshot = snapshot
+	return d.SnapshotVMErr
+}
+
+func (d *MockDriver) DeleteSnapshot(name, snapshot string) error {
+	d.DeleteSnapshotCalled = true
+	d.DeleteSnapshotName = name
+	d.DeleteSnapshotSnapshot = snapshot
+	return d.DeleteSnapshotErr
+}
+
+func (d *MockDriver) DeleteVM(name string) error {
+	d.DeleteVMCalled = true
+	d.DeleteVMNames = append(d.DeleteVMNames, name)
+	return d.DeleteVMErr
+}
+
+func (d *MockDriver) GetVMIP(name string) (string, error) {
+	d.GetVMIPCalled = true
+	d.GetVMIPName = name
+	return d.GetVMIPResult, d.GetVMIPErr
+}
+
+func (d *MockDriver) GetVMAddresses(name string) ([]VMAddress, error) {
+	d.GetVMAddressesCalled = true
+	d.GetVMAddressesName = name
+	return d.GetVMAddressesResult, d.GetVMAddressesErr
+}
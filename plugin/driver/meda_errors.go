@@ -0,0 +1,177 @@
+package driver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Kinds of Meda failures. Errors returned by drivers wrap one of these
+// when the cause could be recognized.
+var (
+	ErrNotFound  = errors.New("not found")
+	ErrAuth      = errors.New("authentication failed")
+	ErrQuota     = errors.New("quota exceeded")
+	ErrOutOfDisk = errors.New("host out of disk")
+	// ErrUnavailable is a server error that may clear on its own
+	ErrUnavailable = errors.New("service unavailable")
+)
+
+// ErrRateLimited is a quota error caused by a rate limit, which clears by
+// waiting, unlike a used up quota
+var ErrRateLimited = fmt.Errorf("%w: rate limited", ErrQuota)
+
+// apiErrorKinds maps API response statuses to error kinds
+var apiErrorKinds = map[int]error{
+	401: ErrAuth,
+	403: ErrAuth,
+	404: ErrNotFound,
+	429: ErrRateLimited,
+	500: ErrUnavailable,
+	502: ErrUnavailable,
+	503: ErrUnavailable,
+	504: ErrUnavailable,
+	507: ErrOutOfDisk,
+}
+
+// cliErrorKinds recognizes error kinds in meda's output. meda's exit
+// status doesn't tell causes apart, the message does. Kinds are tried in
+// order, the more specific ones first.
+var cliErrorKinds = []struct {
+	kind    error
+	pattern *regexp.Regexp
+}{
+	{ErrOutOfDisk, regexp.MustCompile(`(?i)no space left on device|out of disk|insufficient storage`)},
+	{ErrRateLimited, regexp.MustCompile(`(?i)too many requests|toomanyrequests|rate limit`)},
+	{ErrQuota, regexp.MustCompile(`(?i)quota`)},
+	{ErrAuth, regexp.MustCompile(`(?i)unauthorized|authentication required|access denied|permission denied|forbidden`)},
+	{ErrNotFound, regexp.MustCompile(`(?i)not found|no such (image|vm|file)|manifest unknown|does not exist`)},
+	{ErrUnavailable, regexp.MustCompile(`(?i)internal server error|bad gateway|service unavailable|gateway time-?out`)},
+}
+
+// httpStatusPattern finds an HTTP status a registry reported in meda's output
+var httpStatusPattern = regexp.MustCompile(`\b(401|403|404|429|500|502|503|504|507)\b`)
+
+// medaError is a Meda failure of a known kind. It reads like "not found:
+// image ubuntu:24.04 is not in the registry (404)" instead of the raw
+// command output or response body, which go to the Packer log.
+type medaError struct {
+	Kind error
+	// Code is the HTTP status, or the exit status of the CLI
+	Code   string
+	Detail string
+	Err    error
+}
+
+func (e *medaError) Error() string {
+	if e.Detail == "" {
+		return fmt.Sprintf("%s (%s)", e.Kind, e.Code)
+	}
+	return fmt.Sprintf("%s: %s (%s)", e.Kind, e.Detail, e.Code)
+}
+
+func (e *medaError) Unwrap() []error {
+	return []error{e.Kind, e.Err}
+}
+
+// apiErrorDetail extracts the message from an API error body, which is
+// JSON with an error or message field
+func apiErrorDetail(body string) string {
+	var parsed struct {
+		Error   string `json:"error"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal([]byte(body), &parsed); err == nil {
+		if parsed.Error != "" {
+			return parsed.Error
+		}
+		if parsed.Message != "" {
+			return parsed.Message
+		}
+	}
+	return lastLine(body)
+}
+
+// classifyAPIError turns an API error with a known status into a medaError
+func classifyAPIError(apiErr *APIError) error {
+	kind, ok := apiErrorKinds[apiErr.StatusCode]
+	if !ok {
+		return apiErr
+	}
+	log.Printf("Meda API error: %s", apiErr)
+	return &medaError{
+		Kind:   kind,
+		Code:   strconv.Itoa(apiErr.StatusCode),
+		Detail: apiErrorDetail(apiErr.Body),
+		Err:    apiErr,
+	}
+}
+
+// cliError describes a failed meda command from its error and output.
+// Failures of a known kind become a medaError with the line meda reported
+// the error on; anything else keeps the full output.
+func cliError(err error, output string) error {
+	if err == nil {
+		return nil
+	}
+	output = strings.TrimSpace(output)
+
+	for _, k := range cliErrorKinds {
+		if !k.pattern.MatchString(output) {
+			continue
+		}
+		log.Printf("meda failed: %s - %s", err, output)
+
+		code := err.Error()
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			code = fmt.Sprintf("exit status %d", exitErr.ExitCode())
+		}
+		if status := httpStatusPattern.FindString(output); status != "" {
+			code = status
+		}
+		return &medaError{Kind: k.kind, Code: code, Detail: cliErrorLine(output), Err: err}
+	}
+
+	if output != "" {
+		return fmt.Errorf("%s - %s", err, output)
+	}
+	return err
+}
+
+// cliErrorLine returns the line meda reported the error on: the last line
+// starting with "Error", or else the last line of output
+func cliErrorLine(output string) string {
+	lines := strings.Split(output, "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		line := strings.TrimSpace(lines[i])
+		if strings.HasPrefix(strings.ToLower(line), "error") {
+			return strings.TrimSpace(strings.TrimLeft(line[len("error"):], ": "))
+		}
+	}
+	return lastLine(output)
+}
+
+// lastLine returns the last non-empty line of s
+func lastLine(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
+
+// refineKind returns err with its kind replaced by kind, a more specific
+// error wrapping the kind err has, e.g. ErrVMNotFound for ErrNotFound.
+// Errors of other kinds are returned unchanged.
+func refineKind(err error, kind error) error {
+	var me *medaError
+	if errors.As(err, &me) && errors.Is(kind, me.Kind) {
+		refined := *me
+		refined.Kind = kind
+		return &refined
+	}
+	return err
+}
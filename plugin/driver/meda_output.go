@@ -0,0 +1,177 @@
+package driver
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// medaVersionPattern finds the version in `meda --version` output
+var medaVersionPattern = regexp.MustCompile(`(\d+)\.(\d+)\.(\d+)`)
+
+// medaVersion is a meda release as major, minor and patch number
+type medaVersion [3]int
+
+func (v medaVersion) String() string {
+	return fmt.Sprintf("%d.%d.%d", v[0], v[1], v[2])
+}
+
+// atLeast reports whether v is the release o or a later one
+func (v medaVersion) atLeast(o medaVersion) bool {
+	for i := range v {
+		if v[i] != o[i] {
+			return v[i] > o[i]
+		}
+	}
+	return true
+}
+
+// parseMedaVersion extracts the version from `meda --version` output
+func parseMedaVersion(output string) (medaVersion, bool) {
+	m := medaVersionPattern.FindStringSubmatch(output)
+	if m == nil {
+		return medaVersion{}, false
+	}
+	var v medaVersion
+	for i := range v {
+		v[i], _ = strconv.Atoi(m[i+1])
+	}
+	return v, true
+}
+
+// medaOutputFormat is how a range of meda releases lists images and
+// prints VM addresses. Each parser reports whether the output is in its
+// format at all, so a layout change is noticed instead of reading as
+// "image missing" or "no IP yet".
+type medaOutputFormat struct {
+	// since is the first meda release printing this format
+	since medaVersion
+	// imagesArgs is the meda command listing images
+	imagesArgs []string
+	// images returns the name:tag references the listing contains
+	images func(output string) (refs []string, ok bool)
+	// ip returns the address printed by `meda ip`, empty while the VM has
+	// none
+	ip func(output string) (ip string, ok bool)
+}
+
+// medaOutputFormats are the supported formats, oldest first
+var medaOutputFormats = []medaOutputFormat{
+	{since: medaVersion{0, 1, 0}, imagesArgs: []string{"images"}, images: parseImagesTable, ip: parseIPLine},
+	{since: medaVersion{0, 2, 0}, imagesArgs: []string{"images", "list", "--json"}, images: parseImagesJSON, ip: parseIPLine},
+}
+
+// medaOutputFormatsFor returns the formats to try for meda release v: its
+// own first, then the others newest first in case the output changed
+// without a version bump. An unknown version tries the newest first.
+func medaOutputFormatsFor(v medaVersion, known bool) []medaOutputFormat {
+	var formats, others []medaOutputFormat
+	for i := len(medaOutputFormats) - 1; i >= 0; i-- {
+		f := medaOutputFormats[i]
+		if formats == nil && (!known || v.atLeast(f.since)) {
+			formats = append(formats, f)
+		} else {
+			others = append(others, f)
+		}
+	}
+	return append(formats, others...)
+}
+
+// noImagesPattern matches the message printed instead of an empty table
+var noImagesPattern = regexp.MustCompile(`(?im)^\s*no images`)
+
+// parseImagesTable reads the `meda images` table. The NAME (or
+// REPOSITORY) and TAG columns are found by their header, case-insensitive;
+// without a header the first column is taken as the reference.
+func parseImagesTable(output string) ([]string, bool) {
+	if noImagesPattern.MatchString(output) {
+		return nil, true
+	}
+
+	var refs []string
+	name, tag := 0, -1
+	header := false
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if !header {
+			for i, field := range fields {
+				switch strings.ToUpper(field) {
+				case "NAME", "REPOSITORY":
+					name, header = i, true
+				case "TAG":
+					tag = i
+				}
+			}
+			if header {
+				// Anything before the header is cargo output
+				refs = nil
+				continue
+			}
+			tag = -1
+		}
+		if len(fields) <= name {
+			continue
+		}
+		ref := fields[name]
+		if tag >= 0 && len(fields) > tag {
+			ref += ":" + fields[tag]
+		}
+		refs = append(refs, ref)
+	}
+	return refs, true
+}
+
+// parseImagesJSON reads the JSON array of `meda images list --json`. Cargo
+// output before it is skipped.
+func parseImagesJSON(output string) ([]string, bool) {
+	start := strings.Index(output, "[")
+	if start < 0 {
+		return nil, false
+	}
+	var images []struct {
+		Name string `json:"name"`
+		Tag  string `json:"tag"`
+	}
+	if err := json.Unmarshal([]byte(output[start:]), &images); err != nil {
+		return nil, false
+	}
+	refs := make([]string, 0, len(images))
+	for _, image := range images {
+		ref := image.Name
+		if image.Tag != "" && !strings.Contains(path.Base(ref), ":") {
+			ref += ":" + image.Tag
+		}
+		refs = append(refs, ref)
+	}
+	return refs, true
+}
+
+// parseIPLine accepts output holding a bare address, or nothing yet
+func parseIPLine(output string) (string, bool) {
+	ip := parseIP(output)
+	return ip, ip != "" || strings.TrimSpace(output) == ""
+}
+
+// imageListed reports whether name, with or without tag, is one of refs.
+// Repositories with a registry or organization prefix match on their
+// last path component.
+func imageListed(refs []string, name string) bool {
+	for _, ref := range refs {
+		repo := ref
+		if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+			repo = ref[:i]
+		}
+		for _, candidate := range []string{ref, repo, path.Base(ref), path.Base(repo)} {
+			if candidate == name {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,118 @@
+package driver
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+func TestImageListed(t *testing.T) {
+	tests := []struct {
+		name  string
+		refs  []string
+		image string
+		want  bool
+	}{
+		{"name matches any tag", []string{"ubuntu:latest"}, "ubuntu", true},
+		{"name is a prefix of another", []string{"ubuntu-slim:latest"}, "ubuntu", false},
+		{"other name is a prefix", []string{"ubuntu:latest"}, "ubuntu-slim", false},
+		{"both listed", []string{"ubuntu-slim:latest", "ubuntu:24.04"}, "ubuntu-slim", true},
+		{"name:tag matches", []string{"app:tag"}, "app:tag", true},
+		{"tag is a prefix of another", []string{"app:tag2"}, "app:tag", false},
+		{"other tag is a prefix", []string{"app:tag"}, "app:tag2", false},
+		{"untagged ref", []string{"app"}, "app", true},
+		{"registry and organization", []string{"ghcr.io/cirunlabs/ubuntu:24.04"}, "ubuntu", true},
+		{"registry and organization with tag", []string{"ghcr.io/cirunlabs/ubuntu:24.04"}, "ubuntu:24.04", true},
+		{"registry and organization, other tag", []string{"ghcr.io/cirunlabs/ubuntu:24.04"}, "ubuntu:24.10", false},
+		{"registry with port", []string{"localhost:5000/ubuntu"}, "ubuntu", true},
+		{"no images", nil, "ubuntu", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := imageListed(tt.refs, tt.image); got != tt.want {
+				t.Errorf("imageListed(%q, %q) = %v, want %v", tt.refs, tt.image, got, tt.want)
+			}
+		})
+	}
+}
+
+// goldenResult renders what a parser returned: "ok" or "unrecognized",
+// then one value per line
+func goldenResult(values []string, ok bool) string {
+	var b strings.Builder
+	if ok {
+		b.WriteString("ok\n")
+	} else {
+		b.WriteString("unrecognized\n")
+	}
+	for _, v := range values {
+		b.WriteString(v + "\n")
+	}
+	return b.String()
+}
+
+// TestMedaOutputFormats_golden parses the samples in testdata/meda-<since>
+// with the parsers of that format and compares the result with the
+// .golden file next to each sample. Samples named images*.txt hold meda's
+// image listing, ip*.txt the output of `meda ip`. Run with -update to
+// rewrite the golden files after a deliberate parser change.
+func TestMedaOutputFormats_golden(t *testing.T) {
+	for _, f := range medaOutputFormats {
+		t.Run(f.since.String(), func(t *testing.T) {
+			dir := filepath.Join("testdata", "meda-"+f.since.String())
+			samples, err := filepath.Glob(filepath.Join(dir, "*.txt"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(samples) == 0 {
+				t.Fatalf("no meda output samples in %s", dir)
+			}
+
+			for _, sample := range samples {
+				name := strings.TrimSuffix(filepath.Base(sample), ".txt")
+				t.Run(name, func(t *testing.T) {
+					data, err := os.ReadFile(sample)
+					if err != nil {
+						t.Fatal(err)
+					}
+
+					var got string
+					switch {
+					case strings.HasPrefix(name, "images"):
+						refs, ok := f.images(string(data))
+						got = goldenResult(refs, ok)
+					case strings.HasPrefix(name, "ip"):
+						ip, ok := f.ip(string(data))
+						var values []string
+						if ip != "" {
+							values = append(values, ip)
+						}
+						got = goldenResult(values, ok)
+					default:
+						t.Fatalf("sample %s is neither images*.txt nor ip*.txt", sample)
+					}
+
+					golden := strings.TrimSuffix(sample, ".txt") + ".golden"
+					if *update {
+						if err := os.WriteFile(golden, []byte(got), 0644); err != nil {
+							t.Fatal(err)
+						}
+						return
+					}
+					want, err := os.ReadFile(golden)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if got != string(want) {
+						t.Errorf("%s parsed as\n%s\nwant\n%s", sample, got, want)
+					}
+				})
+			}
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package driver
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+var percentPattern = regexp.MustCompile(`(\d{1,3})(?:\.\d+)?%`)
+
+// transferPattern matches download counters such as "312.5 MiB / 2.1 GiB"
+var transferPattern = regexp.MustCompile(`(\d+(?:\.\d+)?)\s*([KMGT]i?B|B)\s*/\s*(\d+(?:\.\d+)?)\s*([KMGT]i?B|B)`)
+
+// progressETAAfter is how long a task has to run before an estimate of the
+// remaining time is shown, early rates are too noisy
+const progressETAAfter = 10 * time.Second
+
+// progressEvent is the JSON progress line format emitted by meda
+type progressEvent struct {
+	Progress        *float64 `json:"progress"`
+	Percent         *float64 `json:"percent"`
+	SizeBytes       *int64   `json:"size_bytes"`
+	DownloadedBytes *int64   `json:"downloaded_bytes"`
+	TotalBytes      *int64   `json:"total_bytes"`
+}
+
+// parseProgress extracts a completion percentage and, if reported, the final
+// image size from one line of meda output. Both JSON progress events and
+// plain "... 42%" lines are understood.
+func parseProgress(line string) (percent int, sizeBytes int64, ok bool) {
+	line = strings.TrimSpace(line)
+	percent = -1
+
+	if strings.HasPrefix(line, "{") {
+		var event progressEvent
+		if err := json.Unmarshal([]byte(line), &event); err == nil {
+			switch {
+			case event.Progress != nil:
+				percent = int(*event.Progress)
+			case event.Percent != nil:
+				percent = int(*event.Percent)
+			}
+			if event.SizeBytes != nil {
+				sizeBytes = *event.SizeBytes
+			}
+			return percent, sizeBytes, percent >= 0 || sizeBytes > 0
+		}
+	}
+
+	if m := percentPattern.FindStringSubmatch(line); m != nil {
+		if p, err := strconv.Atoi(m[1]); err == nil && p <= 100 {
+			return p, 0, true
+		}
+	}
+	return -1, 0, false
+}
+
+// parseTransfer extracts the bytes done and the total of a download from
+// one line of meda output, either a JSON progress event or a plain
+// "312.5 MiB / 2.1 GiB" counter
+func parseTransfer(line string) (done, total int64, ok bool) {
+	line = strings.TrimSpace(line)
+
+	if strings.HasPrefix(line, "{") {
+		var event progressEvent
+		if err := json.Unmarshal([]byte(line), &event); err == nil {
+			if event.DownloadedBytes != nil && event.TotalBytes != nil && *event.TotalBytes > 0 {
+				return *event.DownloadedBytes, *event.TotalBytes, true
+			}
+			return 0, 0, false
+		}
+	}
+
+	m := transferPattern.FindStringSubmatch(line)
+	if m == nil {
+		return 0, 0, false
+	}
+	done, total = parseByteSize(m[1], m[2]), parseByteSize(m[3], m[4])
+	return done, total, total > 0 && done <= total
+}
+
+// parseByteSize converts a number with a unit such as MiB or MB to bytes.
+// Decimal and binary units are both treated as binary, the difference
+// doesn't matter for an estimate.
+func parseByteSize(number, unit string) int64 {
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0
+	}
+	exp := 0
+	if unit != "B" {
+		exp = strings.IndexByte("KMGT", unit[0]) + 1
+	}
+	return int64(n * math.Pow(1024, float64(exp)))
+}
+
+// progressReporter turns meda output into "<label>: N%" UI messages. Only
+// changes of at least 5 points are shown so the log stays readable, while
+// the raw lines still go to the Packer log. Downloads also report their
+// total size and, once running for a while, the estimated time left.
+type progressReporter struct {
+	ui      packer.Ui
+	label   string
+	last    int
+	size    int64
+	total   int64
+	started time.Time
+}
+
+func newProgressReporter(ui packer.Ui, label string) *progressReporter {
+	return &progressReporter{ui: ui, label: label, last: -1, started: time.Now()}
+}
+
+// Line handles one line of command output
+func (p *progressReporter) Line(line string) {
+	percent, size, ok := parseProgress(line)
+	if done, total, isTransfer := parseTransfer(line); isTransfer {
+		percent, ok = int(done*100/total), true
+		p.total = total
+	}
+	if !ok {
+		sayOrLog(p.ui, line)
+		return
+	}
+	if size > 0 {
+		p.size = size
+	}
+	if percent >= 0 && (p.last < 0 || percent-p.last >= 5 || percent == 100) && percent != p.last {
+		p.last = percent
+		sayOrLog(p.ui, p.message(percent))
+	}
+}
+
+// message renders the progress line for percent
+func (p *progressReporter) message(percent int) string {
+	msg := fmt.Sprintf("%s: %d%%", p.label, percent)
+	if p.total > 0 {
+		msg += " of " + FormatBytes(p.total)
+	}
+	elapsed := time.Since(p.started)
+	if percent > 0 && percent < 100 && elapsed >= progressETAAfter {
+		left := time.Duration(float64(elapsed) * float64(100-percent) / float64(percent))
+		msg += fmt.Sprintf(", about %s left", left.Round(time.Second))
+	}
+	return msg
+}
+
+// Done reports the final image size when meda provided one
+func (p *progressReporter) Done() {
+	if p.size > 0 {
+		sayOrLog(p.ui, fmt.Sprintf("%s: done, image size %s", p.label, FormatBytes(p.size)))
+	}
+}
+
+// FormatBytes renders a byte count using binary units
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,115 @@
+package driver
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// promptPattern matches the unfinished last line of output that an
+// interactive prompt typically leaves behind
+var promptPattern = regexp.MustCompile(`(?i)(\[y/n\]|\(y/n\)|\[yes/no\]|\(yes/no\)|are you sure.*|password:|passphrase.*:|press enter.*|continue\?)\s*$`)
+
+// promptSettleTime is how long a prompt-like line has to stay unfinished
+// before the command is considered to be waiting for input
+const promptSettleTime = 2 * time.Second
+
+// promptContextLines is how many lines of output before the prompt the
+// error shows, for what meda was asking about
+const promptContextLines = 10
+
+// promptWatcher receives the output of a meda command and kills the command
+// when it stops at an interactive prompt, so that a non-interactive build
+// fails fast instead of hanging
+type promptWatcher struct {
+	cmd *exec.Cmd
+
+	mu      sync.Mutex
+	partial []byte
+	// tail holds the last complete lines of output
+	tail    []string
+	timer   *time.Timer
+	prompt  string
+	stopped bool
+}
+
+func newPromptWatcher(cmd *exec.Cmd) *promptWatcher {
+	return &promptWatcher{cmd: cmd}
+}
+
+func (w *promptWatcher) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+
+	w.partial = append(w.partial, b...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			break
+		}
+		if line := strings.TrimSpace(string(w.partial[:i])); line != "" {
+			w.tail = append(w.tail, line)
+			if len(w.tail) > promptContextLines {
+				w.tail = w.tail[1:]
+			}
+		}
+		w.partial = w.partial[i+1:]
+	}
+
+	line := strings.TrimSpace(string(w.partial))
+	if line != "" && promptPattern.MatchString(line) && !w.stopped {
+		w.timer = time.AfterFunc(promptSettleTime, func() {
+			w.fire(line)
+		})
+	}
+	return len(b), nil
+}
+
+func (w *promptWatcher) fire(line string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.stopped {
+		return
+	}
+	w.prompt = line
+	if w.cmd.Process != nil {
+		_ = w.cmd.Process.Kill()
+	}
+}
+
+// Stop disarms the watcher once the command has exited
+func (w *promptWatcher) Stop() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.stopped = true
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+}
+
+// Err reports the prompt the command was killed at, if any, with the
+// output leading up to it. Secrets are masked.
+func (w *promptWatcher) Err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.prompt == "" {
+		return nil
+	}
+	msg := fmt.Sprintf("meda is waiting for input at %q, which can't be answered in non-interactive mode", w.prompt)
+	if len(w.tail) > 0 {
+		msg += "; output before the prompt:\n" + strings.Join(w.tail, "\n")
+	}
+	return errors.New(packer.LogSecretFilter.FilterString(msg))
+}
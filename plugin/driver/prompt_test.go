@@ -0,0 +1,49 @@
+package driver
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+func TestPromptWatcherErr_includesOutput(t *testing.T) {
+	packer.LogSecretFilter.Set("s3cret-token")
+
+	w := newPromptWatcher(exec.Command("true"))
+	for i := 1; i <= promptContextLines+2; i++ {
+		fmt.Fprintf(w, "line %d\n", i)
+	}
+	fmt.Fprint(w, "Logging in with s3cret-token\nImage ubuntu:24.04 exists. Overwrite? [y/N]\n\n")
+	fmt.Fprint(w, "Are you sure? [y/n] ")
+	w.fire("Are you sure? [y/n]")
+	w.Stop()
+
+	err := w.Err()
+	if err == nil {
+		t.Fatal("no error after the prompt fired")
+	}
+	msg := err.Error()
+	for _, want := range []string{`"Are you sure? [y/n]"`, "Overwrite? [y/N]", "Logging in with <sensitive>"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("error %q does not contain %q", msg, want)
+		}
+	}
+	if strings.Contains(msg, "s3cret-token") {
+		t.Errorf("error %q shows a secret", msg)
+	}
+	if strings.Contains(msg, "line 4\n") {
+		t.Errorf("error %q has more than %d lines of output", msg, promptContextLines)
+	}
+}
+
+func TestPromptWatcherErr_noPrompt(t *testing.T) {
+	w := newPromptWatcher(exec.Command("true"))
+	fmt.Fprint(w, "done\n")
+	w.Stop()
+	if err := w.Err(); err != nil {
+		t.Errorf("Err() = %v without a prompt", err)
+	}
+}
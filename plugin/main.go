@@ -1,30 +1,52 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"io"
+	"log"
 	"os"
 
+	"github.com/hashicorp/packer-plugin-sdk/packer"
 	"github.com/hashicorp/packer-plugin-sdk/plugin"
-	"github.com/hashicorp/packer-plugin-sdk/version"
-)
 
-var (
-	// Version is the main version number that is being run at the moment.
-	Version = "1.0.0"
-	// VersionPrerelease is a pre-release marker for the version. If this is ""
-	// (empty string) then it means that it is a final release. Otherwise, this
-	// is a pre-release such as "dev" (in development), "beta", "rc1", etc.
-	VersionPrerelease = ""
+	"github.com/cirunlabs/packer-plugin-meda/builder/meda"
+	"github.com/cirunlabs/packer-plugin-meda/version"
 )
 
 func main() {
+	if len(os.Args) > 1 && meda.Subcommands[os.Args[1]] != nil {
+		// Like Packer, only show the plugin's log with PACKER_LOG set
+		if os.Getenv("PACKER_LOG") == "" {
+			log.SetOutput(io.Discard)
+		}
+		err := meda.Subcommands[os.Args[1]](os.Args[2:], os.Stdout, os.Stderr)
+		if err != nil && err != flag.ErrHelp {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+
 	pps := plugin.NewSet()
-	pps.RegisterBuilder("vm", new(Builder))
-	pps.SetVersion(version.NewPluginVersion(Version, VersionPrerelease, ""))
+	for _, c := range meda.Components {
+		for _, name := range append([]string{c.Name}, c.Aliases...) {
+			switch c.Kind {
+			case "builder":
+				pps.RegisterBuilder(name, c.New().(packer.Builder))
+			case "data-source":
+				pps.RegisterDatasource(name, c.New().(packer.Datasource))
+			case "provisioner":
+				pps.RegisterProvisioner(name, c.New().(packer.Provisioner))
+			case "post-processor":
+				pps.RegisterPostProcessor(name, c.New().(packer.PostProcessor))
+			}
+		}
+	}
+	pps.SetVersion(version.PluginVersion)
 	err := pps.Run()
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err.Error())
 		os.Exit(1)
 	}
 }
-
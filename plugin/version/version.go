@@ -0,0 +1,17 @@
+// Package version holds the version of the plugin, set at release time
+// with -ldflags "-X github.com/cirunlabs/packer-plugin-meda/version.Version=..."
+package version
+
+import "github.com/hashicorp/packer-plugin-sdk/version"
+
+var (
+	// Version is the main version number that is being run at the moment.
+	Version = "1.0.0"
+	// VersionPrerelease is a pre-release marker for the version. If this is ""
+	// (empty string) then it means that it is a final release. Otherwise, this
+	// is a pre-release such as "dev" (in development), "beta", "rc1", etc.
+	VersionPrerelease = ""
+)
+
+// PluginVersion is the version reported to Packer
+var PluginVersion = version.NewPluginVersion(Version, VersionPrerelease, "")